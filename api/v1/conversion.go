@@ -0,0 +1,67 @@
+package v1
+
+import (
+	"encoding/json"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// HubSpecAnnotation keeps the hub (v2) spec on a v1 object, so that fields which
+// could not be represented in v1 survive a round trip through v1 clients
+const HubSpecAnnotation = "vpn-gw.kube-combo.com/v2-spec"
+
+// saveHubSpec stores the hub spec into the annotations of the v1 object meta
+func saveHubSpec(meta *metav1.ObjectMeta, spec interface{}) error {
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+	annotations := make(map[string]string, len(meta.Annotations)+1)
+	for k, v := range meta.Annotations {
+		annotations[k] = v
+	}
+	annotations[HubSpecAnnotation] = string(data)
+	meta.Annotations = annotations
+	return nil
+}
+
+// restoreHubSpec loads the hub spec saved by saveHubSpec and drops the annotation,
+// returns false if there is no saved hub spec
+func restoreHubSpec(meta *metav1.ObjectMeta, spec interface{}) (bool, error) {
+	data, ok := meta.Annotations[HubSpecAnnotation]
+	if !ok {
+		return false, nil
+	}
+	annotations := make(map[string]string, len(meta.Annotations))
+	for k, v := range meta.Annotations {
+		if k != HubSpecAnnotation {
+			annotations[k] = v
+		}
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	meta.Annotations = annotations
+	if err := json.Unmarshal([]byte(data), spec); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// setAnnotation sets or removes the annotation if value is empty, the annotations are copied
+// as the object meta is shared between the converted objects
+func setAnnotation(meta *metav1.ObjectMeta, key, value string) {
+	annotations := make(map[string]string, len(meta.Annotations)+1)
+	for k, v := range meta.Annotations {
+		if k != key {
+			annotations[k] = v
+		}
+	}
+	if value != "" {
+		annotations[key] = value
+	}
+	if len(annotations) == 0 {
+		annotations = nil
+	}
+	meta.Annotations = annotations
+}
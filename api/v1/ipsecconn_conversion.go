@@ -0,0 +1,104 @@
+package v1
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+// PrivateCidrsAnnotation keeps the private cidrs written by v1 clients verbatim on the v2 object,
+// so that v1 clients read back what they wrote even if the cidrs were normalized during conversion
+const PrivateCidrsAnnotation = "vpn-gw.kube-combo.com/v1-private-cidrs"
+
+type privateCidrs struct {
+	Local  string `json:"local"`
+	Remote string `json:"remote"`
+}
+
+// ConvertTo converts this IpsecConn to the Hub version (v2).
+// the free-form private cidrs are parsed into traffic selectors leniently, so that the stored objects always convert,
+// the values which could not be parsed are kept in the unconverted cidrs annotation and reported by the controller
+func (src *IpsecConn) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*vpngwv2.IpsecConn)
+	dst.ObjectMeta = src.ObjectMeta
+	// start from the saved v2 spec, so that v2 only fields like children are kept
+	if _, err := restoreHubSpec(&dst.ObjectMeta, &dst.Spec); err != nil {
+		return fmt.Errorf("failed to restore v2 spec of ipsec connection %s: %v", src.Name, err)
+	}
+
+	localCidrs, unconvertedLocal := vpngwv2.NormalizeTrafficSelectors(src.Spec.LocalPrivateCidrs)
+	remoteCidrs, unconvertedRemote := vpngwv2.NormalizeTrafficSelectors(src.Spec.RemotePrivateCidrs)
+	setAnnotation(&dst.ObjectMeta, vpngwv2.UnconvertedCidrsAnnotation, strings.Join(append(unconvertedLocal, unconvertedRemote...), ","))
+	setAnnotation(&dst.ObjectMeta, PrivateCidrsAnnotation, "")
+	if vpngwv2.FormatTrafficSelectors(localCidrs) != src.Spec.LocalPrivateCidrs ||
+		vpngwv2.FormatTrafficSelectors(remoteCidrs) != src.Spec.RemotePrivateCidrs {
+		data, err := json.Marshal(privateCidrs{Local: src.Spec.LocalPrivateCidrs, Remote: src.Spec.RemotePrivateCidrs})
+		if err != nil {
+			return fmt.Errorf("failed to save v1 private cidrs of ipsec connection %s: %v", src.Name, err)
+		}
+		setAnnotation(&dst.ObjectMeta, PrivateCidrsAnnotation, string(data))
+	}
+	dst.Spec.VpnGw = src.Spec.VpnGw
+	dst.Spec.Auth = src.Spec.Auth
+	dst.Spec.PskSecret = src.Spec.PskSecret
+	dst.Spec.IkeVersion = src.Spec.IkeVersion
+	dst.Spec.IkeProposals = src.Spec.Proposals
+	dst.Spec.LocalCN = src.Spec.LocalCN
+	dst.Spec.LocalPublicIp = src.Spec.LocalPublicIp
+	dst.Spec.LocalPrivateCidrs = localCidrs
+	dst.Spec.RemoteCN = src.Spec.RemoteCN
+	dst.Spec.RemotePublicIp = src.Spec.RemotePublicIp
+	dst.Spec.RemotePrivateCidrs = remoteCidrs
+	dst.Status.Conditions = src.Status.Conditions
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v2) to this version.
+// traffic selectors are formatted in strongSwan syntax, eg: 10.0.0.0/24[tcp/443],10.1.0.0/24
+func (dst *IpsecConn) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*vpngwv2.IpsecConn)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := saveHubSpec(&dst.ObjectMeta, &src.Spec); err != nil {
+		return fmt.Errorf("failed to save v2 spec of ipsec connection %s: %v", src.Name, err)
+	}
+
+	dst.Spec.VpnGw = src.Spec.VpnGw
+	dst.Spec.Auth = src.Spec.Auth
+	dst.Spec.PskSecret = src.Spec.PskSecret
+	dst.Spec.IkeVersion = src.Spec.IkeVersion
+	dst.Spec.Proposals = src.Spec.IkeProposals
+	dst.Spec.LocalCN = src.Spec.LocalCN
+	dst.Spec.LocalPublicIp = src.Spec.LocalPublicIp
+	dst.Spec.LocalPrivateCidrs = restorePrivateCidrs(src, src.Spec.LocalPrivateCidrs, func(c privateCidrs) string { return c.Local })
+	dst.Spec.RemoteCN = src.Spec.RemoteCN
+	dst.Spec.RemotePublicIp = src.Spec.RemotePublicIp
+	dst.Spec.RemotePrivateCidrs = restorePrivateCidrs(src, src.Spec.RemotePrivateCidrs, func(c privateCidrs) string { return c.Remote })
+	dst.Status.Conditions = src.Status.Conditions
+	// the v1 object carries the private cidrs as they were written
+	setAnnotation(&dst.ObjectMeta, PrivateCidrsAnnotation, "")
+	setAnnotation(&dst.ObjectMeta, vpngwv2.UnconvertedCidrsAnnotation, "")
+	return nil
+}
+
+// restorePrivateCidrs returns the private cidrs written by the v1 client if the traffic selectors were not changed since,
+// otherwise formats the traffic selectors
+func restorePrivateCidrs(src *vpngwv2.IpsecConn, selectors []vpngwv2.TrafficSelector, get func(privateCidrs) string) string {
+	formatted := vpngwv2.FormatTrafficSelectors(selectors)
+	data, ok := src.Annotations[PrivateCidrsAnnotation]
+	if !ok {
+		return formatted
+	}
+	saved := privateCidrs{}
+	if err := json.Unmarshal([]byte(data), &saved); err != nil {
+		return formatted
+	}
+	normalized, _ := vpngwv2.NormalizeTrafficSelectors(get(saved))
+	if vpngwv2.FormatTrafficSelectors(normalized) != formatted {
+		return formatted
+	}
+	return get(saved)
+}
@@ -0,0 +1,154 @@
+package v1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+func newTestIpsecConn(local, remote string) *IpsecConn {
+	return &IpsecConn{
+		ObjectMeta: metav1.ObjectMeta{Name: "moon", Namespace: "default"},
+		Spec: IpsecConnSpec{
+			VpnGw:              "gw",
+			Auth:               "psk",
+			PskSecret:          "moon-psk",
+			IkeVersion:         "2",
+			Proposals:          "default",
+			LocalCN:            "sun",
+			LocalPublicIp:      "192.0.2.1",
+			LocalPrivateCidrs:  local,
+			RemoteCN:           "moon",
+			RemotePublicIp:     "192.0.2.2",
+			RemotePrivateCidrs: remote,
+		},
+	}
+}
+
+func TestIpsecConnRoundTrip(t *testing.T) {
+	tests := []struct {
+		name        string
+		local       string
+		remote      string
+		wantLocal   []vpngwv2.TrafficSelector
+		wantRemote  []vpngwv2.TrafficSelector
+		unconverted string
+		saved       bool
+	}{
+		{
+			name:       "canonical cidrs",
+			local:      "10.0.0.0/24,10.1.0.0/24",
+			remote:     "10.2.0.0/24[tcp/443]",
+			wantLocal:  []vpngwv2.TrafficSelector{{Cidr: "10.0.0.0/24"}, {Cidr: "10.1.0.0/24"}},
+			wantRemote: []vpngwv2.TrafficSelector{{Cidr: "10.2.0.0/24", Protocol: "tcp", Port: "443"}},
+		},
+		{
+			name:       "hosts and unmasked cidrs",
+			local:      "10.0.0.1, 10.1.0.1/24",
+			remote:     "2001:db8::1",
+			wantLocal:  []vpngwv2.TrafficSelector{{Cidr: "10.0.0.1/32"}, {Cidr: "10.1.0.0/24"}},
+			wantRemote: []vpngwv2.TrafficSelector{{Cidr: "2001:db8::1/128"}},
+			saved:      true,
+		},
+		{
+			name:        "unparseable cidrs",
+			local:       "10.0.0.0/24,foo",
+			remote:      "10.2.0.0/33",
+			wantLocal:   []vpngwv2.TrafficSelector{{Cidr: "10.0.0.0/24"}},
+			wantRemote:  []vpngwv2.TrafficSelector{},
+			unconverted: "foo,10.2.0.0/33",
+			saved:       true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := newTestIpsecConn(tt.local, tt.remote)
+			hub := &vpngwv2.IpsecConn{}
+			if err := src.ConvertTo(hub); err != nil {
+				t.Fatalf("failed to convert to v2: %v", err)
+			}
+			if !reflect.DeepEqual(hub.Spec.LocalPrivateCidrs, tt.wantLocal) || !reflect.DeepEqual(hub.Spec.RemotePrivateCidrs, tt.wantRemote) {
+				t.Errorf("unexpected traffic selectors %v %v", hub.Spec.LocalPrivateCidrs, hub.Spec.RemotePrivateCidrs)
+			}
+			if got := hub.Annotations[vpngwv2.UnconvertedCidrsAnnotation]; got != tt.unconverted {
+				t.Errorf("unconverted cidrs annotation %q, want %q", got, tt.unconverted)
+			}
+			if _, ok := hub.Annotations[PrivateCidrsAnnotation]; ok != tt.saved {
+				t.Errorf("private cidrs annotation saved %v, want %v", ok, tt.saved)
+			}
+
+			dst := &IpsecConn{}
+			if err := dst.ConvertFrom(hub); err != nil {
+				t.Fatalf("failed to convert from v2: %v", err)
+			}
+			if dst.Spec.LocalPrivateCidrs != tt.local || dst.Spec.RemotePrivateCidrs != tt.remote {
+				t.Errorf("v1 client reads %q %q, want %q %q", dst.Spec.LocalPrivateCidrs, dst.Spec.RemotePrivateCidrs, tt.local, tt.remote)
+			}
+			for _, key := range []string{PrivateCidrsAnnotation, vpngwv2.UnconvertedCidrsAnnotation} {
+				if _, ok := dst.Annotations[key]; ok {
+					t.Errorf("annotation %s leaked to v1", key)
+				}
+			}
+		})
+	}
+}
+
+func TestIpsecConnRoundTripAfterV2Update(t *testing.T) {
+	src := newTestIpsecConn("10.0.0.1", "10.2.0.0/24")
+	hub := &vpngwv2.IpsecConn{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatalf("failed to convert to v2: %v", err)
+	}
+	// the saved v1 cidrs are stale once the traffic selectors are changed by a v2 client
+	hub.Spec.LocalPrivateCidrs = []vpngwv2.TrafficSelector{{Cidr: "10.0.1.0/24"}}
+	dst := &IpsecConn{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatalf("failed to convert from v2: %v", err)
+	}
+	if dst.Spec.LocalPrivateCidrs != "10.0.1.0/24" {
+		t.Errorf("v1 client reads %q, want the updated traffic selectors", dst.Spec.LocalPrivateCidrs)
+	}
+}
+
+func TestIpsecConnV2OnlyFields(t *testing.T) {
+	children := []vpngwv2.IpsecChild{{
+		Name:     "web",
+		RemoteTs: []vpngwv2.TrafficSelector{{Cidr: "10.2.0.0/24", Protocol: "tcp", Port: "443"}},
+	}}
+	hub := &vpngwv2.IpsecConn{
+		ObjectMeta: metav1.ObjectMeta{Name: "moon", Namespace: "default"},
+		Spec: vpngwv2.IpsecConnSpec{
+			VpnGw:              "gw",
+			Auth:               "psk",
+			LocalPrivateCidrs:  []vpngwv2.TrafficSelector{{Cidr: "10.0.0.0/24"}},
+			RemotePrivateCidrs: []vpngwv2.TrafficSelector{{Cidr: "10.2.0.0/24"}},
+			Children:           children,
+		},
+	}
+	v1Conn := &IpsecConn{}
+	if err := v1Conn.ConvertFrom(hub); err != nil {
+		t.Fatalf("failed to convert from v2: %v", err)
+	}
+	if _, ok := v1Conn.Annotations[HubSpecAnnotation]; !ok {
+		t.Fatalf("v2 spec is not saved in annotation %s", HubSpecAnnotation)
+	}
+	// a v1 client updates the remote cidrs only
+	v1Conn.Spec.RemotePrivateCidrs = "10.3.0.0/24"
+
+	restored := &vpngwv2.IpsecConn{}
+	if err := v1Conn.ConvertTo(restored); err != nil {
+		t.Fatalf("failed to convert to v2: %v", err)
+	}
+	if !reflect.DeepEqual(restored.Spec.Children, children) {
+		t.Errorf("children %v are lost, want %v", restored.Spec.Children, children)
+	}
+	if want := []vpngwv2.TrafficSelector{{Cidr: "10.3.0.0/24"}}; !reflect.DeepEqual(restored.Spec.RemotePrivateCidrs, want) {
+		t.Errorf("remote private cidrs %v, want %v", restored.Spec.RemotePrivateCidrs, want)
+	}
+	if _, ok := restored.Annotations[HubSpecAnnotation]; ok {
+		t.Errorf("annotation %s leaked to v2", HubSpecAnnotation)
+	}
+}
@@ -34,6 +34,9 @@ type IpsecConnSpec struct {
 	// pubkey uses public key authentication based on a private key associated with a usable certificate. psk uses pre-shared key authentication.
 	// The IKEv1 specific xauth is used for XAuth or Hybrid authentication while the IKEv2 specific eap keyword defines EAP authentication.
 	Auth string `json:"auth"`
+	// psk secret name, the secret should in the same namespace as the ipsec connection
+	// the pre-shared key is stored in the psk key, required if auth is psk
+	PskSecret string `json:"pskSecret,omitempty"`
 	// 0 accepts both IKEv1 and IKEv2, 1 uses IKEv1 aka ISAKMP, 2 uses IKEv2
 	IkeVersion string `json:"ikeVersion"`
 	// A proposal is a set of algorithms.
@@ -56,8 +59,15 @@ type IpsecConnSpec struct {
 	RemotePrivateCidrs string `json:"remotePrivateCidrs"`
 }
 
+// IpsecConnStatus defines the observed state of IpsecConn
+type IpsecConnStatus struct {
+	// Conditions store the status conditions of the ipsec connection
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
 // +kubebuilder:object:root=true
-// +kubebuilder:storageversion
+// +kubebuilder:subresource:status
 // +kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
 // +kubebuilder:printcolumn:name="LocalPublicIp",type=string,JSONPath=`.spec.localPublicIp`
 // +kubebuilder:printcolumn:name="RemotePublicIp",type=string,JSONPath=`.spec.remotePublicIp`
@@ -71,8 +81,8 @@ type IpsecConn struct {
 	metav1.TypeMeta   `json:",inline"`
 	metav1.ObjectMeta `json:"metadata,omitempty"`
 
-	Spec IpsecConnSpec `json:"spec,omitempty"`
-	// Status IpsecConnStatus `json:"status,omitempty"`
+	Spec   IpsecConnSpec   `json:"spec,omitempty"`
+	Status IpsecConnStatus `json:"status,omitempty"`
 }
 
 //+kubebuilder:object:root=true
@@ -0,0 +1,177 @@
+package v1
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	"sigs.k8s.io/controller-runtime/pkg/conversion"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+// ConvertTo converts this VpnGw to the Hub version (v2).
+func (src *VpnGw) ConvertTo(dstRaw conversion.Hub) error {
+	dst := dstRaw.(*vpngwv2.VpnGw)
+	dst.ObjectMeta = src.ObjectMeta
+	// start from the saved v2 spec, so that v2 only fields are kept
+	if _, err := restoreHubSpec(&dst.ObjectMeta, &dst.Spec); err != nil {
+		return fmt.Errorf("failed to restore v2 spec of vpn gw %s: %v", src.Name, err)
+	}
+
+	dst.Spec.Subnet = src.Spec.Subnet
+	dst.Spec.Ip = src.Spec.Ip
+	dst.Spec.Replicas = src.Spec.Replicas
+	dst.Spec.QoSBandwidth = src.Spec.QoSBandwidth
+	if err := convertResource(&dst.Spec.Resources, corev1.ResourceCPU, src.Spec.Cpu); err != nil {
+		return err
+	}
+	if err := convertResource(&dst.Spec.Resources, corev1.ResourceMemory, src.Spec.Memory); err != nil {
+		return err
+	}
+	dst.Spec.NodeSelector = nil
+	if len(src.Spec.Selector) > 0 {
+		dst.Spec.NodeSelector = make(map[string]string, len(src.Spec.Selector))
+		for _, v := range src.Spec.Selector {
+			parts := strings.Split(strings.TrimSpace(v), ":")
+			if len(parts) != 2 {
+				continue
+			}
+			dst.Spec.NodeSelector[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
+		}
+	}
+	dst.Spec.Tolerations = src.Spec.Tolerations
+	dst.Spec.Affinity = nil
+	if src.Spec.Affinity.NodeAffinity != nil ||
+		src.Spec.Affinity.PodAffinity != nil ||
+		src.Spec.Affinity.PodAntiAffinity != nil {
+		affinity := src.Spec.Affinity
+		dst.Spec.Affinity = &affinity
+	}
+
+	dst.Spec.SslVpn.Enabled = src.Spec.EnableSslVpn
+	dst.Spec.SslVpn.Image = src.Spec.SslVpnImage
+	dst.Spec.SslVpn.SslSecret = src.Spec.SslSecret
+	dst.Spec.SslVpn.DhSecret = src.Spec.DhSecret
+	dst.Spec.SslVpn.Cipher = src.Spec.OvpnCipher
+	dst.Spec.SslVpn.Proto = src.Spec.OvpnProto
+	dst.Spec.SslVpn.Port = int32(src.Spec.OvpnPort)
+	dst.Spec.SslVpn.SubnetCidr = src.Spec.OvpnSubnetCidr
+
+	dst.Spec.IpsecVpn.Enabled = src.Spec.EnableIpsecVpn
+	dst.Spec.IpsecVpn.Image = src.Spec.IpsecVpnImage
+	dst.Spec.IpsecVpn.IpsecSecret = src.Spec.IpsecSecret
+
+	// v1 status mirrors the spec, only the observed fields are kept
+	dst.Status.IpsecConnections = src.Status.IpsecConnections
+	dst.Status.PodUID = src.Status.PodUID
+	dst.Status.RestartCount = src.Status.RestartCount
+	dst.Status.LastAppliedTime = src.Status.LastAppliedTime
+	dst.Status.Conditions = src.Status.Conditions
+	return nil
+}
+
+// ConvertFrom converts from the Hub version (v2) to this version.
+func (dst *VpnGw) ConvertFrom(srcRaw conversion.Hub) error {
+	src := srcRaw.(*vpngwv2.VpnGw)
+	dst.ObjectMeta = src.ObjectMeta
+	if err := saveHubSpec(&dst.ObjectMeta, &src.Spec); err != nil {
+		return fmt.Errorf("failed to save v2 spec of vpn gw %s: %v", src.Name, err)
+	}
+
+	dst.Spec.Subnet = src.Spec.Subnet
+	dst.Spec.Ip = src.Spec.Ip
+	dst.Spec.Replicas = src.Spec.Replicas
+	dst.Spec.QoSBandwidth = src.Spec.QoSBandwidth
+	dst.Spec.Cpu = resourceString(src.Spec.Resources, corev1.ResourceCPU)
+	dst.Spec.Memory = resourceString(src.Spec.Resources, corev1.ResourceMemory)
+	dst.Spec.Selector = nil
+	for k, v := range src.Spec.NodeSelector {
+		dst.Spec.Selector = append(dst.Spec.Selector, fmt.Sprintf("%s:%s", k, v))
+	}
+	sort.Strings(dst.Spec.Selector)
+	dst.Spec.Tolerations = src.Spec.Tolerations
+	dst.Spec.Affinity = corev1.Affinity{}
+	if src.Spec.Affinity != nil {
+		dst.Spec.Affinity = *src.Spec.Affinity
+	}
+
+	dst.Spec.EnableSslVpn = src.Spec.SslVpn.Enabled
+	dst.Spec.SslVpnImage = src.Spec.SslVpn.Image
+	dst.Spec.SslSecret = src.Spec.SslVpn.SslSecret
+	dst.Spec.DhSecret = src.Spec.SslVpn.DhSecret
+	dst.Spec.OvpnCipher = src.Spec.SslVpn.Cipher
+	dst.Spec.OvpnProto = src.Spec.SslVpn.Proto
+	dst.Spec.OvpnPort = int(src.Spec.SslVpn.Port)
+	dst.Spec.OvpnSubnetCidr = src.Spec.SslVpn.SubnetCidr
+
+	dst.Spec.EnableIpsecVpn = src.Spec.IpsecVpn.Enabled
+	dst.Spec.IpsecVpnImage = src.Spec.IpsecVpn.Image
+	dst.Spec.IpsecSecret = src.Spec.IpsecVpn.IpsecSecret
+	dst.Spec.IpsecConnections = src.Status.IpsecConnections
+
+	dst.Status.Cpu = dst.Spec.Cpu
+	dst.Status.Memory = dst.Spec.Memory
+	dst.Status.QoSBandwidth = dst.Spec.QoSBandwidth
+	dst.Status.Ip = dst.Spec.Ip
+	dst.Status.Subnet = dst.Spec.Subnet
+	dst.Status.Replicas = dst.Spec.Replicas
+	dst.Status.Selector = dst.Spec.Selector
+	dst.Status.Tolerations = dst.Spec.Tolerations
+	dst.Status.Affinity = dst.Spec.Affinity
+	dst.Status.EnableSslVpn = dst.Spec.EnableSslVpn
+	dst.Status.SslSecret = dst.Spec.SslSecret
+	dst.Status.DhSecret = dst.Spec.DhSecret
+	dst.Status.SslVpnImage = dst.Spec.SslVpnImage
+	dst.Status.OvpnCipher = dst.Spec.OvpnCipher
+	dst.Status.OvpnProto = dst.Spec.OvpnProto
+	dst.Status.OvpnPort = dst.Spec.OvpnPort
+	dst.Status.OvpnSubnetCidr = dst.Spec.OvpnSubnetCidr
+	dst.Status.EnableIpsecVpn = dst.Spec.EnableIpsecVpn
+	dst.Status.IpsecSecret = dst.Spec.IpsecSecret
+	dst.Status.IpsecVpnImage = dst.Spec.IpsecVpnImage
+	dst.Status.IpsecConnections = src.Status.IpsecConnections
+	dst.Status.PodUID = src.Status.PodUID
+	dst.Status.RestartCount = src.Status.RestartCount
+	dst.Status.LastAppliedTime = src.Status.LastAppliedTime
+	dst.Status.Conditions = src.Status.Conditions
+	return nil
+}
+
+// v1 cpu and memory are used as both requests and limits
+func convertResource(resources *corev1.ResourceRequirements, name corev1.ResourceName, value string) error {
+	if value == resourceString(*resources, name) {
+		return nil
+	}
+	if value == "" {
+		delete(resources.Requests, name)
+		delete(resources.Limits, name)
+		return nil
+	}
+	quantity, err := resource.ParseQuantity(value)
+	if err != nil {
+		return fmt.Errorf("invalid %s %q: %v", name, value, err)
+	}
+	if resources.Requests == nil {
+		resources.Requests = corev1.ResourceList{}
+	}
+	if resources.Limits == nil {
+		resources.Limits = corev1.ResourceList{}
+	}
+	resources.Requests[name] = quantity
+	resources.Limits[name] = quantity
+	return nil
+}
+
+// prefer limits, fall back to requests
+func resourceString(resources corev1.ResourceRequirements, name corev1.ResourceName) string {
+	if quantity, ok := resources.Limits[name]; ok {
+		return quantity.String()
+	}
+	if quantity, ok := resources.Requests[name]; ok {
+		return quantity.String()
+	}
+	return ""
+}
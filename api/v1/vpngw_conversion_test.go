@@ -0,0 +1,92 @@
+package v1
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+func newTestVpnGw() *VpnGw {
+	return &VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: VpnGwSpec{
+			Cpu:            "1",
+			Memory:         "1Gi",
+			Selector:       []string{"kubernetes.io/os: linux", "vpn:true"},
+			EnableSslVpn:   true,
+			SslSecret:      "ssl",
+			OvpnCipher:     "AES-256-GCM",
+			OvpnProto:      "udp",
+			OvpnPort:       1194,
+			OvpnSubnetCidr: "10.240.0.0/16",
+			EnableIpsecVpn: true,
+			IpsecSecret:    "ipsec",
+		},
+	}
+}
+
+func TestVpnGwRoundTrip(t *testing.T) {
+	src := newTestVpnGw()
+	hub := &vpngwv2.VpnGw{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatalf("failed to convert to v2: %v", err)
+	}
+	if want := map[string]string{"kubernetes.io/os": "linux", "vpn": "true"}; !reflect.DeepEqual(hub.Spec.NodeSelector, want) {
+		t.Errorf("node selector %v, want %v", hub.Spec.NodeSelector, want)
+	}
+	if hub.Spec.SslVpn.Port != 1194 || hub.Spec.SslVpn.SubnetCidr != "10.240.0.0/16" || hub.Spec.IpsecVpn.IpsecSecret != "ipsec" {
+		t.Errorf("unexpected v2 spec %+v", hub.Spec)
+	}
+
+	dst := &VpnGw{}
+	if err := dst.ConvertFrom(hub); err != nil {
+		t.Fatalf("failed to convert from v2: %v", err)
+	}
+	if dst.Spec.Cpu != "1" || dst.Spec.Memory != "1Gi" {
+		t.Errorf("v1 client reads cpu %q memory %q", dst.Spec.Cpu, dst.Spec.Memory)
+	}
+	if want := []string{"kubernetes.io/os:linux", "vpn:true"}; !reflect.DeepEqual(dst.Spec.Selector, want) {
+		t.Errorf("selector %v, want %v", dst.Spec.Selector, want)
+	}
+	if dst.Spec.OvpnPort != 1194 || dst.Spec.OvpnCipher != "AES-256-GCM" || dst.Spec.IpsecSecret != "ipsec" {
+		t.Errorf("unexpected v1 spec %+v", dst.Spec)
+	}
+}
+
+func TestVpnGwV2OnlyFields(t *testing.T) {
+	src := newTestVpnGw()
+	hub := &vpngwv2.VpnGw{}
+	if err := src.ConvertTo(hub); err != nil {
+		t.Fatalf("failed to convert to v2: %v", err)
+	}
+	hub.Spec.SslVpn.TunnelMode = "full"
+	hub.Spec.SslVpn.DataCiphers = []string{"AES-256-GCM", "CHACHA20-POLY1305"}
+	hub.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.241.0.0/16"}
+	hub.Spec.IpsecVpn.PeerExport = &vpngwv2.IpsecPeerExportSpec{Cidrs: []vpngwv2.TrafficSelector{{Cidr: "10.0.0.0/24"}}}
+
+	v1Gw := &VpnGw{}
+	if err := v1Gw.ConvertFrom(hub); err != nil {
+		t.Fatalf("failed to convert from v2: %v", err)
+	}
+	if _, ok := v1Gw.Annotations[HubSpecAnnotation]; !ok {
+		t.Fatalf("v2 spec is not saved in annotation %s", HubSpecAnnotation)
+	}
+	// a v1 client updates the port only
+	v1Gw.Spec.OvpnPort = 1195
+
+	restored := &vpngwv2.VpnGw{}
+	if err := v1Gw.ConvertTo(restored); err != nil {
+		t.Fatalf("failed to convert to v2: %v", err)
+	}
+	want := hub.Spec.DeepCopy()
+	want.SslVpn.Port = 1195
+	if !reflect.DeepEqual(restored.Spec, *want) {
+		t.Errorf("v2 spec %+v, want %+v", restored.Spec, *want)
+	}
+	if _, ok := restored.Annotations[HubSpecAnnotation]; ok {
+		t.Errorf("annotation %s leaked to v2", HubSpecAnnotation)
+	}
+}
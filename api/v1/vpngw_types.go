@@ -119,6 +119,13 @@ type VpnGwStatus struct {
 	IpsecVpnImage    string              `json:"ipsecVpnImage" patchStrategy:"merge"`
 	IpsecConnections []string            `json:"ipsecConnections,omitempty" patchStrategy:"merge"`
 
+	// vpn gw pod uid which the configuration was last applied to
+	PodUID string `json:"podUID,omitempty" patchStrategy:"merge"`
+	// total restart count of the ssl and ipsec containers when the configuration was last applied
+	RestartCount int32 `json:"restartCount,omitempty" patchStrategy:"merge"`
+	// last time the configuration was applied to the vpn gw pod
+	LastAppliedTime metav1.Time `json:"lastAppliedTime,omitempty" patchStrategy:"merge"`
+
 	// Conditions store the status conditions of the vpn gw instances
 	// +operator-sdk:csv:customresourcedefinitions:type=status
 	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
@@ -126,7 +133,6 @@ type VpnGwStatus struct {
 
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
-//+kubebuilder:storageversion
 //+kubebuilder:printcolumn:name="IP",type=string,JSONPath=`.spec.ip`
 //+kubebuilder:printcolumn:name="PublicIP",type=string,JSONPath=`.spec.publicIp`
 //+kubebuilder:printcolumn:name="Subnet",type=string,JSONPath=`.spec.subnet`
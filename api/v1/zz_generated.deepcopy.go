@@ -33,6 +33,7 @@ func (in *IpsecConn) DeepCopyInto(out *IpsecConn) {
 	out.TypeMeta = in.TypeMeta
 	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
 	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
 }
 
 // DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConn.
@@ -100,6 +101,28 @@ func (in *IpsecConnSpec) DeepCopy() *IpsecConnSpec {
 	return out
 }
 
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecConnStatus) DeepCopyInto(out *IpsecConnStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]metav1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConnStatus.
+func (in *IpsecConnStatus) DeepCopy() *IpsecConnStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecConnStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
 // DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
 func (in *VpnGw) DeepCopyInto(out *VpnGw) {
 	*out = *in
@@ -213,6 +236,7 @@ func (in *VpnGwStatus) DeepCopyInto(out *VpnGwStatus) {
 		*out = make([]string, len(*in))
 		copy(*out, *in)
 	}
+	in.LastAppliedTime.DeepCopyInto(&out.LastAppliedTime)
 	if in.Conditions != nil {
 		in, out := &in.Conditions, &out.Conditions
 		*out = make([]metav1.Condition, len(*in))
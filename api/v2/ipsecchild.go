@@ -0,0 +1,109 @@
+package v2
+
+import (
+	"fmt"
+	"regexp"
+)
+
+const (
+	// DefaultIpsecChildName is the child used if the ipsec connection declares no children
+	DefaultIpsecChildName = "net-net"
+
+	DefaultIpsecChildStartAction = "trap"
+	DefaultIpsecChildDpdAction   = "restart"
+	DefaultIpsecChildMode        = "tunnel"
+)
+
+// strongSwan time values, eg: 30, 30s, 10m, 1h, 1d
+var swanctlTimeRegexp = regexp.MustCompile(`^[0-9]+[smhd]?$`)
+
+// ValidateSwanctlTime checks the value is a strongSwan time, seconds if the unit is omitted
+func ValidateSwanctlTime(name, value string) error {
+	if value == "" || swanctlTimeRegexp.MatchString(value) {
+		return nil
+	}
+	return fmt.Errorf("invalid %s %q, should be a number with optional unit s, m, h or d", name, value)
+}
+
+// EffectiveChildren returns the children of the ipsec connection with defaults applied,
+// settings not set by the child are inherited from the connection
+func (spec IpsecConnSpec) EffectiveChildren() []IpsecChild {
+	children := spec.Children
+	if len(children) == 0 {
+		children = []IpsecChild{{Name: DefaultIpsecChildName}}
+	}
+	res := make([]IpsecChild, 0, len(children))
+	for _, child := range children {
+		child := *child.DeepCopy()
+		if len(child.LocalTs) == 0 {
+			child.LocalTs = spec.LocalPrivateCidrs
+		}
+		if len(child.RemoteTs) == 0 {
+			child.RemoteTs = spec.RemotePrivateCidrs
+		}
+		if child.EspProposals == "" {
+			child.EspProposals = spec.EspProposals
+		}
+		if child.RekeyTime == "" {
+			child.RekeyTime = spec.ChildRekeyTime
+		}
+		if child.StartAction == "" {
+			child.StartAction = spec.StartAction
+		}
+		if child.StartAction == "" {
+			child.StartAction = DefaultIpsecChildStartAction
+		}
+		if child.CloseAction == "" {
+			child.CloseAction = spec.CloseAction
+		}
+		if child.DpdAction == "" {
+			child.DpdAction = spec.DpdAction
+		}
+		if child.DpdAction == "" {
+			child.DpdAction = DefaultIpsecChildDpdAction
+		}
+		if child.Mode == "" {
+			child.Mode = DefaultIpsecChildMode
+		}
+		res = append(res, child)
+	}
+	return res
+}
+
+// Validate checks the traffic selectors, actions and times of the child
+func (child IpsecChild) Validate() error {
+	if child.Name == "" {
+		return fmt.Errorf("ipsec child name is required")
+	}
+	for _, ts := range child.LocalTs {
+		if err := ts.Validate(); err != nil {
+			return fmt.Errorf("invalid local ts of child %s: %v", child.Name, err)
+		}
+	}
+	for _, ts := range child.RemoteTs {
+		if err := ts.Validate(); err != nil {
+			return fmt.Errorf("invalid remote ts of child %s: %v", child.Name, err)
+		}
+	}
+	switch child.StartAction {
+	case "", "none", "trap", "start":
+	default:
+		return fmt.Errorf("invalid start action %q of child %s", child.StartAction, child.Name)
+	}
+	switch child.CloseAction {
+	case "", "none", "clear", "hold", "restart":
+	default:
+		return fmt.Errorf("invalid close action %q of child %s", child.CloseAction, child.Name)
+	}
+	switch child.DpdAction {
+	case "", "clear", "hold", "restart":
+	default:
+		return fmt.Errorf("invalid dpd action %q of child %s", child.DpdAction, child.Name)
+	}
+	switch child.Mode {
+	case "", "tunnel", "transport":
+	default:
+		return fmt.Errorf("invalid mode %q of child %s", child.Mode, child.Name)
+	}
+	return ValidateSwanctlTime("rekey time of child "+child.Name, child.RekeyTime)
+}
@@ -0,0 +1,203 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// IpsecConnPolicyCompliant is true if the proposals and ike version of the ipsec connection satisfy the algorithm policy
+	IpsecConnPolicyCompliant = "PolicyCompliant"
+
+	// UnconvertedCidrsAnnotation keeps the private cidrs written by v1 clients which could not be converted
+	// into traffic selectors, comma separated, the connection is not rendered until they are fixed
+	UnconvertedCidrsAnnotation = "vpn-gw.kube-combo.com/unconverted-cidrs"
+)
+
+// TrafficSelector is a cidr with optional protocol and port selectors, rendered into local_ts or remote_ts
+// reference to: https://docs.strongswan.org/docs/5.9/swanctl/swanctlConf.html#_connections_conn_children_child_local_ts
+type TrafficSelector struct {
+	// cidr, eg: 10.0.0.0/24
+	Cidr string `json:"cidr"`
+	// ip protocol, tcp, udp, sctp, icmp, icmpv6 or protocol number, all protocols if empty
+	Protocol string `json:"protocol,omitempty"`
+	// port or port range, eg: 443 or 1024-65535, all ports if empty
+	// only tcp, udp and sctp support port
+	Port string `json:"port,omitempty"`
+}
+
+// IpsecChild is a CHILD_SA negotiated within the IKE SA of the ipsec connection
+// reference to: https://docs.strongswan.org/docs/5.9/swanctl/swanctlConf.html#_connections_conn_children
+type IpsecChild struct {
+	// child name, unique in the ipsec connection
+	// +kubebuilder:validation:Pattern=`^[a-zA-Z0-9]([-_.a-zA-Z0-9]*[a-zA-Z0-9])?$`
+	Name string `json:"name"`
+	// local traffic selectors, use the local private cidrs of the connection if empty
+	LocalTs []TrafficSelector `json:"localTs,omitempty"`
+	// remote traffic selectors, use the remote private cidrs of the connection if empty
+	RemoteTs []TrafficSelector `json:"remoteTs,omitempty"`
+	// esp proposals of the child, strongSwan uses its default esp proposals if empty
+	EspProposals string `json:"espProposals,omitempty"`
+	// action to perform after loading the configuration, trap if empty
+	// +kubebuilder:validation:Enum=none;trap;start
+	StartAction string `json:"startAction,omitempty"`
+	// action to perform after the child is closed by the peer, none if empty
+	// +kubebuilder:validation:Enum=none;clear;hold;restart
+	CloseAction string `json:"closeAction,omitempty"`
+	// action to perform on dpd timeout, restart if empty
+	// +kubebuilder:validation:Enum=clear;hold;restart
+	DpdAction string `json:"dpdAction,omitempty"`
+	// time to schedule the child rekeying, eg: 1h, strongSwan uses 1h if empty
+	RekeyTime string `json:"rekeyTime,omitempty"`
+	// ipsec mode of the child, tunnel if empty
+	// +kubebuilder:validation:Enum=tunnel;transport
+	Mode string `json:"mode,omitempty"`
+}
+
+// IpsecRemoteCa references the pem encoded certificate which the remote peer is trusted by
+type IpsecRemoteCa struct {
+	// kind of the object holding the certificate, in the same namespace as the ipsec connection
+	// +kubebuilder:validation:Enum=Secret;ConfigMap
+	Kind string `json:"kind"`
+	// name of the object holding the certificate
+	Name string `json:"name"`
+	// key of the certificate, ca.crt if empty
+	Key string `json:"key,omitempty"`
+	// the certificate is the pinned remote peer certificate rather than its ca
+	Pinned bool `json:"pinned,omitempty"`
+}
+
+// IpsecConnSpec defines the desired state of IpsecConn
+type IpsecConnSpec struct {
+	// reference to: https://docs.strongswan.org/docs/5.9/swanctl/swanctlConf.html#_connections
+	// the connection will set into this vpn gw pod
+	VpnGw string `json:"vpnGw"`
+	// Authentication to perform locally.
+	// pubkey uses public key authentication based on a private key associated with a usable certificate. psk uses pre-shared key authentication.
+	// The IKEv1 specific xauth is used for XAuth or Hybrid authentication while the IKEv2 specific eap keyword defines EAP authentication.
+	Auth string `json:"auth"`
+	// psk secret name, the secret should in the same namespace as the ipsec connection
+	// the pre-shared key is stored in the psk key, required if auth is psk
+	PskSecret string `json:"pskSecret,omitempty"`
+	// 0 accepts both IKEv1 and IKEv2, 1 uses IKEv1 aka ISAKMP, 2 uses IKEv2
+	IkeVersion string `json:"ikeVersion"`
+	// IKE proposals, a proposal is a set of algorithms.
+	// Algorithm keywords get separated using dashes. Multiple proposals may be separated by commas, eg: aes256-sha256-modp2048.
+	// The special value default adds a default proposal of supported algorithms considered safe and is usually a good choice for interoperability. [default]
+	IkeProposals string `json:"ikeProposals"`
+	// esp proposals of the children which do not set their own, eg: aes256gcm16-modp2048, strongSwan uses its default esp proposals if empty
+	EspProposals string `json:"espProposals,omitempty"`
+	// CN is defined in x509 certificate
+	LocalCN string `json:"localCN"`
+	// current public ipsec vpn gw ip
+	LocalPublicIp string `json:"localPublicIp"`
+	// local private cidrs with optional protocol and port selectors
+	// +kubebuilder:validation:MinItems=1
+	LocalPrivateCidrs []TrafficSelector `json:"localPrivateCidrs"`
+
+	RemoteCN string `json:"remoteCN"`
+	// remote public ipsec vpn gw ip
+	RemotePublicIp string `json:"remotePublicIp"`
+	// remote private cidrs with optional protocol and port selectors
+	// +kubebuilder:validation:MinItems=1
+	RemotePrivateCidrs []TrafficSelector `json:"remotePrivateCidrs"`
+
+	// 1:1 NETMAP translation of the local private cidr, for sites whose cidrs overlap with the vpc,
+	// the remote site sees the local private cidr as this cidr, which is advertised as local traffic selector.
+	// only one local private cidr is supported, and the prefix length should be the same, eg: 10.0.1.0/24 -> 172.16.1.0/24
+	TranslatedLocalCidr string `json:"translatedLocalCidr,omitempty"`
+	// 1:1 NETMAP translation of the remote private cidr, the vpc accesses the remote private cidr via this cidr.
+	// only one remote private cidr is supported, and the prefix length should be the same, eg: 10.0.1.0/24 -> 172.17.1.0/24
+	TranslatedRemoteCidr string `json:"translatedRemoteCidr,omitempty"`
+	// remote peer ca certificate or pinned remote peer certificate, trusted by this connection only,
+	// the remote peer should be signed by the ipsec vpn ca if empty, pubkey auth only
+	RemoteCa *IpsecRemoteCa `json:"remoteCa,omitempty"`
+
+	// interval to check the liveness of the peer, eg: 30s, dpd is disabled if empty
+	DpdDelay string `json:"dpdDelay,omitempty"`
+	// IKEv1 only, time after which the peer is considered dead if it does not respond
+	DpdTimeout string `json:"dpdTimeout,omitempty"`
+	// dpd action of the children which do not set their own, restart if empty
+	// +kubebuilder:validation:Enum=clear;hold;restart
+	DpdAction string `json:"dpdAction,omitempty"`
+	// time to schedule the IKE rekeying, eg: 4h, strongSwan uses 4h if empty
+	RekeyTime string `json:"rekeyTime,omitempty"`
+	// time to schedule the IKE reauthentication, eg: 24h, disabled if empty
+	ReauthTime string `json:"reauthTime,omitempty"`
+	// hard IKE_SA lifetime if rekeying or reauthentication fails, strongSwan uses 10% of the longer one if empty
+	OverTime string `json:"overTime,omitempty"`
+	// rekey time of the children which do not set their own, eg: 1h
+	ChildRekeyTime string `json:"childRekeyTime,omitempty"`
+	// start action of the children which do not set their own, trap if empty
+	// +kubebuilder:validation:Enum=none;trap;start
+	StartAction string `json:"startAction,omitempty"`
+	// close action of the children which do not set their own, none if empty
+	// +kubebuilder:validation:Enum=none;clear;hold;restart
+	CloseAction string `json:"closeAction,omitempty"`
+	// number of retransmission sequences to perform during initial connect, 0 means retry forever, strongSwan uses 1 if empty
+	// +kubebuilder:validation:Minimum=0
+	Keyingtries *int32 `json:"keyingtries,omitempty"`
+	// IKEv2 MOBIKE, strongSwan enables it if empty
+	Mobike *bool `json:"mobike,omitempty"`
+
+	// children negotiated within the IKE SA, each with its own traffic selectors
+	// a single net-net child between the local and remote private cidrs is used if empty
+	// +listType=map
+	// +listMapKey=name
+	Children []IpsecChild `json:"children,omitempty"`
+}
+
+// IpsecConnStatus defines the observed state of IpsecConn
+type IpsecConnStatus struct {
+	// Conditions store the status conditions of the ipsec connection, eg: PolicyCompliant
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+// +kubebuilder:object:root=true
+// +kubebuilder:subresource:status
+// +kubebuilder:storageversion
+// +kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
+// +kubebuilder:printcolumn:name="LocalPublicIp",type=string,JSONPath=`.spec.localPublicIp`
+// +kubebuilder:printcolumn:name="RemotePublicIp",type=string,JSONPath=`.spec.remotePublicIp`
+// +kubebuilder:printcolumn:name="LocalPrivateCidrs",type=string,JSONPath=`.spec.localPrivateCidrs[*].cidr`
+// +kubebuilder:printcolumn:name="RemotePrivateCidrs",type=string,JSONPath=`.spec.remotePrivateCidrs[*].cidr`
+// +kubebuilder:printcolumn:name="LocalCN",type=string,JSONPath=`.spec.localCN`
+// +kubebuilder:printcolumn:name="RemoteCN",type=string,JSONPath=`.spec.remoteCN`
+
+// IpsecConn is the Schema for the ipsecconns API
+type IpsecConn struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpsecConnSpec   `json:"spec,omitempty"`
+	Status IpsecConnStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// IpsecConnList contains a list of IpsecConn
+type IpsecConnList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpsecConn `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpsecConn{}, &IpsecConnList{})
+}
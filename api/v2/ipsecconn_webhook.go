@@ -0,0 +1,112 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	"fmt"
+	"net/netip"
+	"regexp"
+
+	"k8s.io/apimachinery/pkg/api/equality"
+	"k8s.io/apimachinery/pkg/runtime"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/webhook"
+)
+
+// the cns are rendered into swanctl.conf as the ids and the remote addresses, and into /etc/hosts as the host names
+var ipsecCNRegexp = regexp.MustCompile(`^[A-Za-z0-9]([-_.A-Za-z0-9]*[A-Za-z0-9])?$`)
+
+// SetupWebhookWithManager registers the conversion and validating webhooks of IpsecConn
+func (r *IpsecConn) SetupWebhookWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewWebhookManagedBy(mgr).
+		For(r).
+		Complete()
+}
+
+//+kubebuilder:webhook:path=/validate-vpn-gw-kube-combo-com-v2-ipsecconn,mutating=false,failurePolicy=fail,sideEffects=None,groups=vpn-gw.kube-combo.com,resources=ipsecconns,verbs=create;update,versions=v2,name=vipsecconn.kb.io,admissionReviewVersions=v1
+
+var _ webhook.Validator = &IpsecConn{}
+
+// ValidateCreate rejects the ipsec connection with invalid endpoints or traffic selectors
+func (r *IpsecConn) ValidateCreate() error {
+	return r.validate()
+}
+
+// ValidateUpdate validates the endpoints and the traffic selectors once the spec changes,
+// so that the stored connections converted from v1 could still be updated, eg: labels and finalizers
+func (r *IpsecConn) ValidateUpdate(old runtime.Object) error {
+	if oldConn, ok := old.(*IpsecConn); ok && equality.Semantic.DeepEqual(oldConn.Spec, r.Spec) {
+		return nil
+	}
+	return r.validate()
+}
+
+// ValidateDelete allows deleting any ipsec connection
+func (r *IpsecConn) ValidateDelete() error {
+	return nil
+}
+
+func (r *IpsecConn) validate() error {
+	if err := r.Spec.ValidateEndpoints(); err != nil {
+		return err
+	}
+	return r.validateTrafficSelectors()
+}
+
+// ValidateEndpoints validates the public ips and the cns of both ends,
+// they are written into swanctl.conf and /etc/hosts as they are
+func (s *IpsecConnSpec) ValidateEndpoints() error {
+	for _, ip := range []struct{ name, value string }{
+		{"local public ip", s.LocalPublicIp},
+		{"remote public ip", s.RemotePublicIp},
+	} {
+		if _, err := netip.ParseAddr(ip.value); err != nil {
+			return fmt.Errorf("%s %q should be an ip address", ip.name, ip.value)
+		}
+	}
+	for _, cn := range []struct{ name, value string }{
+		{"local cn", s.LocalCN},
+		{"remote cn", s.RemoteCN},
+	} {
+		if len(cn.value) > 253 || !ipsecCNRegexp.MatchString(cn.value) {
+			return fmt.Errorf("%s %q should be a domain name of letters, digits, '-', '_' and '.'", cn.name, cn.value)
+		}
+	}
+	return nil
+}
+
+func (r *IpsecConn) validateTrafficSelectors() error {
+	if cidrs := r.Annotations[UnconvertedCidrsAnnotation]; cidrs != "" {
+		return fmt.Errorf("private cidrs %s are invalid", cidrs)
+	}
+	for _, ts := range r.Spec.LocalPrivateCidrs {
+		if err := ts.Validate(); err != nil {
+			return fmt.Errorf("invalid local private cidrs: %v", err)
+		}
+	}
+	for _, ts := range r.Spec.RemotePrivateCidrs {
+		if err := ts.Validate(); err != nil {
+			return fmt.Errorf("invalid remote private cidrs: %v", err)
+		}
+	}
+	for _, child := range r.Spec.Children {
+		if err := child.Validate(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package v2
+
+import "testing"
+
+func TestValidateEndpoints(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(s *IpsecConnSpec)
+		valid  bool
+	}{
+		{"valid", func(s *IpsecConnSpec) {}, true},
+		{"ipv6 public ip", func(s *IpsecConnSpec) { s.RemotePublicIp = "2001:db8::1" }, true},
+		{"empty public ip", func(s *IpsecConnSpec) { s.LocalPublicIp = "" }, false},
+		{"host name public ip", func(s *IpsecConnSpec) { s.RemotePublicIp = "moon.example.com" }, false},
+		{"public ip with new line", func(s *IpsecConnSpec) { s.RemotePublicIp = "192.0.2.2\n10.0.0.1 evil" }, false},
+		{"cn with new line", func(s *IpsecConnSpec) { s.RemoteCN = "moon\n}" }, false},
+		{"cn with brace", func(s *IpsecConnSpec) { s.LocalCN = "sun}" }, false},
+		{"cn with space", func(s *IpsecConnSpec) { s.LocalCN = "sun moon" }, false},
+		{"cn ends with dot", func(s *IpsecConnSpec) { s.LocalCN = "sun." }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spec := &IpsecConnSpec{
+				LocalCN:        "sun.example.com",
+				LocalPublicIp:  "192.0.2.1",
+				RemoteCN:       "moon_1.example.com",
+				RemotePublicIp: "192.0.2.2",
+			}
+			tt.modify(spec)
+			err := spec.ValidateEndpoints()
+			if tt.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected invalid")
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	IpsecTopologyMesh     = "mesh"
+	IpsecTopologyHubSpoke = "hub-spoke"
+)
+
+// IpsecTopologySite is a site of the topology, a vpn gw of this cluster or an external peer
+type IpsecTopologySite struct {
+	// site name, unique in the topology
+	// +kubebuilder:validation:Pattern=`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`
+	Name string `json:"name"`
+	// vpn gw in the same namespace as the topology, ipsec connections are generated for vpn gw sites only
+	// the site is an external peer if empty
+	VpnGw string `json:"vpnGw,omitempty"`
+	// public ip of the site, use the public endpoint ip of the vpn gw if empty
+	PublicIp string `json:"publicIp,omitempty"`
+	// CN is defined in x509 certificate, or the psk identity of the site
+	CN string `json:"cn"`
+	// private cidrs of the site
+	// +kubebuilder:validation:MinItems=1
+	Cidrs []TrafficSelector `json:"cidrs"`
+}
+
+// IpsecTopologySpec defines the desired state of IpsecTopology
+type IpsecTopologySpec struct {
+	// mesh connects every pair of sites, hub-spoke connects every spoke to the hub only,
+	// spokes reach each other through the hub
+	// +kubebuilder:validation:Enum=mesh;hub-spoke
+	Mode string `json:"mode"`
+	// hub site name, required if mode is hub-spoke
+	Hub string `json:"hub,omitempty"`
+	// sites of the topology
+	// +kubebuilder:validation:MinItems=2
+	// +listType=map
+	// +listMapKey=name
+	Sites []IpsecTopologySite `json:"sites"`
+
+	// settings of the generated ipsec connections
+	// psk or pubkey
+	// +kubebuilder:validation:Enum=psk;pubkey
+	Auth string `json:"auth"`
+	// psk secret name shared by the generated ipsec connections, required if auth is psk
+	PskSecret string `json:"pskSecret,omitempty"`
+	// ike version of the generated ipsec connections, 2 if empty
+	IkeVersion string `json:"ikeVersion,omitempty"`
+	// ike proposals of the generated ipsec connections, default if empty
+	IkeProposals string `json:"ikeProposals,omitempty"`
+	// esp proposals of the generated ipsec connections
+	EspProposals string `json:"espProposals,omitempty"`
+}
+
+// IpsecTopologyStatus defines the observed state of IpsecTopology
+type IpsecTopologyStatus struct {
+	// generation of the topology which the ipsec connections were last generated from
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// generated ipsec connections
+	Connections []string `json:"connections,omitempty"`
+
+	// Conditions store the status conditions of the topology
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="Mode",type=string,JSONPath=`.spec.mode`
+//+kubebuilder:printcolumn:name="Hub",type=string,JSONPath=`.spec.hub`
+//+kubebuilder:printcolumn:name="Sites",type=string,JSONPath=`.spec.sites[*].name`
+
+// IpsecTopology is the Schema for the ipsectopologies API
+type IpsecTopology struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   IpsecTopologySpec   `json:"spec,omitempty"`
+	Status IpsecTopologyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// IpsecTopologyList contains a list of IpsecTopology
+type IpsecTopologyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []IpsecTopology `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&IpsecTopology{}, &IpsecTopologyList{})
+}
@@ -0,0 +1,106 @@
+package v2
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// DefaultProposal adds the default proposal of strongSwan, which only contains algorithms considered safe
+const DefaultProposal = "default"
+
+// strongSwan algorithm keywords
+// reference to: https://docs.strongswan.org/docs/5.9/config/IKEv2CipherSuites.html
+var proposalKeywordRegexps = []*regexp.Regexp{
+	// encryption and aead algorithms, the icv length of ccm and gcm is 16 bytes if omitted
+	regexp.MustCompile(`^(aes(128|192|256)?(ctr|ccm(8|12|16|64|96|128)?|gcm(8|12|16|64|96|128)?)?|3des|des|blowfish(128|192|256)?|cast128|camellia(128|192|256)?(ctr|ccm(8|12|16|64|96|128)?)?|(serpent|twofish)(128|192|256)?|chacha20poly1305|null)$`),
+	// integrity algorithms, sha is an alias of sha1
+	regexp.MustCompile(`^(md5(_128)?|sha|sha1(_160)?|sha(256|384|512)(_96)?|sha2_(256|384|512)(_96)?|aesxcbc|aescmac|aes(128|192|256)gmac)$`),
+	// pseudo random functions
+	regexp.MustCompile(`^prf(md5|sha1|sha256|sha384|sha512|aesxcbc|aescmac)$`),
+	// diffie hellman groups
+	regexp.MustCompile(`^(modp(768|1024|1536|2048|3072|4096|6144|8192)|modp1024s160|modp2048s224|modp2048s256|ecp(192|224|256|384|521)|ecp(224|256|384|512)bp|curve25519|x25519|curve448|x448)$`),
+	// extended sequence numbers
+	regexp.MustCompile(`^(esn|noesn)$`),
+}
+
+// aliases of the algorithm keywords
+var proposalKeywordAliases = map[string]string{
+	"sha":      "sha1",
+	"sha2_256": "sha256",
+	"sha2_384": "sha384",
+	"sha2_512": "sha512",
+	"x25519":   "curve25519",
+	"x448":     "curve448",
+}
+
+// block ciphers with optional key length, mode and icv length, eg: aes, aes256gcm, aes128ccm64
+var cipherKeywordRegexp = regexp.MustCompile(`^(aes|camellia|blowfish|serpent|twofish)(128|192|256)?(ctr|ccm|gcm)?(8|12|16|64|96|128)?$`)
+
+// icv lengths in bits of ccm and gcm
+var icvBitsToBytes = map[string]string{"64": "8", "96": "12", "128": "16"}
+
+// CanonicalProposalKeyword resolves the aliases of the algorithm keyword,
+// eg: aes is aes128, aes128gcm is aes128gcm16 and sha is sha1
+func CanonicalProposalKeyword(keyword string) string {
+	keyword = strings.ToLower(keyword)
+	if alias, ok := proposalKeywordAliases[keyword]; ok {
+		return alias
+	}
+	if strings.HasPrefix(keyword, "sha2_") {
+		return "sha" + strings.TrimPrefix(keyword, "sha2_")
+	}
+	m := cipherKeywordRegexp.FindStringSubmatch(keyword)
+	if m == nil {
+		return keyword
+	}
+	name, bits, mode, icv := m[1], m[2], m[3], m[4]
+	if bits == "" {
+		bits = "128"
+	}
+	switch mode {
+	case "", "ctr":
+		if icv != "" {
+			return keyword
+		}
+	default:
+		if icv == "" {
+			icv = "16"
+		} else if bytes, ok := icvBitsToBytes[icv]; ok {
+			icv = bytes
+		}
+	}
+	return name + bits + mode + icv
+}
+
+// ParseProposals parses comma separated proposals into the algorithm keywords of each proposal
+func ParseProposals(s string) ([][]string, error) {
+	proposals := [][]string{}
+	for _, proposal := range strings.Split(s, ",") {
+		proposal = strings.ToLower(strings.TrimSpace(proposal))
+		if proposal == "" {
+			continue
+		}
+		if proposal == DefaultProposal {
+			proposals = append(proposals, []string{DefaultProposal})
+			continue
+		}
+		keywords := strings.Split(proposal, "-")
+		for _, keyword := range keywords {
+			if !isProposalKeyword(keyword) {
+				return nil, fmt.Errorf("unknown algorithm %q in proposal %s", keyword, proposal)
+			}
+		}
+		proposals = append(proposals, keywords)
+	}
+	return proposals, nil
+}
+
+func isProposalKeyword(keyword string) bool {
+	for _, re := range proposalKeywordRegexps {
+		if re.MatchString(keyword) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,109 @@
+package v2
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestParseProposals(t *testing.T) {
+	tests := []struct {
+		name      string
+		proposals string
+		want      [][]string
+		wantErr   bool
+	}{
+		{
+			name:      "empty",
+			proposals: "",
+			want:      [][]string{},
+		},
+		{
+			name:      "default",
+			proposals: "default",
+			want:      [][]string{{DefaultProposal}},
+		},
+		{
+			name:      "ike proposal",
+			proposals: "aes256-sha256-modp2048",
+			want:      [][]string{{"aes256", "sha256", "modp2048"}},
+		},
+		{
+			name:      "aead with icv length",
+			proposals: "aes256gcm16-prfsha384-ecp384",
+			want:      [][]string{{"aes256gcm16", "prfsha384", "ecp384"}},
+		},
+		{
+			name:      "aead without icv length",
+			proposals: "aes128gcm-x25519,aes256ccm-modp3072",
+			want:      [][]string{{"aes128gcm", "x25519"}, {"aes256ccm", "modp3072"}},
+		},
+		{
+			name:      "sha alias of sha1",
+			proposals: "3des-sha-modp1024",
+			want:      [][]string{{"3des", "sha", "modp1024"}},
+		},
+		{
+			name:      "esp with esn",
+			proposals: "AES128-SHA2_256_96-ESN, chacha20poly1305-noesn",
+			want:      [][]string{{"aes128", "sha2_256_96", "esn"}, {"chacha20poly1305", "noesn"}},
+		},
+		{
+			name:      "camellia and bp curves",
+			proposals: "camellia256ccm12-ecp512bp",
+			want:      [][]string{{"camellia256ccm12", "ecp512bp"}},
+		},
+		{
+			name:      "unknown algorithm",
+			proposals: "aes256-sha3-modp2048",
+			wantErr:   true,
+		},
+		{
+			name:      "invalid icv length",
+			proposals: "aes128gcm10",
+			wantErr:   true,
+		},
+		{
+			name:      "empty keyword",
+			proposals: "aes256--modp2048",
+			wantErr:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseProposals(tt.proposals)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseProposals(%q) error = %v, wantErr %v", tt.proposals, err, tt.wantErr)
+			}
+			if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseProposals(%q) = %v, want %v", tt.proposals, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCanonicalProposalKeyword(t *testing.T) {
+	tests := []struct {
+		keyword string
+		want    string
+	}{
+		{"aes", "aes128"},
+		{"AES256", "aes256"},
+		{"aes128gcm", "aes128gcm16"},
+		{"aes256gcm128", "aes256gcm16"},
+		{"aes128ccm64", "aes128ccm8"},
+		{"aes192ctr", "aes192ctr"},
+		{"camellia", "camellia128"},
+		{"blowfish", "blowfish128"},
+		{"sha", "sha1"},
+		{"sha2_256", "sha256"},
+		{"sha2_384_96", "sha384_96"},
+		{"x25519", "curve25519"},
+		{"aes128gmac", "aes128gmac"},
+		{"modp2048", "modp2048"},
+	}
+	for _, tt := range tests {
+		if got := CanonicalProposalKeyword(tt.keyword); got != tt.want {
+			t.Errorf("CanonicalProposalKeyword(%q) = %q, want %q", tt.keyword, got, tt.want)
+		}
+	}
+}
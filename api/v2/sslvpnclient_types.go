@@ -0,0 +1,103 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// SslVpnClientSpec defines the desired state of SslVpnClient
+type SslVpnClientSpec struct {
+	// vpn gw in the same namespace as the client
+	VpnGw string `json:"vpnGw"`
+	// CN is the common name of the client certificate, the client name if empty
+	// +kubebuilder:validation:Pattern=`^[-_a-zA-Z0-9][-._a-zA-Z0-9]*$`
+	CN string `json:"cn,omitempty"`
+	// groups of the client, VpnAccessPolicy matches the clients by groups
+	Groups []string `json:"groups,omitempty"`
+	// static virtual ip of the client, it should be in the upper half of the vpn gw ssl vpn subnet cidr,
+	// the lower half is allocated dynamically, eg: 10.240.128.10 of 10.240.0.0/16
+	Ip string `json:"ip,omitempty"`
+	// totp second factor of the client, required if the vpn gw ssl vpn requires totp
+	Totp *SslVpnTotpSpec `json:"totp,omitempty"`
+	// rate limits of the client, it overrides the bandwidth of the VpnAccessPolicy matching the client
+	Bandwidth *SslVpnBandwidth `json:"bandwidth,omitempty"`
+}
+
+// SslVpnBandwidth defines the rate limits of a ssl vpn client in Mbps, unlimited if empty
+type SslVpnBandwidth struct {
+	// rate of the traffic from the client
+	// +kubebuilder:validation:Minimum=1
+	Upload int32 `json:"upload,omitempty"`
+	// rate of the traffic to the client
+	// +kubebuilder:validation:Minimum=1
+	Download int32 `json:"download,omitempty"`
+}
+
+// SslVpnTotpSpec defines the totp key of the client
+type SslVpnTotpSpec struct {
+	// totp secret name, the secret should in the same namespace as the client
+	// the totp key is the base32 encoded totp key of the secret, generated by the operator if the secret does not exist
+	Secret string `json:"secret"`
+	// issuer shown by the authenticator app, the vpn gw name if empty
+	Issuer string `json:"issuer,omitempty"`
+}
+
+// SslVpnClientStatus defines the observed state of SslVpnClient
+type SslVpnClientStatus struct {
+	// common name of the client certificate
+	CN string `json:"cn,omitempty"`
+	// groups of the client, VpnAccessPolicy matches the clients by groups
+	Groups []string `json:"groups,omitempty"`
+	// static virtual ip of the client
+	Ip string `json:"ip,omitempty"`
+	// client profile secret, the totp enrollment uri is in it
+	ProfileSecret string `json:"profileSecret,omitempty"`
+
+	// Conditions store the status conditions of the client
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
+//+kubebuilder:printcolumn:name="CN",type=string,JSONPath=`.status.cn`
+//+kubebuilder:printcolumn:name="IP",type=string,JSONPath=`.status.ip`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// SslVpnClient is the Schema for the sslvpnclients API
+type SslVpnClient struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   SslVpnClientSpec   `json:"spec,omitempty"`
+	Status SslVpnClientStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// SslVpnClientList contains a list of SslVpnClient
+type SslVpnClientList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []SslVpnClient `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&SslVpnClient{}, &SslVpnClientList{})
+}
@@ -0,0 +1,163 @@
+package v2
+
+import (
+	"fmt"
+	"net/netip"
+	"strconv"
+	"strings"
+)
+
+// ip protocols which could be used in traffic selectors by name
+var trafficSelectorProtocols = map[string]int{
+	"icmp":      1,
+	"tcp":       6,
+	"udp":       17,
+	"icmpv6":    58,
+	"ipv6-icmp": 58,
+	"sctp":      132,
+}
+
+// String formats the traffic selector in strongSwan syntax, eg: 10.0.0.0/24[tcp/443]
+func (ts TrafficSelector) String() string {
+	switch {
+	case ts.Protocol == "" && ts.Port == "":
+		return ts.Cidr
+	case ts.Port == "":
+		return fmt.Sprintf("%s[%s]", ts.Cidr, ts.Protocol)
+	default:
+		return fmt.Sprintf("%s[%s/%s]", ts.Cidr, ts.Protocol, ts.Port)
+	}
+}
+
+// Validate checks the cidr, protocol and port of the traffic selector
+func (ts TrafficSelector) Validate() error {
+	prefix, err := netip.ParsePrefix(ts.Cidr)
+	if err != nil {
+		return fmt.Errorf("invalid cidr %q: %v", ts.Cidr, err)
+	}
+	if prefix.Masked() != prefix {
+		return fmt.Errorf("cidr %s is not a network address, should be %s", ts.Cidr, prefix.Masked())
+	}
+	protocol := -1
+	if ts.Protocol != "" {
+		if p, ok := trafficSelectorProtocols[strings.ToLower(ts.Protocol)]; ok {
+			protocol = p
+		} else if p, err := strconv.Atoi(ts.Protocol); err == nil && p >= 0 && p <= 255 {
+			protocol = p
+		} else {
+			return fmt.Errorf("invalid protocol %q of cidr %s", ts.Protocol, ts.Cidr)
+		}
+	}
+	if ts.Port == "" {
+		return nil
+	}
+	if protocol != 6 && protocol != 17 && protocol != 132 {
+		return fmt.Errorf("port %s of cidr %s requires protocol tcp, udp or sctp", ts.Port, ts.Cidr)
+	}
+	from, to, isRange := strings.Cut(ts.Port, "-")
+	if !isRange {
+		to = from
+	}
+	start, err := strconv.ParseUint(from, 10, 16)
+	if err != nil {
+		return fmt.Errorf("invalid port %q of cidr %s", ts.Port, ts.Cidr)
+	}
+	end, err := strconv.ParseUint(to, 10, 16)
+	if err != nil || end < start {
+		return fmt.Errorf("invalid port %q of cidr %s", ts.Port, ts.Cidr)
+	}
+	return nil
+}
+
+// splitTrafficSelector splits a traffic selector in strongSwan syntax into cidr, protocol and port
+func splitTrafficSelector(s string) (TrafficSelector, error) {
+	s = strings.TrimSpace(s)
+	cidr, selector, found := strings.Cut(s, "[")
+	ts := TrafficSelector{Cidr: strings.TrimSpace(cidr)}
+	if found {
+		if !strings.HasSuffix(selector, "]") {
+			return ts, fmt.Errorf("invalid traffic selector %q, missing ]", s)
+		}
+		selector = strings.TrimSuffix(selector, "]")
+		protocol, port, _ := strings.Cut(selector, "/")
+		ts.Protocol = strings.TrimSpace(protocol)
+		ts.Port = strings.TrimSpace(port)
+	}
+	return ts, nil
+}
+
+// ParseTrafficSelector parses a traffic selector in strongSwan syntax, eg: 10.0.0.0/24[tcp/443]
+func ParseTrafficSelector(s string) (TrafficSelector, error) {
+	ts, err := splitTrafficSelector(s)
+	if err != nil {
+		return ts, err
+	}
+	if err := ts.Validate(); err != nil {
+		return ts, err
+	}
+	return ts, nil
+}
+
+// NormalizeTrafficSelector parses a traffic selector like strongSwan does,
+// a host ip without prefix length selects the host and the host bits of a cidr are masked
+func NormalizeTrafficSelector(s string) (TrafficSelector, error) {
+	ts, err := splitTrafficSelector(s)
+	if err != nil {
+		return ts, err
+	}
+	if !strings.Contains(ts.Cidr, "/") {
+		if addr, err := netip.ParseAddr(ts.Cidr); err == nil {
+			ts.Cidr = netip.PrefixFrom(addr, addr.BitLen()).String()
+		}
+	} else if prefix, err := netip.ParsePrefix(ts.Cidr); err == nil {
+		ts.Cidr = prefix.Masked().String()
+	}
+	if err := ts.Validate(); err != nil {
+		return ts, err
+	}
+	return ts, nil
+}
+
+// ParseTrafficSelectors parses comma or space separated traffic selectors
+func ParseTrafficSelectors(s string) ([]TrafficSelector, error) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	selectors := make([]TrafficSelector, 0, len(fields))
+	for _, field := range fields {
+		ts, err := ParseTrafficSelector(field)
+		if err != nil {
+			return nil, err
+		}
+		selectors = append(selectors, ts)
+	}
+	return selectors, nil
+}
+
+// NormalizeTrafficSelectors parses comma or space separated traffic selectors with NormalizeTrafficSelector,
+// and returns the values which could not be parsed as they are
+func NormalizeTrafficSelectors(s string) ([]TrafficSelector, []string) {
+	fields := strings.FieldsFunc(s, func(r rune) bool {
+		return r == ',' || r == ' '
+	})
+	selectors := make([]TrafficSelector, 0, len(fields))
+	invalid := []string{}
+	for _, field := range fields {
+		ts, err := NormalizeTrafficSelector(field)
+		if err != nil {
+			invalid = append(invalid, field)
+			continue
+		}
+		selectors = append(selectors, ts)
+	}
+	return selectors, invalid
+}
+
+// FormatTrafficSelectors formats traffic selectors as a comma separated list in strongSwan syntax
+func FormatTrafficSelectors(selectors []TrafficSelector) string {
+	list := make([]string, 0, len(selectors))
+	for _, ts := range selectors {
+		list = append(list, ts.String())
+	}
+	return strings.Join(list, ",")
+}
@@ -0,0 +1,90 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	VpnAccessAllow = "allow"
+	VpnAccessDeny  = "deny"
+)
+
+// VpnAccessRule is a destination the clients are allowed to reach
+type VpnAccessRule struct {
+	// destination cidr, eg: 10.96.0.0/12
+	Cidr string `json:"cidr"`
+	// protocol, all protocols if empty
+	// +kubebuilder:validation:Enum=tcp;udp;icmp
+	Protocol string `json:"protocol,omitempty"`
+	// destination ports or port ranges of tcp or udp, eg: 443, 8000-8080, all ports if empty
+	Ports []string `json:"ports,omitempty"`
+}
+
+// VpnAccessPolicySpec defines the desired state of VpnAccessPolicy
+type VpnAccessPolicySpec struct {
+	// vpn gw in the same namespace as the policy
+	VpnGw string `json:"vpnGw"`
+	// ssl vpn clients matched by the common name of the client certificate
+	CNs []string `json:"cns,omitempty"`
+	// ssl vpn clients matched by the groups of their SslVpnClient
+	Groups []string `json:"groups,omitempty"`
+	// destinations the matched clients are allowed to reach, the clients matched by several policies reach all of them
+	// +kubebuilder:validation:MinItems=1
+	Rules []VpnAccessRule `json:"rules"`
+	// rate limits of each matched client, the lowest rate applies to the clients matched by several policies
+	Bandwidth *SslVpnBandwidth `json:"bandwidth,omitempty"`
+}
+
+// VpnAccessPolicyStatus defines the observed state of VpnAccessPolicy
+type VpnAccessPolicyStatus struct {
+	// common names of the clients which the policy applies to
+	CNs []string `json:"cns,omitempty"`
+
+	// Conditions store the status conditions of the policy
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
+//+kubebuilder:printcolumn:name="CNs",type=string,JSONPath=`.status.cns`
+//+kubebuilder:printcolumn:name="Ready",type=string,JSONPath=`.status.conditions[?(@.type=="Ready")].status`
+
+// VpnAccessPolicy is the Schema for the vpnaccesspolicies API
+type VpnAccessPolicy struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VpnAccessPolicySpec   `json:"spec,omitempty"`
+	Status VpnAccessPolicyStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VpnAccessPolicyList contains a list of VpnAccessPolicy
+type VpnAccessPolicyList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VpnAccessPolicy `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VpnAccessPolicy{}, &VpnAccessPolicyList{})
+}
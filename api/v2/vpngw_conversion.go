@@ -0,0 +1,4 @@
+package v2
+
+// Hub marks this type as a conversion hub.
+func (*VpnGw) Hub() {}
@@ -0,0 +1,347 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+const (
+	// VpnGwCertificateReady is true if the certificates issued by cert-manager are ready
+	VpnGwCertificateReady = "CertificateReady"
+	// VpnGwCertificateExpiringSoon is true if any certificate used by the vpn gw expires within the threshold
+	VpnGwCertificateExpiringSoon = "CertificateExpiringSoon"
+	// VpnGwDhReady is true if the dh parameters generated by the operator are ready
+	VpnGwDhReady = "DhReady"
+)
+
+// PublicEndpoint is how vpn clients and remote ipsec peers reach the vpn gw
+type PublicEndpoint struct {
+	// public ip of the vpn gw, eg: eip or lb vip
+	Ip string `json:"ip,omitempty"`
+	// optional dns name resolved to the public ip, used by vpn clients if set
+	Hostname string `json:"hostname,omitempty"`
+}
+
+// SslVpnSpec defines the openvpn server of the vpn gw
+type SslVpnSpec struct {
+	// vpn gw enable ssl vpn
+	Enabled bool `json:"enabled"`
+	// ssl vpn server image, openvpn server
+	Image string `json:"image,omitempty"`
+	// ssl vpn secret name, the secret should in the same namespace as the vpn gw
+	SslSecret string `json:"sslSecret,omitempty"`
+	// ssl vpn dh secret name, the secret should in the same namespace as the vpn gw
+	// the dh parameters are generated by the operator and shared in the namespace if empty
+	DhSecret string `json:"dhSecret,omitempty"`
+	// use ECDH only with dh none, no dh parameters are needed
+	DisableDh bool `json:"disableDh,omitempty"`
+	// ssl vpn cipher, the data channel cipher of the clients which do not negotiate the cipher
+	Cipher string `json:"cipher,omitempty"`
+	// data channel ciphers negotiated with the clients, eg: AES-256-GCM, CHACHA20-POLY1305, the cipher if empty
+	DataCiphers []string `json:"dataCiphers,omitempty"`
+	// hmac digest of the data channel without an aead cipher
+	// +kubebuilder:default=SHA1
+	Digest string `json:"digest,omitempty"`
+	// minimum tls version of the control channel
+	// +kubebuilder:validation:Enum="1.2";"1.3"
+	// +kubebuilder:default="1.2"
+	TlsVersionMin string `json:"tlsVersionMin,omitempty"`
+	// tun mtu of the server, link-mtu 1300 if empty
+	// +kubebuilder:validation:Minimum=576
+	// +kubebuilder:validation:Maximum=9000
+	Mtu int32 `json:"mtu,omitempty"`
+	// ping interval seconds of the keepalive
+	// +kubebuilder:default=10
+	KeepaliveInterval int32 `json:"keepaliveInterval,omitempty"`
+	// seconds without a ping before the client is disconnected
+	// +kubebuilder:default=600
+	KeepaliveTimeout int32 `json:"keepaliveTimeout,omitempty"`
+	// compression of the data channel pushed to the clients, disabled if empty,
+	// compression is vulnerable to the VORACLE attack, stub-v2 only frames the packets for the clients requiring compression
+	// +kubebuilder:validation:Enum=stub-v2;lz4-v2;lz4
+	Compress string `json:"compress,omitempty"`
+	// max concurrent clients, unlimited if empty
+	// +kubebuilder:validation:Minimum=1
+	MaxClients int32 `json:"maxClients,omitempty"`
+	// ssl vpn proto, udp or tcp, udp probably is better
+	Proto string `json:"proto,omitempty"`
+	// ssl vpn port, eg: 1194 for udp, 443 for tcp, udp 500, 4500 and 68 are used by the ipsec vpn
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port,omitempty"`
+	// tcp listener besides the udp one, the client profiles try udp first and fall back to tcp,
+	// for the clients whose udp is blocked
+	TcpFallback *SslVpnTcpFallback `json:"tcpFallback,omitempty"`
+	// ssl vpn client and server subnet cidr, eg: 10.240.0.0/16, /16 to /28,
+	// the lower half is allocated to the clients dynamically, the upper half is reserved for the static ips of SslVpnClient
+	SubnetCidr string `json:"subnetCidr,omitempty"`
+	// user name and password authentication of the clients, certificate only if empty
+	Auth *SslVpnAuthSpec `json:"auth,omitempty"`
+	// clients enter the totp code of their SslVpnClient at connect, the clients without totp are denied
+	RequireTotp bool `json:"requireTotp,omitempty"`
+	// access of the clients matched by no VpnAccessPolicy, the matched clients reach the destinations of their policies only
+	// +kubebuilder:validation:Enum=allow;deny
+	// +kubebuilder:default=allow
+	DefaultAccess string `json:"defaultAccess,omitempty"`
+	// routes pushed to the clients besides the vpn gw pod subnet, eg: the service cidr, other vpc subnets
+	Routes []string `json:"routes,omitempty"`
+	// dns servers pushed to the clients, eg: the cluster dns service ip
+	DnsServers []string `json:"dnsServers,omitempty"`
+	// search domains pushed to the clients, the search domains of the vpn gw pod if empty
+	SearchDomains []string `json:"searchDomains,omitempty"`
+	// split tunnels the routes pushed to the clients only, full tunnels all the traffic of the clients
+	// +kubebuilder:validation:Enum=split;full
+	// +kubebuilder:default=split
+	TunnelMode string `json:"tunnelMode,omitempty"`
+}
+
+// SslVpnTcpFallback defines the tcp listener of the udp ssl vpn, served by another openvpn instance in the ssl container
+type SslVpnTcpFallback struct {
+	// tcp port, eg: 443
+	// +kubebuilder:validation:Minimum=1
+	// +kubebuilder:validation:Maximum=65535
+	Port int32 `json:"port"`
+	// client and server subnet cidr of the tcp listener, it should have the same prefix length as the ssl vpn subnet cidr
+	// and should not overlap it, eg: 10.241.0.0/16, the static ip of a client is mapped to the same offset of it
+	SubnetCidr string `json:"subnetCidr"`
+}
+
+// SslVpnAuthSpec defines the user name and password authentication of the ssl vpn clients,
+// the clients are authenticated by both the client certificate and the identity provider
+type SslVpnAuthSpec struct {
+	// identity provider of the users
+	// +kubebuilder:validation:Enum=ldap;oidc
+	Type string `json:"type"`
+	// ldap identity provider, required if type is ldap
+	Ldap *SslVpnLdapAuth `json:"ldap,omitempty"`
+	// oidc identity provider, required if type is oidc
+	Oidc *SslVpnOidcAuth `json:"oidc,omitempty"`
+	// the clients are authenticated again at this interval, so the users removed from the identity provider are disconnected, default 15m,
+	// it is the longest time a removed user stays connected, and the lifetime of the auth token of the totp clients as well
+	ReauthInterval *metav1.Duration `json:"reauthInterval,omitempty"`
+}
+
+// SslVpnLdapAuth defines the ldap server which authenticates the ssl vpn users
+type SslVpnLdapAuth struct {
+	// ldap server url, eg: ldaps://ldap.example.com:636
+	Url string `json:"url"`
+	// bind secret name, the secret should in the same namespace as the vpn gw
+	// the service account searching the users is the bindDn and bindPassword keys, ca.crt verifies the ldap server if set
+	BindSecret string `json:"bindSecret"`
+	// base dn of the users, eg: ou=people,dc=example,dc=com
+	BaseDn string `json:"baseDn"`
+	// filter of the user entry, %u is replaced with the user name, default (uid=%u)
+	UserFilter string `json:"userFilter,omitempty"`
+	// filter the user entry should match as well, eg: (memberOf=cn=vpn,ou=groups,dc=example,dc=com), all users if empty
+	GroupFilter string `json:"groupFilter,omitempty"`
+}
+
+// SslVpnOidcAuth defines the oidc provider which authenticates the ssl vpn users
+type SslVpnOidcAuth struct {
+	// issuer url, the endpoints are discovered from <issuer>/.well-known/openid-configuration
+	Issuer string `json:"issuer"`
+	// password: the user name and password are exchanged for an access token by the resource owner password grant
+	// token: the password is an access token which the user gets by device flow or web login
+	// the access token is verified by the userinfo endpoint
+	// +kubebuilder:validation:Enum=password;token
+	// +kubebuilder:default=password
+	Flow string `json:"flow,omitempty"`
+	// client id of the vpn gw
+	ClientId string `json:"clientId"`
+	// client secret name, the secret should in the same namespace as the vpn gw, the clientSecret key is used
+	// public client if empty
+	ClientSecret string `json:"clientSecret,omitempty"`
+	// userinfo claim which should be the user name, default preferred_username
+	UsernameClaim string `json:"usernameClaim,omitempty"`
+	// userinfo claim of the user groups, default groups
+	GroupsClaim string `json:"groupsClaim,omitempty"`
+	// the user should be a member of any of the groups, all users if empty
+	Groups []string `json:"groups,omitempty"`
+}
+
+// IpsecVpnSpec defines the strongSwan server of the vpn gw
+type IpsecVpnSpec struct {
+	// vpn gw enable ipsec vpn
+	Enabled bool `json:"enabled"`
+	// ipsec vpn server image, strongswan server
+	Image string `json:"image,omitempty"`
+	// ipsec vpn secret name, the secret should in the same namespace as the vpn gw
+	IpsecSecret string `json:"ipsecSecret,omitempty"`
+	// IKEv2 remote access for native os vpn clients, site-to-site only if empty
+	RemoteAccess *IpsecRemoteAccessSpec `json:"remoteAccess,omitempty"`
+	// export a signed peer descriptor, a vpn gw of another cluster imports it to create the matching ipsec connection
+	PeerExport *IpsecPeerExportSpec `json:"peerExport,omitempty"`
+}
+
+// IpsecPeerExportSpec defines the peer descriptor exported by the ipsec vpn
+type IpsecPeerExportSpec struct {
+	// local private cidrs advertised to the importing peer
+	// +kubebuilder:validation:MinItems=1
+	Cidrs []TrafficSelector `json:"cidrs"`
+	// secret of the peer cas trusted by this vpn gw, the ca.crt key may contain several certificates,
+	// the peer descriptors imported by this vpn gw are rejected unless their ca is one of them
+	TrustedCaSecret string `json:"trustedCaSecret,omitempty"`
+}
+
+// IpsecRemoteAccessSpec defines the IKEv2 road warrior remote access of the ipsec vpn
+type IpsecRemoteAccessSpec struct {
+	// virtual ip pool cidr, client virtual ips are allocated from it, eg: 10.250.0.0/24
+	PoolCidr string `json:"poolCidr"`
+	// client authentication, eap-mschapv2 uses user name and password, eap-tls uses client certificates signed by the ipsec vpn ca
+	// +kubebuilder:validation:Enum=eap-mschapv2;eap-tls
+	Auth string `json:"auth"`
+	// eap-mschapv2 users secret name, the secret should in the same namespace as the vpn gw
+	// each key of the secret is a user name and its value is the password
+	UsersSecret string `json:"usersSecret,omitempty"`
+	// eap-tls client certificates secret name, the secret should in the same namespace as the vpn gw
+	// each key of the secret is <user>.p12, a PKCS#12 bundle of the client certificate and key, embedded in the client profiles of the user
+	ClientCertsSecret string `json:"clientCertsSecret,omitempty"`
+	// dns servers pushed to clients
+	Dns []string `json:"dns,omitempty"`
+	// local traffic selectors pushed to clients, all traffic is tunneled if empty
+	LocalTs []TrafficSelector `json:"localTs,omitempty"`
+}
+
+// VpnGwSpec defines the desired state of VpnGw
+// +kubebuilder:validation:XValidation:rule="self.subnet == oldSelf.subnet",message="subnet is immutable"
+type VpnGwSpec struct {
+	// pod subnet
+	// the vpn gw server pod running inside in this subnet
+	// user can access all pod in this subnet via vpn gw
+	// vpc subnet use as eth0
+	Subnet string `json:"subnet"`
+	// vpn gw private vpc subnet static ip, random allocate if empty
+	Ip string `json:"ip,omitempty"`
+	// vpn gw public endpoint
+	PublicEndpoint PublicEndpoint `json:"publicEndpoint,omitempty"`
+
+	Replicas int32 `json:"replicas"`
+	// vpn gw container resources, 1 cpu and 1G memory at least
+	Resources corev1.ResourceRequirements `json:"resources,omitempty"`
+	// 1Mbps bandwidth at least
+	QoSBandwidth string `json:"qosBandwidth,omitempty"`
+	// vpn gw pod node selector
+	NodeSelector map[string]string `json:"nodeSelector,omitempty"`
+	// vpn gw pod tolerations
+	Tolerations []corev1.Toleration `json:"tolerations,omitempty"`
+	// vpn gw pod affinity
+	Affinity *corev1.Affinity `json:"affinity,omitempty"`
+
+	// ssl vpn use openvpn server
+	SslVpn SslVpnSpec `json:"sslVpn,omitempty"`
+	// ipsec vpn use strongswan server
+	IpsecVpn IpsecVpnSpec `json:"ipsecVpn,omitempty"`
+	// issue the ssl vpn and ipsec vpn secrets by cert-manager, the secrets are created out of band if empty
+	CertManager *CertManagerSpec `json:"certManager,omitempty"`
+}
+
+// CertManagerSpec defines the cert-manager certificates of the vpn gw
+type CertManagerSpec struct {
+	// cert-manager issuer of the certificates
+	IssuerRef CertIssuerRef `json:"issuerRef"`
+	// common name of the certificates, the public endpoint hostname or ip if empty
+	CommonName string `json:"commonName,omitempty"`
+	// certificate duration, eg: 2160h, cert-manager defaults to 90 days if empty
+	Duration *metav1.Duration `json:"duration,omitempty"`
+	// how long before expiry the certificate is renewed, eg: 360h
+	RenewBefore *metav1.Duration `json:"renewBefore,omitempty"`
+}
+
+// CertIssuerRef references a cert-manager Issuer or ClusterIssuer
+type CertIssuerRef struct {
+	// issuer name, an Issuer should be in the same namespace as the vpn gw
+	Name string `json:"name"`
+	// +kubebuilder:validation:Enum=Issuer;ClusterIssuer
+	// +kubebuilder:default=Issuer
+	Kind string `json:"kind,omitempty"`
+	// issuer api group, cert-manager.io if empty
+	Group string `json:"group,omitempty"`
+}
+
+// CertificateStatus is the certificate which the vpn server has loaded
+type CertificateStatus struct {
+	// secret name of the certificate
+	Secret string `json:"secret"`
+	// sha256 of the tls.crt of the secret, the vpn server reloads the certificate once it changes
+	Hash string `json:"hash"`
+	// certificate serial number in hex
+	Serial string `json:"serial,omitempty"`
+	// certificate expiry time
+	NotAfter metav1.Time `json:"notAfter,omitempty"`
+}
+
+// VpnGwStatus defines the observed state of VpnGw
+type VpnGwStatus struct {
+	// generation of the vpn gw which the statefulset was last updated to
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// ipsec connections rendered into the ipsec configuration
+	IpsecConnections []string `json:"ipsecConnections,omitempty"`
+
+	// vpn gw pod uid which the configuration was last applied to
+	PodUID string `json:"podUID,omitempty"`
+	// total restart count of the ssl and ipsec containers when the configuration was last applied
+	RestartCount int32 `json:"restartCount,omitempty"`
+	// last time the configuration was applied to the vpn gw pod
+	LastAppliedTime metav1.Time `json:"lastAppliedTime,omitempty"`
+	// active certificate of the ssl vpn server
+	SslVpnCertificate *CertificateStatus `json:"sslVpnCertificate,omitempty"`
+	// active certificate of the ipsec vpn server
+	IpsecVpnCertificate *CertificateStatus `json:"ipsecVpnCertificate,omitempty"`
+	// hash of the access policies and the rate limits of the clients applied by the ssl vpn server
+	SslVpnAccessHash string `json:"sslVpnAccessHash,omitempty"`
+	// last message broadcast to the ssl vpn clients by the vpn-gw.kube-combo.com/ssl-vpn-broadcast annotation,
+	// the clients are disconnected with the message and reconnect
+	SslVpnBroadcast string `json:"sslVpnBroadcast,omitempty"`
+
+	// Conditions store the status conditions of the vpn gw instances
+	// +operator-sdk:csv:customresourcedefinitions:type=status
+	Conditions []metav1.Condition `json:"conditions,omitempty" patchStrategy:"merge" patchMergeKey:"type" protobuf:"bytes,1,rep,name=conditions"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:storageversion
+//+kubebuilder:printcolumn:name="IP",type=string,JSONPath=`.spec.ip`
+//+kubebuilder:printcolumn:name="PublicIP",type=string,JSONPath=`.spec.publicEndpoint.ip`
+//+kubebuilder:printcolumn:name="Subnet",type=string,JSONPath=`.spec.subnet`
+//+kubebuilder:printcolumn:name="QoS",type=string,JSONPath=`.spec.qosBandwidth`
+//+kubebuilder:printcolumn:name="EnableSsl",type=string,JSONPath=`.spec.sslVpn.enabled`
+//+kubebuilder:printcolumn:name="EnableIpsec",type=string,JSONPath=`.spec.ipsecVpn.enabled`
+
+// VpnGw is the Schema for the vpngws API
+type VpnGw struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VpnGwSpec   `json:"spec,omitempty"`
+	Status VpnGwStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VpnGwList contains a list of VpnGw
+type VpnGwList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VpnGw `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VpnGw{}, &VpnGwList{})
+}
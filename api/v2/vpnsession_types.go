@@ -0,0 +1,79 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package v2
+
+import (
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// VpnSessionSpec defines a client connected to the ssl vpn server, created by the operator
+type VpnSessionSpec struct {
+	// vpn gw in the same namespace as the session
+	VpnGw string `json:"vpnGw"`
+	// common name of the client certificate
+	CN string `json:"cn"`
+	// proto of the openvpn instance the client connects to, tcp for the tcp fallback listener
+	// +kubebuilder:validation:Enum=udp;tcp
+	Proto string `json:"proto"`
+}
+
+// VpnSessionStatus defines the observed state of VpnSession, read from the openvpn management interface
+type VpnSessionStatus struct {
+	// public address and port of the client
+	RealAddress string `json:"realAddress,omitempty"`
+	// virtual ip of the client in the ssl vpn subnet
+	VirtualAddress string `json:"virtualAddress,omitempty"`
+	// user name of the client if user name and password authentication is enabled
+	Username      string `json:"username,omitempty"`
+	BytesReceived int64  `json:"bytesReceived,omitempty"`
+	BytesSent     int64  `json:"bytesSent,omitempty"`
+	// data channel cipher negotiated with the client
+	Cipher         string       `json:"cipher,omitempty"`
+	ConnectedSince *metav1.Time `json:"connectedSince,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+//+kubebuilder:subresource:status
+//+kubebuilder:printcolumn:name="VpnGw",type=string,JSONPath=`.spec.vpnGw`
+//+kubebuilder:printcolumn:name="CN",type=string,JSONPath=`.spec.cn`
+//+kubebuilder:printcolumn:name="Proto",type=string,JSONPath=`.spec.proto`
+//+kubebuilder:printcolumn:name="VirtualAddress",type=string,JSONPath=`.status.virtualAddress`
+//+kubebuilder:printcolumn:name="RealAddress",type=string,JSONPath=`.status.realAddress`
+//+kubebuilder:printcolumn:name="ConnectedSince",type=date,JSONPath=`.status.connectedSince`
+
+// VpnSession is the Schema for the vpnsessions API,
+// sessions are listed by the operator and deleting a session disconnects the client
+type VpnSession struct {
+	metav1.TypeMeta   `json:",inline"`
+	metav1.ObjectMeta `json:"metadata,omitempty"`
+
+	Spec   VpnSessionSpec   `json:"spec,omitempty"`
+	Status VpnSessionStatus `json:"status,omitempty"`
+}
+
+//+kubebuilder:object:root=true
+
+// VpnSessionList contains a list of VpnSession
+type VpnSessionList struct {
+	metav1.TypeMeta `json:",inline"`
+	metav1.ListMeta `json:"metadata,omitempty"`
+	Items           []VpnSession `json:"items"`
+}
+
+func init() {
+	SchemeBuilder.Register(&VpnSession{}, &VpnSessionList{})
+}
@@ -0,0 +1,1128 @@
+//go:build !ignore_autogenerated
+// +build !ignore_autogenerated
+
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Code generated by controller-gen. DO NOT EDIT.
+
+package v2
+
+import (
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+	runtime "k8s.io/apimachinery/pkg/runtime"
+)
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertIssuerRef) DeepCopyInto(out *CertIssuerRef) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertIssuerRef.
+func (in *CertIssuerRef) DeepCopy() *CertIssuerRef {
+	if in == nil {
+		return nil
+	}
+	out := new(CertIssuerRef)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertManagerSpec) DeepCopyInto(out *CertManagerSpec) {
+	*out = *in
+	out.IssuerRef = in.IssuerRef
+	if in.Duration != nil {
+		in, out := &in.Duration, &out.Duration
+		*out = new(v1.Duration)
+		**out = **in
+	}
+	if in.RenewBefore != nil {
+		in, out := &in.RenewBefore, &out.RenewBefore
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertManagerSpec.
+func (in *CertManagerSpec) DeepCopy() *CertManagerSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(CertManagerSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *CertificateStatus) DeepCopyInto(out *CertificateStatus) {
+	*out = *in
+	in.NotAfter.DeepCopyInto(&out.NotAfter)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new CertificateStatus.
+func (in *CertificateStatus) DeepCopy() *CertificateStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(CertificateStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecChild) DeepCopyInto(out *IpsecChild) {
+	*out = *in
+	if in.LocalTs != nil {
+		in, out := &in.LocalTs, &out.LocalTs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.RemoteTs != nil {
+		in, out := &in.RemoteTs, &out.RemoteTs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecChild.
+func (in *IpsecChild) DeepCopy() *IpsecChild {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecChild)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecConn) DeepCopyInto(out *IpsecConn) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConn.
+func (in *IpsecConn) DeepCopy() *IpsecConn {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecConn)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpsecConn) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecConnList) DeepCopyInto(out *IpsecConnList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IpsecConn, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConnList.
+func (in *IpsecConnList) DeepCopy() *IpsecConnList {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecConnList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpsecConnList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecConnSpec) DeepCopyInto(out *IpsecConnSpec) {
+	*out = *in
+	if in.LocalPrivateCidrs != nil {
+		in, out := &in.LocalPrivateCidrs, &out.LocalPrivateCidrs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.RemotePrivateCidrs != nil {
+		in, out := &in.RemotePrivateCidrs, &out.RemotePrivateCidrs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+	if in.RemoteCa != nil {
+		in, out := &in.RemoteCa, &out.RemoteCa
+		*out = new(IpsecRemoteCa)
+		**out = **in
+	}
+	if in.Keyingtries != nil {
+		in, out := &in.Keyingtries, &out.Keyingtries
+		*out = new(int32)
+		**out = **in
+	}
+	if in.Mobike != nil {
+		in, out := &in.Mobike, &out.Mobike
+		*out = new(bool)
+		**out = **in
+	}
+	if in.Children != nil {
+		in, out := &in.Children, &out.Children
+		*out = make([]IpsecChild, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConnSpec.
+func (in *IpsecConnSpec) DeepCopy() *IpsecConnSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecConnSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecConnStatus) DeepCopyInto(out *IpsecConnStatus) {
+	*out = *in
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecConnStatus.
+func (in *IpsecConnStatus) DeepCopy() *IpsecConnStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecConnStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecPeerExportSpec) DeepCopyInto(out *IpsecPeerExportSpec) {
+	*out = *in
+	if in.Cidrs != nil {
+		in, out := &in.Cidrs, &out.Cidrs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecPeerExportSpec.
+func (in *IpsecPeerExportSpec) DeepCopy() *IpsecPeerExportSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecPeerExportSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecRemoteAccessSpec) DeepCopyInto(out *IpsecRemoteAccessSpec) {
+	*out = *in
+	if in.Dns != nil {
+		in, out := &in.Dns, &out.Dns
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.LocalTs != nil {
+		in, out := &in.LocalTs, &out.LocalTs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecRemoteAccessSpec.
+func (in *IpsecRemoteAccessSpec) DeepCopy() *IpsecRemoteAccessSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecRemoteAccessSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecRemoteCa) DeepCopyInto(out *IpsecRemoteCa) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecRemoteCa.
+func (in *IpsecRemoteCa) DeepCopy() *IpsecRemoteCa {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecRemoteCa)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecTopology) DeepCopyInto(out *IpsecTopology) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecTopology.
+func (in *IpsecTopology) DeepCopy() *IpsecTopology {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecTopology)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpsecTopology) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecTopologyList) DeepCopyInto(out *IpsecTopologyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]IpsecTopology, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecTopologyList.
+func (in *IpsecTopologyList) DeepCopy() *IpsecTopologyList {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecTopologyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *IpsecTopologyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecTopologySite) DeepCopyInto(out *IpsecTopologySite) {
+	*out = *in
+	if in.Cidrs != nil {
+		in, out := &in.Cidrs, &out.Cidrs
+		*out = make([]TrafficSelector, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecTopologySite.
+func (in *IpsecTopologySite) DeepCopy() *IpsecTopologySite {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecTopologySite)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecTopologySpec) DeepCopyInto(out *IpsecTopologySpec) {
+	*out = *in
+	if in.Sites != nil {
+		in, out := &in.Sites, &out.Sites
+		*out = make([]IpsecTopologySite, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecTopologySpec.
+func (in *IpsecTopologySpec) DeepCopy() *IpsecTopologySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecTopologySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecTopologyStatus) DeepCopyInto(out *IpsecTopologyStatus) {
+	*out = *in
+	if in.Connections != nil {
+		in, out := &in.Connections, &out.Connections
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecTopologyStatus.
+func (in *IpsecTopologyStatus) DeepCopy() *IpsecTopologyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecTopologyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *IpsecVpnSpec) DeepCopyInto(out *IpsecVpnSpec) {
+	*out = *in
+	if in.RemoteAccess != nil {
+		in, out := &in.RemoteAccess, &out.RemoteAccess
+		*out = new(IpsecRemoteAccessSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.PeerExport != nil {
+		in, out := &in.PeerExport, &out.PeerExport
+		*out = new(IpsecPeerExportSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new IpsecVpnSpec.
+func (in *IpsecVpnSpec) DeepCopy() *IpsecVpnSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(IpsecVpnSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *PublicEndpoint) DeepCopyInto(out *PublicEndpoint) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new PublicEndpoint.
+func (in *PublicEndpoint) DeepCopy() *PublicEndpoint {
+	if in == nil {
+		return nil
+	}
+	out := new(PublicEndpoint)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnAuthSpec) DeepCopyInto(out *SslVpnAuthSpec) {
+	*out = *in
+	if in.Ldap != nil {
+		in, out := &in.Ldap, &out.Ldap
+		*out = new(SslVpnLdapAuth)
+		**out = **in
+	}
+	if in.Oidc != nil {
+		in, out := &in.Oidc, &out.Oidc
+		*out = new(SslVpnOidcAuth)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.ReauthInterval != nil {
+		in, out := &in.ReauthInterval, &out.ReauthInterval
+		*out = new(v1.Duration)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnAuthSpec.
+func (in *SslVpnAuthSpec) DeepCopy() *SslVpnAuthSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnAuthSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnBandwidth) DeepCopyInto(out *SslVpnBandwidth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnBandwidth.
+func (in *SslVpnBandwidth) DeepCopy() *SslVpnBandwidth {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnBandwidth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClient) DeepCopyInto(out *SslVpnClient) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClient.
+func (in *SslVpnClient) DeepCopy() *SslVpnClient {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClient)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SslVpnClient) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientList) DeepCopyInto(out *SslVpnClientList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]SslVpnClient, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientList.
+func (in *SslVpnClientList) DeepCopy() *SslVpnClientList {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *SslVpnClientList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientSpec) DeepCopyInto(out *SslVpnClientSpec) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Totp != nil {
+		in, out := &in.Totp, &out.Totp
+		*out = new(SslVpnTotpSpec)
+		**out = **in
+	}
+	if in.Bandwidth != nil {
+		in, out := &in.Bandwidth, &out.Bandwidth
+		*out = new(SslVpnBandwidth)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientSpec.
+func (in *SslVpnClientSpec) DeepCopy() *SslVpnClientSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnClientStatus) DeepCopyInto(out *SslVpnClientStatus) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnClientStatus.
+func (in *SslVpnClientStatus) DeepCopy() *SslVpnClientStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnClientStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnLdapAuth) DeepCopyInto(out *SslVpnLdapAuth) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnLdapAuth.
+func (in *SslVpnLdapAuth) DeepCopy() *SslVpnLdapAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnLdapAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnOidcAuth) DeepCopyInto(out *SslVpnOidcAuth) {
+	*out = *in
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnOidcAuth.
+func (in *SslVpnOidcAuth) DeepCopy() *SslVpnOidcAuth {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnOidcAuth)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnSpec) DeepCopyInto(out *SslVpnSpec) {
+	*out = *in
+	if in.DataCiphers != nil {
+		in, out := &in.DataCiphers, &out.DataCiphers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.TcpFallback != nil {
+		in, out := &in.TcpFallback, &out.TcpFallback
+		*out = new(SslVpnTcpFallback)
+		**out = **in
+	}
+	if in.Auth != nil {
+		in, out := &in.Auth, &out.Auth
+		*out = new(SslVpnAuthSpec)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Routes != nil {
+		in, out := &in.Routes, &out.Routes
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.DnsServers != nil {
+		in, out := &in.DnsServers, &out.DnsServers
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.SearchDomains != nil {
+		in, out := &in.SearchDomains, &out.SearchDomains
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnSpec.
+func (in *SslVpnSpec) DeepCopy() *SslVpnSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnTcpFallback) DeepCopyInto(out *SslVpnTcpFallback) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnTcpFallback.
+func (in *SslVpnTcpFallback) DeepCopy() *SslVpnTcpFallback {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnTcpFallback)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *SslVpnTotpSpec) DeepCopyInto(out *SslVpnTotpSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new SslVpnTotpSpec.
+func (in *SslVpnTotpSpec) DeepCopy() *SslVpnTotpSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(SslVpnTotpSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *TrafficSelector) DeepCopyInto(out *TrafficSelector) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new TrafficSelector.
+func (in *TrafficSelector) DeepCopy() *TrafficSelector {
+	if in == nil {
+		return nil
+	}
+	out := new(TrafficSelector)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnAccessPolicy) DeepCopyInto(out *VpnAccessPolicy) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnAccessPolicy.
+func (in *VpnAccessPolicy) DeepCopy() *VpnAccessPolicy {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnAccessPolicy)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VpnAccessPolicy) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnAccessPolicyList) DeepCopyInto(out *VpnAccessPolicyList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VpnAccessPolicy, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnAccessPolicyList.
+func (in *VpnAccessPolicyList) DeepCopy() *VpnAccessPolicyList {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnAccessPolicyList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VpnAccessPolicyList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnAccessPolicySpec) DeepCopyInto(out *VpnAccessPolicySpec) {
+	*out = *in
+	if in.CNs != nil {
+		in, out := &in.CNs, &out.CNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Groups != nil {
+		in, out := &in.Groups, &out.Groups
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Rules != nil {
+		in, out := &in.Rules, &out.Rules
+		*out = make([]VpnAccessRule, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Bandwidth != nil {
+		in, out := &in.Bandwidth, &out.Bandwidth
+		*out = new(SslVpnBandwidth)
+		**out = **in
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnAccessPolicySpec.
+func (in *VpnAccessPolicySpec) DeepCopy() *VpnAccessPolicySpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnAccessPolicySpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnAccessPolicyStatus) DeepCopyInto(out *VpnAccessPolicyStatus) {
+	*out = *in
+	if in.CNs != nil {
+		in, out := &in.CNs, &out.CNs
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnAccessPolicyStatus.
+func (in *VpnAccessPolicyStatus) DeepCopy() *VpnAccessPolicyStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnAccessPolicyStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnAccessRule) DeepCopyInto(out *VpnAccessRule) {
+	*out = *in
+	if in.Ports != nil {
+		in, out := &in.Ports, &out.Ports
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnAccessRule.
+func (in *VpnAccessRule) DeepCopy() *VpnAccessRule {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnAccessRule)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGw) DeepCopyInto(out *VpnGw) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	in.Spec.DeepCopyInto(&out.Spec)
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGw.
+func (in *VpnGw) DeepCopy() *VpnGw {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGw)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VpnGw) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwList) DeepCopyInto(out *VpnGwList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VpnGw, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwList.
+func (in *VpnGwList) DeepCopy() *VpnGwList {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VpnGwList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwSpec) DeepCopyInto(out *VpnGwSpec) {
+	*out = *in
+	out.PublicEndpoint = in.PublicEndpoint
+	in.Resources.DeepCopyInto(&out.Resources)
+	if in.NodeSelector != nil {
+		in, out := &in.NodeSelector, &out.NodeSelector
+		*out = make(map[string]string, len(*in))
+		for key, val := range *in {
+			(*out)[key] = val
+		}
+	}
+	if in.Tolerations != nil {
+		in, out := &in.Tolerations, &out.Tolerations
+		*out = make([]corev1.Toleration, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+	if in.Affinity != nil {
+		in, out := &in.Affinity, &out.Affinity
+		*out = new(corev1.Affinity)
+		(*in).DeepCopyInto(*out)
+	}
+	in.SslVpn.DeepCopyInto(&out.SslVpn)
+	in.IpsecVpn.DeepCopyInto(&out.IpsecVpn)
+	if in.CertManager != nil {
+		in, out := &in.CertManager, &out.CertManager
+		*out = new(CertManagerSpec)
+		(*in).DeepCopyInto(*out)
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwSpec.
+func (in *VpnGwSpec) DeepCopy() *VpnGwSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnGwStatus) DeepCopyInto(out *VpnGwStatus) {
+	*out = *in
+	if in.IpsecConnections != nil {
+		in, out := &in.IpsecConnections, &out.IpsecConnections
+		*out = make([]string, len(*in))
+		copy(*out, *in)
+	}
+	in.LastAppliedTime.DeepCopyInto(&out.LastAppliedTime)
+	if in.SslVpnCertificate != nil {
+		in, out := &in.SslVpnCertificate, &out.SslVpnCertificate
+		*out = new(CertificateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.IpsecVpnCertificate != nil {
+		in, out := &in.IpsecVpnCertificate, &out.IpsecVpnCertificate
+		*out = new(CertificateStatus)
+		(*in).DeepCopyInto(*out)
+	}
+	if in.Conditions != nil {
+		in, out := &in.Conditions, &out.Conditions
+		*out = make([]v1.Condition, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnGwStatus.
+func (in *VpnGwStatus) DeepCopy() *VpnGwStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnGwStatus)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnSession) DeepCopyInto(out *VpnSession) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ObjectMeta.DeepCopyInto(&out.ObjectMeta)
+	out.Spec = in.Spec
+	in.Status.DeepCopyInto(&out.Status)
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnSession.
+func (in *VpnSession) DeepCopy() *VpnSession {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnSession)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VpnSession) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnSessionList) DeepCopyInto(out *VpnSessionList) {
+	*out = *in
+	out.TypeMeta = in.TypeMeta
+	in.ListMeta.DeepCopyInto(&out.ListMeta)
+	if in.Items != nil {
+		in, out := &in.Items, &out.Items
+		*out = make([]VpnSession, len(*in))
+		for i := range *in {
+			(*in)[i].DeepCopyInto(&(*out)[i])
+		}
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnSessionList.
+func (in *VpnSessionList) DeepCopy() *VpnSessionList {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnSessionList)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyObject is an autogenerated deepcopy function, copying the receiver, creating a new runtime.Object.
+func (in *VpnSessionList) DeepCopyObject() runtime.Object {
+	if c := in.DeepCopy(); c != nil {
+		return c
+	}
+	return nil
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnSessionSpec) DeepCopyInto(out *VpnSessionSpec) {
+	*out = *in
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnSessionSpec.
+func (in *VpnSessionSpec) DeepCopy() *VpnSessionSpec {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnSessionSpec)
+	in.DeepCopyInto(out)
+	return out
+}
+
+// DeepCopyInto is an autogenerated deepcopy function, copying the receiver, writing into out. in must be non-nil.
+func (in *VpnSessionStatus) DeepCopyInto(out *VpnSessionStatus) {
+	*out = *in
+	if in.ConnectedSince != nil {
+		in, out := &in.ConnectedSince, &out.ConnectedSince
+		*out = (*in).DeepCopy()
+	}
+}
+
+// DeepCopy is an autogenerated deepcopy function, copying the receiver, creating a new VpnSessionStatus.
+func (in *VpnSessionStatus) DeepCopy() *VpnSessionStatus {
+	if in == nil {
+		return nil
+	}
+	out := new(VpnSessionStatus)
+	in.DeepCopyInto(out)
+	return out
+}
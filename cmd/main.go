@@ -19,20 +19,25 @@ package main
 import (
 	"flag"
 	"os"
+	"time"
 
 	// Import all Kubernetes client auth plugins (e.g. Azure, GCP, OIDC, etc.)
 	// to ensure that exec-entrypoint and run can make use of them.
 	"k8s.io/client-go/kubernetes"
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 
+	corev1 "k8s.io/api/core/v1"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	utilruntime "k8s.io/apimachinery/pkg/util/runtime"
 	clientgoscheme "k8s.io/client-go/kubernetes/scheme"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/cache"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
 
 	vpngwv1 "github.com/kubecombo/kube-combo/api/v1"
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
 	"github.com/kubecombo/kube-combo/internal/controller"
 	//+kubebuilder:scaffold:imports
 )
@@ -44,8 +49,10 @@ var (
 
 func init() {
 	utilruntime.Must(clientgoscheme.AddToScheme(scheme))
+	utilruntime.Must(apiextensionsv1.AddToScheme(scheme))
 
 	utilruntime.Must(vpngwv1.AddToScheme(scheme))
+	utilruntime.Must(vpngwv2.AddToScheme(scheme))
 	//+kubebuilder:scaffold:scheme
 }
 
@@ -53,11 +60,25 @@ func main() {
 	var metricsAddr string
 	var enableLeaderElection bool
 	var probeAddr string
+	var migrateStorageVersion bool
+	var ipsecDeniedAlgorithms, ipsecAllowedAlgorithms string
+	var ipsecAllowIkeV1 bool
+	var certExpiryThreshold time.Duration
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
 	flag.StringVar(&probeAddr, "health-probe-bind-address", ":8081", "The address the probe endpoint binds to.")
 	flag.BoolVar(&enableLeaderElection, "leader-elect", false,
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
+	flag.BoolVar(&migrateStorageVersion, "migrate-storage-version", true,
+		"Rewrite existing vpn gw and ipsec connection objects in the storage version on start up.")
+	flag.StringVar(&ipsecDeniedAlgorithms, "ipsec-denied-algorithms", controller.DefaultIpsecDeniedAlgorithms,
+		"Comma separated weak algorithms which ipsec connections are not allowed to use.")
+	flag.StringVar(&ipsecAllowedAlgorithms, "ipsec-allowed-algorithms", "",
+		"Comma separated algorithms which are explicitly allowed even if denied, eg: modp1536,sha1.")
+	flag.BoolVar(&ipsecAllowIkeV1, "ipsec-allow-ikev1", false,
+		"Allow ipsec connections to use IKEv1.")
+	flag.DurationVar(&certExpiryThreshold, "cert-expiry-threshold", controller.DefaultCertExpiryThreshold,
+		"How long before expiry a vpn gw certificate is reported as expiring soon.")
 	opts := zap.Options{
 		Development: true,
 	}
@@ -78,6 +99,12 @@ func main() {
 		HealthProbeBindAddress: probeAddr,
 		LeaderElection:         enableLeaderElection,
 		LeaderElectionID:       "a7db789a.kube-combo.com",
+		// cache the vpn gw pods only, instead of all the pods of the cluster
+		NewCache: cache.BuilderWithOptions(cache.Options{
+			SelectorsByObject: cache.SelectorsByObject{
+				&corev1.Pod{}: {Label: controller.VpnGwPodSelector()},
+			},
+		}),
 		// LeaderElectionReleaseOnCancel defines if the leader should step down voluntarily
 		// when the Manager ends. This requires the binary to immediately end when the
 		// Manager is stopped, otherwise, this setting is unsafe. Setting this significantly
@@ -95,24 +122,103 @@ func main() {
 		os.Exit(1)
 	}
 
+	ipsecPolicy := controller.NewIpsecAlgorithmPolicy(ipsecDeniedAlgorithms, ipsecAllowedAlgorithms, ipsecAllowIkeV1)
 	if err = (&controller.VpnGwReconciler{
-		Client:     mgr.GetClient(),
-		KubeClient: kubeClient,
-		Scheme:     mgr.GetScheme(),
-		RestConfig: restConfig,
-		Log:        ctrl.Log.WithName("vpngw"),
+		Client:      mgr.GetClient(),
+		KubeClient:  kubeClient,
+		Scheme:      mgr.GetScheme(),
+		RestConfig:  restConfig,
+		Log:         ctrl.Log.WithName("vpngw"),
+		IpsecPolicy: ipsecPolicy,
+
+		CertExpiryThreshold: certExpiryThreshold,
+		Recorder:            mgr.GetEventRecorderFor("vpngw"),
 	}).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "VpnGw")
 		os.Exit(1)
 	}
 	if err = (&controller.IpsecConnReconciler{
+		Client:      mgr.GetClient(),
+		Scheme:      mgr.GetScheme(),
+		Log:         ctrl.Log.WithName("ipsecconn"),
+		IpsecPolicy: ipsecPolicy,
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "IpsecConn")
+		os.Exit(1)
+	}
+	if err = (&controller.IpsecTopologyReconciler{
 		Client: mgr.GetClient(),
 		Scheme: mgr.GetScheme(),
-		Log:    ctrl.Log.WithName("ipsecconn"),
+		Log:    ctrl.Log.WithName("ipsectopology"),
 	}).SetupWithManager(mgr); err != nil {
-		setupLog.Error(err, "unable to create controller", "controller", "IpsecConn")
+		setupLog.Error(err, "unable to create controller", "controller", "IpsecTopology")
+		os.Exit(1)
+	}
+	if err = (&controller.IpsecPeerReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Log:    ctrl.Log.WithName("ipsecpeer"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "IpsecPeer")
+		os.Exit(1)
+	}
+	if err = (&controller.SslVpnClientReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Log:    ctrl.Log.WithName("sslvpnclient"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "SslVpnClient")
 		os.Exit(1)
 	}
+	if err = (&controller.VpnAccessPolicyReconciler{
+		Client: mgr.GetClient(),
+		Scheme: mgr.GetScheme(),
+		Log:    ctrl.Log.WithName("vpnaccesspolicy"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VpnAccessPolicy")
+		os.Exit(1)
+	}
+	if err = (&controller.VpnSessionReconciler{
+		Client:     mgr.GetClient(),
+		KubeClient: kubeClient,
+		Scheme:     mgr.GetScheme(),
+		RestConfig: restConfig,
+		Log:        ctrl.Log.WithName("vpnsession"),
+	}).SetupWithManager(mgr); err != nil {
+		setupLog.Error(err, "unable to create controller", "controller", "VpnSession")
+		os.Exit(1)
+	}
+	// list the clients connected to the ssl vpn servers as vpn sessions
+	if err = mgr.Add(&controller.SslVpnSessionMonitor{
+		Client:     mgr.GetClient(),
+		KubeClient: kubeClient,
+		Scheme:     mgr.GetScheme(),
+		RestConfig: restConfig,
+		Log:        ctrl.Log.WithName("sslvpnsession"),
+	}); err != nil {
+		setupLog.Error(err, "unable to add ssl vpn session monitor")
+		os.Exit(1)
+	}
+	if os.Getenv("ENABLE_WEBHOOKS") != "false" {
+		if err = (&vpngwv2.VpnGw{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "VpnGw")
+			os.Exit(1)
+		}
+		if err = (&vpngwv2.IpsecConn{}).SetupWebhookWithManager(mgr); err != nil {
+			setupLog.Error(err, "unable to create webhook", "webhook", "IpsecConn")
+			os.Exit(1)
+		}
+	}
+	if migrateStorageVersion {
+		if err = mgr.Add(&controller.StorageVersionMigrator{
+			Client: mgr.GetClient(),
+			Reader: mgr.GetAPIReader(),
+			Log:    ctrl.Log.WithName("storage-migration"),
+		}); err != nil {
+			setupLog.Error(err, "unable to add storage version migrator")
+			os.Exit(1)
+		}
+	}
 	//+kubebuilder:scaffold:builder
 
 	if err := mgr.AddHealthzCheck("healthz", healthz.Ping); err != nil {
@@ -0,0 +1,180 @@
+#!/bin/bash
+set -euo pipefail
+# apply the access rules and the rate limits of the ssl vpn clients, they are rendered by the operator keyed by the client cn,
+# every line of a rule file is the iptables match of a destination the client is allowed to reach,
+# a bandwidth file is the upload and the download rate of the client in Mbps, zero is unlimited
+# learn-address, run by openvpn as nobody through sudo:
+#   access-policy.sh add|update <address> <cn>
+#   access-policy.sh delete <address>
+# init, run by configure.sh before openvpn starts:
+#   access-policy.sh init
+# reload, run by the operator once the rules or the rate limits change, $2 should be the hash of them:
+#   access-policy.sh reload <hash>
+
+ACCESS_PATH=/etc/ovpn/access
+BANDWIDTH_PATH=/etc/ovpn/bandwidth
+STATE_PATH=/run/kube-combo-access
+CHAIN=KUBE-COMBO-ACCESS
+DEFAULT_CHAIN=KUBE-COMBO-ACCESS-DEFAULT
+
+# openvpn and the operator may run the script at the same time
+exec 9>/run/kube-combo-access.lock
+flock 9
+
+client_chain() {
+    # iptables chain names are 28 characters at most
+    echo "KC-ACCESS-${1//./-}"
+}
+
+# default access of the clients matched by no policy
+apply_default() {
+    iptables -F "${DEFAULT_CHAIN}"
+    if [ "$(cat "${ACCESS_PATH}/.default" 2>/dev/null || echo allow)" = "deny" ]; then
+        iptables -A "${DEFAULT_CHAIN}" -j DROP
+    else
+        iptables -A "${DEFAULT_CHAIN}" -j ACCEPT
+    fi
+}
+
+# tc class and filter priority of the client, the lower 16 bits of its address,
+# they are unique on the tun device as the operator limits the subnet to /16 at most,
+# and zero is the network address of a /16, which is never assigned to a client
+tc_id() {
+    local IFS=.
+    # shellcheck disable=SC2086
+    set -- $1
+    echo $(($3 * 256 + $4))
+}
+
+# tun device of the client, tun0 or tun1 of the tcp fallback listener
+client_dev() {
+    ip -o route get "$1" 2>/dev/null | sed -n 's/.* dev \(tun[0-9]*\) .*/\1/p'
+}
+
+remove_bandwidth() {
+    local addr="$1" dev="$2" id
+    id="$(tc_id "${addr}")"
+    tc filter del dev "${dev}" parent ffff: prio "${id}" 2>/dev/null || true
+    tc filter del dev "${dev}" parent 1: prio "${id}" 2>/dev/null || true
+    tc class del dev "${dev}" classid "1:$(printf %x "${id}")" 2>/dev/null || true
+}
+
+# the upload of the client is policed on the ingress of its tun device, the download is shaped on the egress
+apply_bandwidth() {
+    local addr="$1" cn="$2" dev id upload=0 download=0
+    dev="$(client_dev "${addr}")"
+    id="$(tc_id "${addr}")"
+    [ -n "${dev}" ] && [ "${id}" -gt 0 ] || return 0
+    remove_bandwidth "${addr}" "${dev}"
+    if [ -f "${BANDWIDTH_PATH}/${cn}" ]; then
+        read -r upload download <"${BANDWIDTH_PATH}/${cn}" || true
+    fi
+    if ! [[ "${upload}" =~ ^[0-9]+$ && "${download}" =~ ^[0-9]+$ ]]; then
+        echo "access-policy: skip invalid bandwidth ${upload} ${download} of cn ${cn}" >&2
+        return 0
+    fi
+    if [ "${upload}" -gt 0 ]; then
+        tc qdisc add dev "${dev}" handle ffff: ingress 2>/dev/null || true
+        tc filter add dev "${dev}" parent ffff: protocol ip prio "${id}" u32 match ip src "${addr}/32" \
+            police rate "${upload}mbit" burst "$((upload * 16))k" drop flowid :1
+    fi
+    if [ "${download}" -gt 0 ]; then
+        # the traffic of the unlimited clients is not classified, it is sent directly
+        tc qdisc add dev "${dev}" root handle 1: htb 2>/dev/null || true
+        tc class add dev "${dev}" parent 1: classid "1:$(printf %x "${id}")" htb rate "${download}mbit"
+        tc filter add dev "${dev}" parent 1: protocol ip prio "${id}" u32 match ip dst "${addr}/32" flowid "1:$(printf %x "${id}")"
+    fi
+}
+
+apply() {
+    local addr="$1" cn="$2" chain rule
+    chain="$(client_chain "${addr}")"
+    iptables -N "${chain}" 2>/dev/null || iptables -F "${chain}"
+    if [ -f "${ACCESS_PATH}/${cn}" ]; then
+        while read -r rule; do
+            [ -n "${rule}" ] || continue
+            # the rule is word split into the iptables arguments
+            if ! [[ "${rule}" =~ ^[-a-z0-9./:\ ]+$ ]]; then
+                echo "access-policy: skip invalid rule ${rule} of cn ${cn}" >&2
+                continue
+            fi
+            # shellcheck disable=SC2086
+            iptables -A "${chain}" ${rule} -j ACCEPT
+        done <"${ACCESS_PATH}/${cn}"
+        iptables -A "${chain}" -j DROP
+    else
+        iptables -A "${chain}" -j "${DEFAULT_CHAIN}"
+    fi
+    # the client chains are before the default chain at the end
+    iptables -C "${CHAIN}" -s "${addr}" -j "${chain}" 2>/dev/null || iptables -I "${CHAIN}" 2 -s "${addr}" -j "${chain}"
+    apply_bandwidth "${addr}" "${cn}"
+    echo "${cn}" >"${STATE_PATH}/${addr}"
+}
+
+remove() {
+    local addr="$1" chain dev
+    chain="$(client_chain "${addr}")"
+    dev="$(client_dev "${addr}")"
+    if [ -n "${dev}" ]; then
+        remove_bandwidth "${addr}" "${dev}"
+    fi
+    iptables -D "${CHAIN}" -s "${addr}" -j "${chain}" 2>/dev/null || true
+    iptables -F "${chain}" 2>/dev/null || true
+    iptables -X "${chain}" 2>/dev/null || true
+    rm -f "${STATE_PATH}/${addr}"
+}
+
+op="${1:-}"
+case "${op}" in
+init)
+    mkdir -p "${STATE_PATH}"
+    rm -f "${STATE_PATH}"/*
+    iptables -N "${DEFAULT_CHAIN}" 2>/dev/null || true
+    apply_default
+    iptables -N "${CHAIN}" 2>/dev/null || iptables -F "${CHAIN}"
+    # replies of the connections initiated to the clients, the connections of the clients are checked on every packet,
+    # so the tightened rules apply to the established connections as well
+    iptables -A "${CHAIN}" -m conntrack --ctstate ESTABLISHED,RELATED --ctdir REPLY -j ACCEPT
+    iptables -A "${CHAIN}" -j "${DEFAULT_CHAIN}"
+    iptables -C FORWARD -i tun+ -j "${CHAIN}" 2>/dev/null || iptables -I FORWARD -i tun+ -j "${CHAIN}"
+    ;;
+add | update)
+    addr="${2:-}"
+    cn="${3:-}"
+    # only the ipv4 client addresses are learned
+    [[ "${addr}" =~ ^[0-9]+(\.[0-9]+){3}$ ]] || exit 0
+    if ! [[ "${cn}" =~ ^[-_a-zA-Z0-9][-._a-zA-Z0-9]*$ ]]; then
+        echo "access-policy: invalid common name ${cn}" >&2
+        exit 1
+    fi
+    apply "${addr}" "${cn}"
+    ;;
+delete)
+    addr="${2:-}"
+    [[ "${addr}" =~ ^[0-9]+(\.[0-9]+){3}$ ]] || exit 0
+    remove "${addr}"
+    ;;
+reload)
+    want="${2:-}"
+    # kubelet refreshes the mounted configmaps within its sync period, wait a while for them
+    for _ in $(seq 1 60); do
+        if [ "$(cat "${ACCESS_PATH}/.hash" 2>/dev/null)" = "${want}" ] &&
+            [ "$(cat "${BANDWIDTH_PATH}/.hash" 2>/dev/null)" = "${want}" ]; then
+            apply_default
+            for state in "${STATE_PATH}"/*; do
+                [ -f "${state}" ] || continue
+                apply "$(basename "${state}")" "$(cat "${state}")"
+            done
+            exit 0
+        fi
+        echo "waiting for the access rules and rate limits ${want} ............"
+        sleep 2
+    done
+    echo "access rules and rate limits ${want} are not mounted yet"
+    exit 1
+    ;;
+*)
+    echo "usage: $0 init|add|update|delete|reload" >&2
+    exit 1
+    ;;
+esac
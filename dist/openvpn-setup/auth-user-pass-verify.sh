@@ -0,0 +1,205 @@
+#!/bin/bash
+set -uo pipefail
+# openvpn auth-user-pass-verify via-file script
+# $1 is a file with the user name on the first line and the password on the second line,
+# common_name of the client certificate and session_state of the auth token are set by openvpn
+# exit 0 to accept the client, the settings are saved into auth.env by configure.sh,
+# openvpn does not pass its own env to the scripts
+
+# shellcheck disable=SC1091
+source /etc/openvpn/auth.env
+AUTH_SECRET_PATH="/etc/ovpn/auth"
+TOTP_SECRET_PATH="/etc/ovpn/totp"
+TOTP_STATE_PATH="/tmp/totp"
+
+username="$(sed -n 1p "$1")"
+password="$(sed -n 2p "$1")"
+
+log() {
+    echo "auth-user-pass-verify: cn ${common_name:-} user ${username}: $*" >&2
+}
+
+deny() {
+    log "$*, access denied"
+    exit 1
+}
+
+# static challenge response of the totp code, SCRV1:<base64 password>:<base64 code>
+code=""
+if [[ "${password}" == SCRV1:* ]]; then
+    IFS=: read -r _ password code <<<"${password}"
+    password="$(echo "${password}" | base64 -d)"
+    code="$(echo "${code}" | base64 -d)"
+fi
+
+if [ "${OVPN_AUTH:-}" = "ldap" ]; then
+    ldap_opts=(-x -H "${OVPN_LDAP_URL}" -o nettimeout=10 -o ldif-wrap=no)
+    if [ -f "${AUTH_SECRET_PATH}/ca.crt" ]; then
+        export LDAPTLS_CACERT="${AUTH_SECRET_PATH}/ca.crt"
+    fi
+fi
+
+# prints the dn of the user
+ldap_search_user() {
+    local filter="${OVPN_LDAP_USER_FILTER//%u/${username}}"
+    if [ -n "${OVPN_LDAP_GROUP_FILTER}" ]; then
+        filter="(&${filter}${OVPN_LDAP_GROUP_FILTER})"
+    fi
+
+    # search the user entry by the service account
+    local entries
+    entries="$(ldapsearch "${ldap_opts[@]}" -LLL -D "$(cat "${AUTH_SECRET_PATH}/bindDn")" -y "${AUTH_SECRET_PATH}/bindPassword" \
+        -b "${OVPN_LDAP_BASE_DN}" "${filter}" 1.1)" || deny "failed to search ldap"
+    local dns
+    dns="$(echo "${entries}" | grep -c '^dn::\? ')"
+    if [ "${dns}" != "1" ]; then
+        deny "${dns} ldap entries match ${filter}"
+    fi
+    local dn
+    dn="$(echo "${entries}" | grep '^dn::\? ')"
+    if [[ "${dn}" == "dn:: "* ]]; then
+        dn="$(echo "${dn#dn:: }" | base64 -d)"
+    else
+        dn="${dn#dn: }"
+    fi
+    echo "${dn}"
+}
+
+ldap_auth() {
+    local dn
+    dn="$(ldap_search_user)" || exit 1
+    # bind as the user to verify the password
+    ldapwhoami "${ldap_opts[@]}" -D "${dn}" -y <(printf '%s' "${password}") >/dev/null || deny "ldap bind failed"
+}
+
+# prints the claims of a jwt, the signature is not verified
+jwt_claims() {
+    local payload
+    payload="$(echo "$1" | cut -d. -f2 | tr '_-' '/+')"
+    # restore the padding of base64url
+    while [ $((${#payload} % 4)) -ne 0 ]; do
+        payload="${payload}="
+    done
+    echo "${payload}" | base64 -d 2>/dev/null
+}
+
+# the access token given by the client should be issued to this vpn, not to any other client of the identity provider
+oidc_verify_audience() {
+    local config="$1" token="$2"
+    local claims
+    if [[ "${token}" =~ ^[A-Za-z0-9_-]+\.[A-Za-z0-9_-]+\.[A-Za-z0-9_-]*$ ]]; then
+        # the userinfo endpoint verifies the jwt is issued by the identity provider
+        claims="$(jwt_claims "${token}")" || deny "invalid oidc access token"
+    else
+        # opaque access tokens are introspected with the client credentials
+        local endpoint
+        endpoint="$(echo "${config}" | jq -r '.introspection_endpoint // empty')"
+        if [ -z "${endpoint}" ] || [ ! -f "${AUTH_SECRET_PATH}/clientSecret" ]; then
+            deny "opaque oidc access token can not be introspected"
+        fi
+        claims="$(printf '%s' "${token}" | curl -fsS --max-time 10 --data-urlencode "token@-" \
+            --data-urlencode "client_id=${OVPN_OIDC_CLIENT_ID}" --data-urlencode "client_secret@${AUTH_SECRET_PATH}/clientSecret" \
+            "${endpoint}")" || deny "oidc token introspection failed"
+        echo "${claims}" | jq -e '.active == true' >/dev/null || deny "oidc access token is not active"
+    fi
+    echo "${claims}" | jq -e --arg client "${OVPN_OIDC_CLIENT_ID}" \
+        '.azp == $client or .client_id == $client or ((.aud // []) | if type == "string" then [.] else . end | index($client) != null)' >/dev/null ||
+        deny "oidc access token is not issued to ${OVPN_OIDC_CLIENT_ID}"
+}
+
+oidc_auth() {
+    local config
+    config="$(curl -fsS --max-time 10 "${OVPN_OIDC_ISSUER%/}/.well-known/openid-configuration")" || deny "failed to discover oidc endpoints"
+    local token="${password}"
+    if [ "${OVPN_OIDC_FLOW}" = "password" ]; then
+        local endpoint
+        endpoint="$(echo "${config}" | jq -r .token_endpoint)"
+        local args=(--data-urlencode grant_type=password --data-urlencode scope=openid
+            --data-urlencode "client_id=${OVPN_OIDC_CLIENT_ID}" --data-urlencode "username=${username}" --data-urlencode "password@-")
+        if [ -f "${AUTH_SECRET_PATH}/clientSecret" ]; then
+            args+=(--data-urlencode "client_secret@${AUTH_SECRET_PATH}/clientSecret")
+        fi
+        local response
+        response="$(printf '%s' "${password}" | curl -fsS --max-time 10 "${args[@]}" "${endpoint}")" || deny "oidc password grant failed"
+        token="$(echo "${response}" | jq -r .access_token)"
+    else
+        oidc_verify_audience "${config}" "${token}"
+    fi
+
+    # the userinfo endpoint verifies the access token
+    local endpoint
+    endpoint="$(echo "${config}" | jq -r .userinfo_endpoint)"
+    local userinfo
+    userinfo="$(curl -fsS --max-time 10 -H @<(printf 'Authorization: Bearer %s' "${token}") "${endpoint}")" || deny "oidc access token is invalid"
+    echo "${userinfo}" | jq -e --arg claim "${OVPN_OIDC_USERNAME_CLAIM}" --arg user "${username}" '.[$claim] == $user' >/dev/null ||
+        deny "oidc ${OVPN_OIDC_USERNAME_CLAIM} does not match"
+    if [ -n "${OVPN_OIDC_GROUPS}" ]; then
+        echo "${userinfo}" | jq -e --arg claim "${OVPN_OIDC_GROUPS_CLAIM}" --arg groups "${OVPN_OIDC_GROUPS}" \
+            '(.[$claim] // []) as $member | $groups | split(",") | any(. as $group | $member | index($group))' >/dev/null ||
+            deny "not a member of ${OVPN_OIDC_GROUPS}"
+    fi
+}
+
+totp_auth() {
+    # the password is the totp code if the client does not support static challenge
+    if [ -z "${code}" ] && [ -z "${OVPN_AUTH:-}" ]; then
+        code="${password}"
+    fi
+    # the common name is the totp key file name
+    if ! [[ "${common_name:-}" =~ ^[-._a-zA-Z0-9]+$ ]]; then
+        deny "invalid common name"
+    fi
+    if [ ! -f "${TOTP_SECRET_PATH}/${common_name}" ]; then
+        deny "no totp key"
+    fi
+    if ! [[ "${code}" =~ ^[0-9]{6}$ ]]; then
+        deny "invalid totp code"
+    fi
+    mkdir -p "${TOTP_STATE_PATH}"
+    python3 /etc/openvpn/setup/totp.py "${TOTP_SECRET_PATH}/${common_name}" "${code}" "${TOTP_STATE_PATH}/${common_name}" ||
+        deny "wrong or reused totp code"
+}
+
+# with totp, the session renegotiates with the auth token generated by openvpn instead of a new totp code,
+# the token expires after the reauth interval, then the client authenticates again with a new totp code
+case "${session_state:-Initial}" in
+Initial) ;;
+Authenticated | AuthenticatedEmptyUser)
+    # the users removed from ldap are disconnected, the access token of oidc is not kept
+    if [ "${OVPN_AUTH:-}" = "ldap" ] && [[ "${username}" =~ ^[A-Za-z0-9._@-]+$ ]]; then
+        ldap_search_user >/dev/null || exit 1
+    fi
+    log "session token accepted"
+    exit 0
+    ;;
+*)
+    deny "session token is ${session_state}"
+    ;;
+esac
+
+if [ "${OVPN_TOTP:-}" = "true" ]; then
+    totp_auth
+fi
+
+if [ -n "${OVPN_AUTH:-}" ]; then
+    # the user name is put into the ldap filter
+    if ! [[ "${username}" =~ ^[A-Za-z0-9._@-]+$ ]]; then
+        deny "invalid user name"
+    fi
+    if [ -z "${password}" ]; then
+        deny "empty password"
+    fi
+    case "${OVPN_AUTH}" in
+    ldap)
+        ldap_auth
+        ;;
+    oidc)
+        oidc_auth
+        ;;
+    *)
+        deny "unknown auth ${OVPN_AUTH}"
+        ;;
+    esac
+fi
+log "access granted"
+exit 0
@@ -33,48 +33,84 @@ cidr2net() {
 # or generate certs with easyrsa
 # /etc/openvpn/setup/setup-certs.sh
 
+# openvpn.conf is rendered by the operator, the mounted configmap may not be that fast
+for _ in $(seq 30)
+do
+    if [ -f /etc/ovpn/conf/openvpn.conf ]; then
+        break
+    fi
+    sleep 2
+    echo "waiting for /etc/ovpn/conf/openvpn.conf ............"
+done
+
 intAndIP="$(ip route get 8.8.8.8 | awk '/8.8.8.8/ {print $5 "-" $7}')"
 int="${intAndIP%-*}"
 ip="${intAndIP#*-}"
 cidr="$(ip addr show dev "$int" | awk -vip="$ip" '($2 ~ ip) {print $2}')"
-OVPN_NETWORK="$(echo "${OVPN_SUBNET_CIDR}" | tr "/" " " | awk '{ print $1 }')"
-ovpn_subnet_mask="$(echo "${OVPN_SUBNET_CIDR}" | tr "/" " " | awk '{ print $2 }')"
-OVPN_SUBNET_MASK=$(cidr2mask "${ovpn_subnet_mask}")
 NETWORK=$(cidr2net "${cidr}")
 NETMASK=$(cidr2mask "${cidr#*/}")
 echo "DEBUG .............."
-echo "OVPN_NETWORK ${OVPN_NETWORK} OVPN_SUBNET_MASK ${OVPN_SUBNET_MASK}"
+echo "OVPN_SUBNET_CIDR ${OVPN_SUBNET_CIDR}"
 echo "OVPN_PROTO ${OVPN_PROTO} OVPN_PORT ${OVPN_PORT}"
-echo "OVPN_CIPHER ${OVPN_CIPHER}"
 echo "NETWORK ${NETWORK} NETMASK ${NETMASK}"
 
-iptables -t nat -A POSTROUTING -s "${OVPN_NETWORK}/${OVPN_SUBNET_MASK}" -o eth0 -j MASQUERADE
+iptables -t nat -A POSTROUTING -s "${OVPN_SUBNET_CIDR}" -o eth0 -j MASQUERADE
+if [ -n "${OVPN_TCP_PORT:-}" ]; then
+    echo "OVPN_TCP_PORT ${OVPN_TCP_PORT} OVPN_TCP_SUBNET_CIDR ${OVPN_TCP_SUBNET_CIDR}"
+    iptables -t nat -A POSTROUTING -s "${OVPN_TCP_SUBNET_CIDR}" -o eth0 -j MASQUERADE
+fi
 mkdir -p /dev/net
 if [ ! -c /dev/net/tun ]; then
     mknod /dev/net/tun c 10 200
 fi
 
-SEARCH=$(grep -v '^#' /etc/resolv.conf | grep search | awk '{$1=""; print $0}')
-FORMATTED_SEARCH=""
-for DOMAIN in $SEARCH; do
-  FORMATTED_SEARCH="${FORMATTED_SEARCH}push \"dhcp-option DOMAIN-SEARCH ${DOMAIN}\"\n"
+# the tcp fallback listener is served by another openvpn instance
+CONFS="openvpn.conf"
+if [ -f /etc/ovpn/conf/openvpn-tcp.conf ]; then
+    CONFS="${CONFS} openvpn-tcp.conf"
+fi
+SEARCH=""
+if [ -z "${OVPN_SEARCH_DOMAINS:-}" ]; then
+    SEARCH=$(grep -v '^#' /etc/resolv.conf | grep search | awk '{$1=""; print $0}')
+fi
+for CONF in $CONFS; do
+    cp -f "/etc/ovpn/conf/${CONF}" "/etc/openvpn/${CONF}"
+    # the pod subnet is known in the pod only
+    cat >> "/etc/openvpn/${CONF}" <<EOF
+push "route ${NETWORK} ${NETMASK}"
+EOF
+    # the search domains of the pod if none is set
+    for DOMAIN in $SEARCH; do
+        echo "push \"dhcp-option DOMAIN-SEARCH ${DOMAIN}\"" >> "/etc/openvpn/${CONF}"
+    done
 done
 
-cp -f /etc/openvpn/setup/openvpn.conf /etc/openvpn/
-sed 's|OVPN_PROTO|'"${OVPN_PROTO}"'|' -i /etc/openvpn/openvpn.conf
-sed 's|OVPN_PORT|'"${OVPN_PORT}"'|' -i /etc/openvpn/openvpn.conf
-
-sed 's|OVPN_NETWORK|'"${OVPN_NETWORK}"'|' -i /etc/openvpn/openvpn.conf
-sed 's|OVPN_SUBNET_MASK|'"${OVPN_SUBNET_MASK}"'|' -i /etc/openvpn/openvpn.conf
-sed 's|CIPHER|'"${OVPN_CIPHER}"'|' -i /etc/openvpn/openvpn.conf
+# user name and password authentication and totp, openvpn does not pass its env to the verify script,
+# so the settings are saved for it
+if [ -n "${OVPN_AUTH:-}" ] || [ "${OVPN_TOTP:-}" = "true" ]; then
+    declare -p $(compgen -v | grep -E '^OVPN_(AUTH|LDAP|OIDC|TOTP)') > /etc/openvpn/auth.env
+    chmod 644 /etc/openvpn/auth.env
+fi
 
-# NETWORK is in OVPN_NETWORK, so leave it last to sed
-sed 's|NETWORK|'"${NETWORK}"'|' -i /etc/openvpn/openvpn.conf
-sed 's|NETMASK|'"${NETMASK}"'|' -i /etc/openvpn/openvpn.conf
+# access rules of the clients, applied by learn-address
+/etc/openvpn/setup/access-policy.sh init
 
-# DNS
-sed 's|OVPN_K8S_SEARCH|'"${FORMATTED_SEARCH}"'|' -i /etc/openvpn/openvpn.conf
+# openvpn runs as nobody after start up, a SIGHUP restart by reload-certs.sh opens the listener and the status file again,
+# so the privileged ports like tcp 443 are allowed for nobody in the pod network namespace, and nobody owns the status files
+sysctl -w net.ipv4.ip_unprivileged_port_start=0
+for STATUS in /openvpn-status.log /openvpn-status-tcp.log; do
+    touch "${STATUS}"
+    chown nobody:nogroup "${STATUS}"
+done
 
 #
 echo "Running openvpn with config .............."
-openvpn --config /etc/openvpn/openvpn.conf
+if [ ! -f /etc/openvpn/openvpn-tcp.conf ]; then
+    openvpn --config /etc/openvpn/openvpn.conf
+    exit $?
+fi
+# restart the container once either instance exits
+openvpn --config /etc/openvpn/openvpn.conf &
+openvpn --config /etc/openvpn/openvpn-tcp.conf &
+wait -n
+exit 1
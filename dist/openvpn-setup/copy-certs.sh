@@ -5,26 +5,39 @@ EASY_RSA_LOC="/etc/openvpn/certs"
 # pod mount secret to /etc/ovpn/certs, but not that fast
 # after pod start, the secret maybe is not mounted yet
 
-while [ ! -f /etc/ovpn/certs/tls.key ]
-do
-    sleep 2
-    echo "waiting for /etc/ovpn/certs/tls.key ............"
-done
-
-while [ ! -f /etc/ovpn/dh/dh.pem ]
-do
-    sleep 2
-    echo "waiting for /etc/ovpn/dh/dh.pem ............"
-done
+# the dh secret generated by the operator takes minutes, give up after 5 minutes
+wait_for() {
+    for _ in $(seq 150)
+    do
+        if [ -f "$1" ]; then
+            return 0
+        fi
+        sleep 2
+        echo "waiting for $1 ............"
+    done
+    echo "error: $1 is not mounted, check the secret of the vpn gw" >&2
+    exit 1
+}
+
+wait_for /etc/ovpn/certs/tls.key
+
+# dh none, the ecdh groups are used only
+if [ "${OVPN_DH_NONE:-}" != "true" ]; then
+    wait_for /etc/ovpn/dh/dh.pem
+fi
 
 cp /etc/ovpn/certs/tls.key $EASY_RSA_LOC/pki/private/server.key
 # chmod 600 key to eliminate the warning.
 chmod 600 $EASY_RSA_LOC/pki/private/server.key
+# openvpn runs as nobody, which reads the key again when reload-certs.sh restarts it by SIGHUP
+chown nobody:nogroup $EASY_RSA_LOC/pki/private/server.key
 
 cp /etc/ovpn/certs/ca.crt $EASY_RSA_LOC/pki/ca.crt
 
 openssl x509 --nout --text --in /etc/ovpn/certs/tls.crt > $EASY_RSA_LOC/pki/issued/server.crt 
 # cat /etc/ovpn/certs/tls.crt >> $EASY_RSA_LOC/pki/issued/server.crt
 
-cp /etc/ovpn/dh/dh.pem $EASY_RSA_LOC/pki/dh.pem
+if [ "${OVPN_DH_NONE:-}" != "true" ]; then
+    cp /etc/ovpn/dh/dh.pem $EASY_RSA_LOC/pki/dh.pem
+fi
 
@@ -0,0 +1,86 @@
+#!/bin/bash
+set -euo pipefail
+# live sessions of the ssl vpn server through the openvpn management interface on localhost
+# status: list the connected clients, one tab separated CLIENT_LIST line per client prefixed by the proto of its listener
+# kill <proto> <cn>: disconnect the client from the listener with HALT, so that it does not reconnect automatically
+# broadcast <message>: disconnect all the clients with RESTART and the message, they show it and reconnect,
+# openvpn can not send a text to a client without disconnecting it
+# reload: restart the openvpn instances in place by SIGHUP, the certificates and keys are read again
+# the tcp fallback listener is served by another openvpn instance with its own management port
+MANAGEMENT_PORT=7505
+TCP_MANAGEMENT_PORT=7506
+
+# the listeners as <proto> <management port>
+listeners() {
+    if [ -f /etc/openvpn/openvpn-tcp.conf ]; then
+        echo "${OVPN_PROTO} ${MANAGEMENT_PORT}"
+        echo "tcp ${TCP_MANAGEMENT_PORT}"
+    else
+        echo "${OVPN_PROTO} ${MANAGEMENT_PORT}"
+    fi
+}
+
+# send the commands to the management interface and print the responses
+management() {
+    port=$1
+    shift
+    exec 3<>"/dev/tcp/127.0.0.1/${port}"
+    printf '%s\n' "$@" quit >&3
+    cat <&3
+    exec 3<&-
+}
+
+clients() {
+    management "$1" "status 3" | tr -d '\r' | grep '^CLIENT_LIST' || true
+}
+
+# the client ids of the CLIENT_LIST lines, the virtual ipv6 address column is empty mostly,
+# so the columns are split by every tab
+client_ids() {
+    clients "$1" | awk -F'\t' -v cn="${2:-}" 'cn == "" || $2 == cn { print $11 }'
+}
+
+case ${1:-} in
+status)
+    listeners | while read -r proto port; do
+        clients "$port" | sed "s/^/${proto}\t/"
+    done
+    ;;
+kill)
+    proto=$2
+    cn=$3
+    listeners | while read -r p port; do
+        if [ "$p" = "$proto" ]; then
+            # a client which is gone already is not found
+            cmds=()
+            for cid in $(client_ids "$port" "$cn"); do
+                cmds+=("client-kill ${cid} HALT")
+            done
+            if [ ${#cmds[@]} -gt 0 ]; then
+                management "$port" "${cmds[@]}" | grep -E '^(SUCCESS|ERROR):' || true
+            fi
+        fi
+    done
+    ;;
+broadcast)
+    message=$2
+    listeners | while read -r proto port; do
+        cmds=()
+        for cid in $(client_ids "$port"); do
+            cmds+=("client-kill ${cid} \"RESTART,${message}\"")
+        done
+        if [ ${#cmds[@]} -gt 0 ]; then
+            management "$port" "${cmds[@]}" | grep -E '^(SUCCESS|ERROR):' || true
+        fi
+    done
+    ;;
+reload)
+    listeners | while read -r _ port; do
+        management "$port" "signal SIGHUP" | grep -E '^(SUCCESS|ERROR):' || true
+    done
+    ;;
+*)
+    echo "usage: $0 status | kill <proto> <cn> | broadcast <message> | reload"
+    exit 1
+    ;;
+esac
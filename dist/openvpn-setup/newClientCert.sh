@@ -6,6 +6,38 @@ set -euo pipefail
 client_key_name=$1
 
 EASY_RSA_LOC="/etc/openvpn/certs"
+# the client authenticates by user name and password as well if the vpn gw ssl vpn auth is set
+AUTH_USER_PASS=""
+if [ -n "${OVPN_AUTH:-}" ]; then
+    AUTH_USER_PASS="auth-user-pass"
+fi
+# the client is asked for the totp code of its ssl vpn client if the vpn gw ssl vpn requires totp
+if [ "${OVPN_TOTP:-}" = "true" ]; then
+    AUTH_USER_PASS="auth-user-pass
+static-challenge \"Enter TOTP code\" 1"
+fi
+# the client tunnels all its traffic in full tunnel mode, the routes are pushed by the server in split tunnel mode
+REDIRECT_GATEWAY=""
+if [ "${OVPN_TUNNEL_MODE:-split}" = "full" ]; then
+    REDIRECT_GATEWAY="redirect-gateway def1 bypass-dhcp"
+fi
+# the client tries the udp remote first and falls back to the tcp remote if udp is blocked
+REMOTES="remote ${PUBLIC_IP} ${OVPN_PORT:-1194} ${OVPN_PROTO:-udp}"
+if [ -n "${OVPN_TCP_PORT:-}" ]; then
+    REMOTES="${REMOTES}
+remote ${PUBLIC_IP} ${OVPN_TCP_PORT} tcp
+server-poll-timeout 10"
+fi
+# the data channel options of the client should match the server
+DATA_CHANNEL="data-ciphers ${OVPN_DATA_CIPHERS:-AES-256-GCM:AES-128-GCM}
+auth ${OVPN_DIGEST:-SHA1}"
+if [ -n "${OVPN_TUN_MTU:-}" ]; then
+    DATA_CHANNEL="${DATA_CHANNEL}
+tun-mtu ${OVPN_TUN_MTU}"
+elif [ -n "${OVPN_LINK_MTU:-}" ]; then
+    DATA_CHANNEL="${DATA_CHANNEL}
+link-mtu ${OVPN_LINK_MTU}"
+fi
 cd $EASY_RSA_LOC
 /usr/share/easy-rsa/easyrsa build-client-full "${client_key_name}" nopass
 cat >${EASY_RSA_LOC}/pki/"${client_key_name}".ovpn <<EOF
@@ -13,12 +45,15 @@ client
 nobind
 dev tun
 remote-cert-tls server # mitigate mitm
-# 注意这里由于 cert-manager 签的secret 没有 Key Usage, 所以这里需要屏蔽掉
+# 服务端证书需要带有 Key Usage, 由 vpn gw certManager 签发的证书已带有 digital signature, key encipherment 和 server auth
+# 带外创建且没有 Key Usage 的证书需要屏蔽掉 remote-cert-tls
 # https://superuser.com/questions/1446201/openvpn-certificate-does-not-have-key-usage-extension
-remote ${PUBLIC_IP} 1194 udp  
+${REMOTES}
 # default udp 1194
 # defualt tcp 443
-redirect-gateway def1
+${DATA_CHANNEL}
+${REDIRECT_GATEWAY}
+${AUTH_USER_PASS}
 <key>
 $(cat ${EASY_RSA_LOC}/pki/private/"${client_key_name}".key)
 </key>
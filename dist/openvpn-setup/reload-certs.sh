@@ -0,0 +1,21 @@
+#!/bin/bash
+set -euo pipefail
+# reload the renewed server certificate in place
+# $1 should be the sha256 of the renewed tls.crt
+want=$1
+
+# kubelet refreshes the mounted secret within its sync period, wait a while for it
+for _ in $(seq 1 15)
+do
+    if [ "$(sha256sum /etc/ovpn/certs/tls.crt | awk '{print $1}')" = "$want" ]; then
+        /etc/openvpn/setup/copy-certs.sh
+        # SIGHUP restarts openvpn in place, certificates and keys are read again,
+        # the container and the tun devices are kept, the clients reconnect by themselves
+        /etc/openvpn/setup/management.sh reload
+        exit 0
+    fi
+    echo "waiting for the renewed /etc/ovpn/certs/tls.crt ............"
+    sleep 2
+done
+echo "/etc/ovpn/certs/tls.crt is not renewed yet"
+exit 1
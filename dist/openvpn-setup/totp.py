@@ -0,0 +1,49 @@
+#!/usr/bin/env python3
+"""verify a totp code, rfc 6238 with sha1, 6 digits and 30s period as the authenticator apps default
+
+usage: totp.py <key file> <code> <state file>
+
+the key file is the base32 encoded totp key, the state file keeps the last accepted time step,
+so that a code is accepted once only
+"""
+import base64
+import hashlib
+import hmac
+import struct
+import sys
+import time
+
+PERIOD = 30
+DIGITS = 6
+
+
+def hotp(key, counter):
+    mac = hmac.new(key, struct.pack(">Q", counter), hashlib.sha1).digest()
+    offset = mac[-1] & 0x0F
+    value = struct.unpack(">I", mac[offset : offset + 4])[0] & 0x7FFFFFFF
+    return str(value % 10**DIGITS).zfill(DIGITS)
+
+
+def main():
+    key_file, code, state_file = sys.argv[1:4]
+    with open(key_file) as f:
+        key = "".join(f.read().split()).upper().rstrip("=")
+    key = base64.b32decode(key + "=" * (-len(key) % 8))
+    last = -1
+    try:
+        with open(state_file) as f:
+            last = int(f.read())
+    except (OSError, ValueError):
+        pass
+    now = int(time.time()) // PERIOD
+    # one step of clock drift is allowed
+    for step in (now - 1, now, now + 1):
+        if step > last and hmac.compare_digest(hotp(key, step), code):
+            with open(state_file, "w") as f:
+                f.write(str(step))
+            return 0
+    return 1
+
+
+if __name__ == "__main__":
+    sys.exit(main())
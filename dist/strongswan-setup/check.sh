@@ -0,0 +1,11 @@
+#!/bin/bash
+set -eux
+
+swanctl --list-conns
+# after ping remote private cidr ip
+# this --list-sas will show the ESTABLISHED
+/usr/sbin/swanctl --list-sas
+/usr/sbin/swanctl --stats
+
+ip xfrm state
+ip xfrm policy
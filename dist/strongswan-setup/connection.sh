@@ -2,93 +2,120 @@
 set -euo pipefail
 
 CONF=/etc/swanctl/swanctl.conf
-CONNECTIONS_YAML=connections.yaml
 HOSTS=/etc/hosts
-TEMPLATE_HOSTS=template-hosts.j2
-TEMPLATE_SWANCTL_CONF=template-swanctl.conf.j2
-TEMPLATE_CHECK=template-check.j2
-CHECK_SCRIPT=check
+# configmap and secret rendered by kube-combo, mounted into the ipsec container
+CONF_DIR=/etc/ipsec/conf
+SECRETS_DIR=/etc/ipsec/secrets
+WATCH_INTERVAL=${WATCH_INTERVAL:-5}
+# nat rules rendered by kube-combo, netmap for overlapping cidrs and remote access masquerade
+IPTABLES_RULES=$CONF_DIR/iptables.rules
+NAT_CHAINS="PREROUTING:KUBE-COMBO-NETMAP-PRE POSTROUTING:KUBE-COMBO-NETMAP-POST POSTROUTING:KUBE-COMBO-RW"
 
 function init() {
-    # prepare hosts.j2
-    if [ ! -f hosts.j2 ]; then
-        cp $HOSTS  hosts.j2
-        cat $TEMPLATE_HOSTS >> hosts.j2
-    fi
-    # prepare swanctl.conf.j2
-    if [ ! -f swanctl.conf.j2 ]; then
-        mv $CONF swanctl.conf.orig
-        cp $TEMPLATE_SWANCTL_CONF swanctl.conf.j2
+    # keep the original swanctl.conf
+    if [ ! -f swanctl.conf.orig ]; then
+        cp $CONF swanctl.conf.orig
     fi
 
     #
-    # configure ca
+    # configure ca, the remote ca of each connection is loaded from $SECRETS_DIR by its cacerts or certs
     cp /etc/ipsec/certs/ca.crt /etc/swanctl/x509ca
     cp /etc/ipsec/certs/tls.key /etc/swanctl/private
     cp /etc/ipsec/certs/tls.crt /etc/swanctl/x509
 
 }
 
-function refresh() {
+function nat() {
+    if [ ! -f $IPTABLES_RULES ]; then
+        return 0
+    fi
+    # declared chains are flushed and refilled, other chains are kept
+    iptables-restore --noflush < $IPTABLES_RULES
+    for item in $NAT_CHAINS; do
+        hook=${item%%:*}
+        chain=${item##*:}
+        iptables -t nat -C "$hook" -j "$chain" 2>/dev/null || iptables -t nat -I "$hook" -j "$chain"
+    done
+}
+
+function reload() {
     # 1. init
     init
-    # 2. refresh connections
-    # format connections into connection.yaml
-    printf "connections: \n" > $CONNECTIONS_YAML
-    IFS=',' read -r -a array <<< "${connections}"
-    for connection in "${array[@]}"
+    # 2. refresh swanctl.conf and hosts from the mounted configmap
+    if [ ! -f $CONF_DIR/swanctl.conf ]; then
+        echo "waiting for $CONF_DIR/swanctl.conf ............"
+        return 1
+    fi
+    cp $CONF_DIR/swanctl.conf $CONF
+    # /etc/hosts is mounted by kubelet, rewrite it in place
+    sed '/# --- STRONGSWAN_CONTENT_START ---/,/# --- STRONGSWAN_CONTENT_END ---/d' $HOSTS > hosts.new
+    cat $CONF_DIR/hosts >> hosts.new
+    cat hosts.new > $HOSTS
+    # 3. apply nat rules
+    nat
+    # 4. reload strongswan connections
+    /usr/sbin/swanctl --load-all
+}
+
+function reload-creds() {
+    # reload the renewed certificate in place, $1 is the sha256 of the renewed tls.crt
+    # kubelet refreshes the mounted secret within its sync period, wait a while for it
+    want=$1
+    for _ in $(seq 1 15)
     do
-        # echo "show connection: ${connection}"
-        IFS=' ' read -r -a conn <<< "${connection}"
-        name=${conn[0]}
-        auth=${conn[1]}
-        ikeVersion=${conn[2]}
-        proposal=${conn[3]}
-        localCN=${conn[4]}
-        localPublicIp=${conn[5]}
-        localPrivateCidrs=${conn[6]}
-        remoteCN=${conn[7]}
-        remotePublicIp=${conn[8]}
-        remotePrivateCidrs=${conn[9]}
-        { 
-        printf "  - name: %s\n" "${name}"
-        printf "    auth: %s\n" "${auth}"
-        printf "    ikeVersion: %s\n" "${ikeVersion}"
-        printf "    proposals: %s\n" "${proposal}"
-        printf "    localCN: %s\n" "${localCN}"
-        printf "    localPublicIp: %s\n" "${localPublicIp}"
-        printf "    localPrivateCidrs: %s\n" "${localPrivateCidrs}"
-        printf "    remoteCN: %s\n" "${remoteCN}"
-        printf "    remotePublicIp: %s\n" "${remotePublicIp}"
-        printf "    remotePrivateCidrs: %s\n" "${remotePrivateCidrs}"
-        } >> $CONNECTIONS_YAML
+        if [ "$(sha256sum /etc/ipsec/certs/tls.crt | awk '{print $1}')" = "$want" ]; then
+            init
+            /usr/sbin/swanctl --load-creds
+            return 0
+        fi
+        echo "waiting for the renewed /etc/ipsec/certs/tls.crt ............"
+        sleep 2
     done
-    # 3. generate hosts and swanctl.conf
-    # use j2 to generate hosts and swanctl.conf
-    j2 hosts.j2 $CONNECTIONS_YAML -o $HOSTS
-    j2 swanctl.conf.j2 $CONNECTIONS_YAML -o $CONF
-    j2 $TEMPLATE_CHECK $CONNECTIONS_YAML -o $CHECK_SCRIPT
-    chmod +x $CHECK_SCRIPT
+    echo "/etc/ipsec/certs/tls.crt is not renewed yet"
+    return 1
+}
 
-    # 4. reload strongswan connections
-    /usr/sbin/swanctl --load-all
+function checksum() {
+    # configmap and secret keys are symlinks to the atomically updated ..data dir
+    cat $CONF_DIR/* $SECRETS_DIR/* 2>/dev/null | md5sum
+}
+
+function watch() {
+    # reload once the mounted configmap or secret changes
+    last=""
+    while true
+    do
+        current=$(checksum)
+        if [ "$current" != "$last" ]; then
+            echo "ipsec configuration changed, reloading ............"
+            if reload; then
+                last=$current
+            fi
+        fi
+        sleep "$WATCH_INTERVAL"
+    done
 }
 
 if [ $# -eq 0 ]; then
-    echo "Usage: $0 [init|refresh]"
+    echo "Usage: $0 [init|reload|reload-creds <sha256 of tls.crt>|watch]"
     exit 1
 fi
-connections=${*:2:${#}}
 opt=$1
 case $opt in
  init)
         init
         ;;
- refresh)
-        refresh "${connections}"
+ reload)
+        reload
+        ;;
+ reload-creds)
+        reload-creds "$2"
+        ;;
+ watch)
+        watch
         ;;
  *)
-        echo "Usage: $0 [init|refresh]"
+        echo "Usage: $0 [init|reload|reload-creds <sha256 of tls.crt>|watch]"
         exit 1
         ;;
 esac
@@ -0,0 +1,7 @@
+#!/bin/bash
+set -euo pipefail
+
+# load the mounted ipsec configuration once charon is up, and reload it on change
+/connection.sh watch &
+
+exec /usr/sbin/charon-systemd
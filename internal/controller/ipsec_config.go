@@ -0,0 +1,391 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// ipsec configuration delivered by configmap and secret, mounted into the ipsec container
+	IpsecConfigMapSuffix = "-ipsec-conf"
+	IpsecSecretSuffix    = "-ipsec-secrets"
+	IpsecConfigPath      = "/etc/ipsec/conf"
+	IpsecSecretsPath     = "/etc/ipsec/secrets"
+
+	IpsecSwanctlConfKey = "swanctl.conf"
+	IpsecHostsKey       = "hosts"
+	IpsecSecretsConfKey = "secrets.conf"
+
+	// psk secret data key referenced by ipsec connection
+	IpsecPskKey = "psk"
+
+	// IKEv2 remote access connection and its virtual ip pool
+	IpsecRemoteAccessConnName = "rw"
+	IpsecRemoteAccessPoolName = "rw-pool"
+	IpsecRemoteAccessEapTls   = "eap-tls"
+	IpsecRemoteAccessMschapV2 = "eap-mschapv2"
+)
+
+var swanctlConfTemplate = template.Must(template.New(IpsecSwanctlConfKey).Funcs(template.FuncMap{
+	"trafficSelectors": vpngwv2.FormatTrafficSelectors,
+	"yesNo":            swanctlBool,
+	"remoteCaPath":     ipsecRemoteCaPath,
+}).Parse(`connections {
+{{- range .Conns }}
+{{- $conn := . }}
+    net-net-{{ .Name }} {
+        local {
+            auth = {{ .Spec.Auth }}
+{{- if eq .Spec.Auth "psk" }}
+            id = {{ .Spec.LocalCN }}
+{{- else }}
+            certs = tls.crt
+{{- end }}
+        }
+        remote {
+            auth = {{ .Spec.Auth }}
+{{- if eq .Spec.Auth "psk" }}
+            id = {{ .Spec.RemoteCN }}
+{{- else }}
+            id = "CN={{ .Spec.RemoteCN }}"
+{{- with .Spec.RemoteCa }}
+{{- if .Pinned }}
+            certs = {{ remoteCaPath $conn.Name }}
+{{- else }}
+            cacerts = {{ remoteCaPath $conn.Name }}
+{{- end }}
+{{- end }}
+{{- end }}
+        }
+        remote_addrs = {{ .Spec.RemoteCN }}
+        children {
+{{- range .Spec.EffectiveChildren }}
+            {{ .Name }} {
+                local_ts = {{ trafficSelectors .LocalTs }}
+                remote_ts = {{ trafficSelectors .RemoteTs }}
+{{- if .EspProposals }}
+                esp_proposals = {{ .EspProposals }}
+{{- end }}
+{{- if .RekeyTime }}
+                rekey_time = {{ .RekeyTime }}
+{{- end }}
+                mode = {{ .Mode }}
+                dpd_action = {{ .DpdAction }}
+                start_action = {{ .StartAction }}
+{{- if .CloseAction }}
+                close_action = {{ .CloseAction }}
+{{- end }}
+            }
+{{- end }}
+        }
+        version = {{ .Spec.IkeVersion }}
+        proposals = {{ .Spec.IkeProposals }}
+{{- if .Spec.DpdDelay }}
+        dpd_delay = {{ .Spec.DpdDelay }}
+{{- end }}
+{{- if .Spec.DpdTimeout }}
+        dpd_timeout = {{ .Spec.DpdTimeout }}
+{{- end }}
+{{- if .Spec.RekeyTime }}
+        rekey_time = {{ .Spec.RekeyTime }}
+{{- end }}
+{{- if .Spec.ReauthTime }}
+        reauth_time = {{ .Spec.ReauthTime }}
+{{- end }}
+{{- if .Spec.OverTime }}
+        over_time = {{ .Spec.OverTime }}
+{{- end }}
+{{- if .Spec.Keyingtries }}
+        keyingtries = {{ .Spec.Keyingtries }}
+{{- end }}
+{{- if .Spec.Mobike }}
+        mobike = {{ yesNo .Spec.Mobike }}
+{{- end }}
+    }
+{{- end }}
+{{- with .RemoteAccess }}
+    ` + IpsecRemoteAccessConnName + ` {
+        version = 2
+        pools = ` + IpsecRemoteAccessPoolName + `
+        send_certreq = no
+        proposals = {{ .IkeProposals }}
+        local {
+            auth = pubkey
+            certs = tls.crt
+            id = {{ .ServerId }}
+        }
+        remote {
+            auth = {{ .Auth }}
+            eap_id = %any
+        }
+        children {
+            ` + IpsecRemoteAccessConnName + ` {
+                local_ts = {{ .LocalTs }}
+                esp_proposals = {{ .EspProposals }}
+                dpd_action = clear
+            }
+        }
+        dpd_delay = 60s
+    }
+{{- end }}
+}
+{{- with .RemoteAccess }}
+
+pools {
+    ` + IpsecRemoteAccessPoolName + ` {
+        addrs = {{ .PoolCidr }}
+{{- if .Dns }}
+        dns = {{ .Dns }}
+{{- end }}
+    }
+}
+{{- end }}
+
+include ` + IpsecSecretsPath + `/*.conf
+`))
+
+var ipsecHostsTemplate = template.Must(template.New(IpsecHostsKey).Parse(`# --- STRONGSWAN_CONTENT_START ---
+{{- range .Conns }}
+# --- connection {{ .Name }} ---
+127.0.2.1 {{ .Spec.LocalCN }}
+{{ .Spec.LocalPublicIp }} {{ .Spec.LocalCN }}
+{{ .Spec.RemotePublicIp }} {{ .Spec.RemoteCN }}
+{{- end }}
+# --- STRONGSWAN_CONTENT_END ---
+`))
+
+var ipsecSecretsTemplate = template.Must(template.New(IpsecSecretsConfKey).Parse(`secrets {
+{{- range .Psks }}
+    ike-{{ .Name }} {
+        id-local = {{ .LocalCN }}
+        id-remote = {{ .RemoteCN }}
+        secret = {{ printf "%q" .Psk }}
+    }
+{{- end }}
+{{- range $i, $user := .EapUsers }}
+    eap-{{ $i }} {
+        id = {{ printf "%q" $user.Name }}
+        secret = {{ printf "%q" $user.Password }}
+    }
+{{- end }}
+}
+`))
+
+// swanctlBool formats a bool setting in strongSwan syntax
+func swanctlBool(b *bool) string {
+	if b != nil && *b {
+		return "yes"
+	}
+	return "no"
+}
+
+// ipsecConfig is the configuration of the ipsec connections and remote access of a vpn gw
+type ipsecConfig struct {
+	Conns        []vpngwv2.IpsecConn
+	RemoteAccess *ipsecRemoteAccess
+}
+
+// Advertised returns the ipsec connections with the translated local traffic selectors
+func (c ipsecConfig) Advertised() ([]vpngwv2.IpsecConn, error) {
+	conns := make([]vpngwv2.IpsecConn, 0, len(c.Conns))
+	for _, conn := range c.Conns {
+		translated, err := translateIpsecConn(conn)
+		if err != nil {
+			return nil, fmt.Errorf("failed to translate ipsec connection %s: %v", conn.Name, err)
+		}
+		conns = append(conns, translated)
+	}
+	return conns, nil
+}
+
+// ipsecRemoteAccess is the IKEv2 road warrior connection of a vpn gw
+type ipsecRemoteAccess struct {
+	ServerId string
+	Auth     string
+	PoolCidr string
+	// comma separated
+	Dns     string
+	LocalTs string
+	// proposals allowed by the algorithm policy, comma separated
+	IkeProposals string
+	EspProposals string
+}
+
+// ipsecSecrets is the credentials of the ipsec connections and remote access of a vpn gw
+type ipsecSecrets struct {
+	Psks     []ipsecPsk
+	EapUsers []ipsecEapUser
+	// pem encoded remote ca by ipsec connection name
+	RemoteCas map[string][]byte
+}
+
+// ipsecPsk is the pre-shared key of a psk ipsec connection
+type ipsecPsk struct {
+	Name     string
+	LocalCN  string
+	RemoteCN string
+	Psk      string
+}
+
+// ipsecEapUser is a remote access user authenticated by eap-mschapv2
+type ipsecEapUser struct {
+	Name     string
+	Password string
+}
+
+// renderIpsecConfig renders swanctl.conf and hosts for the ipsec connections of a vpn gw
+func renderIpsecConfig(config ipsecConfig) (map[string]string, error) {
+	advertised, err := config.Advertised()
+	if err != nil {
+		return nil, err
+	}
+	var conf, hosts bytes.Buffer
+	if err := swanctlConfTemplate.Execute(&conf, ipsecConfig{Conns: advertised, RemoteAccess: config.RemoteAccess}); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %v", IpsecSwanctlConfKey, err)
+	}
+	if err := ipsecHostsTemplate.Execute(&hosts, config); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %v", IpsecHostsKey, err)
+	}
+	data := map[string]string{
+		IpsecSwanctlConfKey: conf.String(),
+		IpsecHostsKey:       hosts.String(),
+	}
+	iptables, err := renderIpsecIptables(config.Conns, config.RemoteAccess)
+	if err != nil {
+		return nil, err
+	}
+	data[IpsecIptablesKey] = iptables
+	return data, nil
+}
+
+// renderIpsecSecrets renders the swanctl secrets section for the psk ipsec connections and eap users
+func renderIpsecSecrets(secrets ipsecSecrets) (map[string][]byte, error) {
+	var buf bytes.Buffer
+	if err := ipsecSecretsTemplate.Execute(&buf, secrets); err != nil {
+		return nil, fmt.Errorf("failed to render %s: %v", IpsecSecretsConfKey, err)
+	}
+	data := map[string][]byte{
+		IpsecSecretsConfKey: buf.Bytes(),
+	}
+	for name, ca := range secrets.RemoteCas {
+		data[name+IpsecRemoteCaSuffix] = ca
+	}
+	return data, nil
+}
+
+// reconcileIpsecConfig creates or updates the ipsec configmap and secret of a vpn gw,
+// returns the ipsec connections which are rendered into the configuration
+func (r *VpnGwReconciler) reconcileIpsecConfig(ctx context.Context, gw *vpngwv2.VpnGw, conns []vpngwv2.IpsecConn) ([]vpngwv2.IpsecConn, error) {
+	rendered := []vpngwv2.IpsecConn{}
+	psks := []ipsecPsk{}
+	remoteCas := map[string][]byte{}
+	for _, conn := range conns {
+		if err := validateIpsecTranslation(&conn.Spec); err != nil {
+			r.Log.Error(err, "ignore ipsec connection with invalid translated cidr", "ipsecConn", conn.Name)
+			continue
+		}
+		if conn.Spec.Auth != "psk" {
+			if conn.Spec.RemoteCa != nil {
+				ca, err := r.getIpsecRemoteCa(ctx, &conn)
+				if err != nil {
+					r.Log.Error(err, "ignore ipsec connection without remote ca", "ipsecConn", conn.Name)
+					continue
+				}
+				remoteCas[conn.Name] = ca
+			}
+			rendered = append(rendered, conn)
+			continue
+		}
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: conn.Spec.PskSecret, Namespace: conn.Namespace}, secret)
+		if err != nil {
+			r.Log.Error(err, "ignore ipsec connection without psk secret", "ipsecConn", conn.Name, "secret", conn.Spec.PskSecret)
+			continue
+		}
+		psk, ok := secret.Data[IpsecPskKey]
+		if !ok || len(psk) == 0 {
+			err := fmt.Errorf("psk secret %s has no %s key", conn.Spec.PskSecret, IpsecPskKey)
+			r.Log.Error(err, "ignore ipsec connection without psk", "ipsecConn", conn.Name)
+			continue
+		}
+		psks = append(psks, ipsecPsk{
+			Name:     conn.Name,
+			LocalCN:  conn.Spec.LocalCN,
+			RemoteCN: conn.Spec.RemoteCN,
+			Psk:      string(psk),
+		})
+		rendered = append(rendered, conn)
+	}
+
+	config := ipsecConfig{Conns: rendered}
+	secrets := ipsecSecrets{Psks: psks, RemoteCas: remoteCas}
+	if gw.Spec.IpsecVpn.RemoteAccess != nil {
+		remoteAccess, users, err := r.getIpsecRemoteAccess(ctx, gw)
+		if err != nil {
+			r.Log.Error(err, "failed to get ipsec remote access")
+			return nil, err
+		}
+		config.RemoteAccess = remoteAccess
+		secrets.EapUsers = users
+	}
+	if err := r.reconcileIpsecProfiles(ctx, gw); err != nil {
+		r.Log.Error(err, "failed to reconcile ipsec remote access client profiles")
+		return nil, err
+	}
+	if err := r.reconcileIpsecPeerExport(ctx, gw); err != nil {
+		r.Log.Error(err, "failed to reconcile ipsec peer descriptor")
+		return nil, err
+	}
+
+	data, err := renderIpsecConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gw.Name + IpsecConfigMapSuffix,
+			Namespace: gw.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Labels = labelsForVpnGw(gw)
+		cm.Data = data
+		return controllerutil.SetControllerReference(gw, cm, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ipsec configmap", "configmap", cm.Name)
+		return nil, err
+	}
+	r.Log.Info("ipsec configmap reconciled", "configmap", cm.Name, "operation", op)
+
+	secretData, err := renderIpsecSecrets(secrets)
+	if err != nil {
+		return nil, err
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gw.Name + IpsecSecretSuffix,
+			Namespace: gw.Namespace,
+		},
+	}
+	op, err = controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = labelsForVpnGw(gw)
+		secret.Data = secretData
+		return controllerutil.SetControllerReference(gw, secret, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ipsec secret", "secret", secret.Name)
+		return nil, err
+	}
+	r.Log.Info("ipsec secret reconciled", "secret", secret.Name, "operation", op)
+	return rendered, nil
+}
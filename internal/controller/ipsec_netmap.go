@@ -0,0 +1,200 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// iptables rules of the ipsec container, applied by iptables-restore --noflush
+	IpsecIptablesKey = "iptables.rules"
+
+	// dedicated nat chains, the ipsec container jumps to them from PREROUTING and POSTROUTING
+	IpsecNetmapPreChain    = "KUBE-COMBO-NETMAP-PRE"
+	IpsecNetmapPostChain   = "KUBE-COMBO-NETMAP-POST"
+	IpsecRemoteAccessChain = "KUBE-COMBO-RW"
+)
+
+// translatePrefix maps the prefix inside from to the same offset inside to,
+// from and to should have the same prefix length
+func translatePrefix(prefix, from, to netip.Prefix) (netip.Prefix, error) {
+	if from.Bits() != to.Bits() {
+		return netip.Prefix{}, fmt.Errorf("prefix length of %s and %s are different", from, to)
+	}
+	if !from.Contains(prefix.Addr()) || prefix.Bits() < from.Bits() {
+		return netip.Prefix{}, fmt.Errorf("%s is not inside %s", prefix, from)
+	}
+	addr := prefix.Addr().As4()
+	base := from.Addr().As4()
+	translated := to.Addr().As4()
+	for i := range addr {
+		translated[i] |= addr[i] ^ base[i]
+	}
+	return netip.PrefixFrom(netip.AddrFrom4(translated), prefix.Bits()), nil
+}
+
+// parseTranslation returns the original and translated cidr of one side of the ipsec connection
+func parseTranslation(side string, selectors []vpngwv2.TrafficSelector, translated string) (netip.Prefix, netip.Prefix, error) {
+	if len(selectors) != 1 {
+		return netip.Prefix{}, netip.Prefix{}, fmt.Errorf("translated %s cidr supports only one %s private cidr", side, side)
+	}
+	from, err := netip.ParsePrefix(selectors[0].Cidr)
+	if err != nil {
+		return netip.Prefix{}, netip.Prefix{}, fmt.Errorf("invalid %s private cidr %q: %v", side, selectors[0].Cidr, err)
+	}
+	to, err := netip.ParsePrefix(translated)
+	if err != nil {
+		return netip.Prefix{}, netip.Prefix{}, fmt.Errorf("invalid translated %s cidr %q: %v", side, translated, err)
+	}
+	if !from.Addr().Is4() || !to.Addr().Is4() {
+		return netip.Prefix{}, netip.Prefix{}, fmt.Errorf("translated %s cidr supports only ipv4", side)
+	}
+	if to.Masked() != to {
+		return netip.Prefix{}, netip.Prefix{}, fmt.Errorf("translated %s cidr %s is not a network address, should be %s", side, to, to.Masked())
+	}
+	if from.Bits() != to.Bits() {
+		return netip.Prefix{}, netip.Prefix{}, fmt.Errorf("translated %s cidr %s should have the same prefix length as %s", side, to, from)
+	}
+	return from, to, nil
+}
+
+// validateIpsecTranslation checks the translated cidrs of the ipsec connection,
+// the local traffic selectors of the children should be inside the translated local private cidr
+func validateIpsecTranslation(spec *vpngwv2.IpsecConnSpec) error {
+	if spec.TranslatedLocalCidr != "" {
+		from, to, err := parseTranslation("local", spec.LocalPrivateCidrs, spec.TranslatedLocalCidr)
+		if err != nil {
+			return err
+		}
+		for _, child := range spec.Children {
+			for _, ts := range child.LocalTs {
+				prefix, err := netip.ParsePrefix(ts.Cidr)
+				if err != nil {
+					return err
+				}
+				if _, err := translatePrefix(prefix, from, to); err != nil {
+					return fmt.Errorf("local ts of child %s can not be translated: %v", child.Name, err)
+				}
+			}
+		}
+	}
+	if spec.TranslatedRemoteCidr != "" {
+		if _, _, err := parseTranslation("remote", spec.RemotePrivateCidrs, spec.TranslatedRemoteCidr); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// translateIpsecConn returns the ipsec connection with the translated local traffic selectors,
+// which are advertised to the remote peer instead of the overlapping ones
+func translateIpsecConn(conn vpngwv2.IpsecConn) (vpngwv2.IpsecConn, error) {
+	if conn.Spec.TranslatedLocalCidr == "" {
+		return conn, nil
+	}
+	translated := *conn.DeepCopy()
+	from, to, err := parseTranslation("local", conn.Spec.LocalPrivateCidrs, conn.Spec.TranslatedLocalCidr)
+	if err != nil {
+		return conn, err
+	}
+	translate := func(selectors []vpngwv2.TrafficSelector) error {
+		for i := range selectors {
+			prefix, err := netip.ParsePrefix(selectors[i].Cidr)
+			if err != nil {
+				return err
+			}
+			prefix, err = translatePrefix(prefix, from, to)
+			if err != nil {
+				return err
+			}
+			selectors[i].Cidr = prefix.String()
+		}
+		return nil
+	}
+	if err := translate(translated.Spec.LocalPrivateCidrs); err != nil {
+		return conn, err
+	}
+	for i := range translated.Spec.Children {
+		if err := translate(translated.Spec.Children[i].LocalTs); err != nil {
+			return conn, err
+		}
+	}
+	return translated, nil
+}
+
+// renderIpsecIptables renders the nat rules of the ipsec container in iptables-restore format,
+// declaring a chain with --noflush flushes it, so the rules are replaced as a whole
+func renderIpsecIptables(conns []vpngwv2.IpsecConn, remoteAccess *ipsecRemoteAccess) (string, error) {
+	pre := []string{}
+	post := []string{}
+	for _, conn := range conns {
+		comment := fmt.Sprintf("-m comment --comment %q", "ipsec connection "+conn.Name)
+		remotes := []string{}
+		for _, ts := range conn.Spec.RemotePrivateCidrs {
+			remotes = append(remotes, ts.Cidr)
+		}
+		// destinations before translation tell the direction of a connection in POSTROUTING,
+		// once its destination has been translated in PREROUTING
+		peerDsts := []string{}
+		for _, ts := range conn.Spec.LocalPrivateCidrs {
+			peerDsts = append(peerDsts, ts.Cidr)
+		}
+		if conn.Spec.TranslatedLocalCidr != "" {
+			peerDsts = []string{conn.Spec.TranslatedLocalCidr}
+		}
+
+		if conn.Spec.TranslatedLocalCidr != "" {
+			local, translated, err := parseTranslation("local", conn.Spec.LocalPrivateCidrs, conn.Spec.TranslatedLocalCidr)
+			if err != nil {
+				return "", err
+			}
+			for _, remote := range remotes {
+				vpcDst := remote
+				if conn.Spec.TranslatedRemoteCidr != "" {
+					vpcDst = conn.Spec.TranslatedRemoteCidr
+				}
+				// vpc to remote: the remote peer sees the translated local cidr
+				post = append(post, fmt.Sprintf("-A %s -s %s -d %s -m conntrack --ctorigdst %s %s -j NETMAP --to %s",
+					IpsecNetmapPostChain, local, remote, vpcDst, comment, translated))
+				// remote to vpc: the remote peer accesses the translated local cidr
+				pre = append(pre, fmt.Sprintf("-A %s -s %s -d %s %s -j NETMAP --to %s",
+					IpsecNetmapPreChain, remote, translated, comment, local))
+			}
+		}
+		if conn.Spec.TranslatedRemoteCidr != "" {
+			remote, translated, err := parseTranslation("remote", conn.Spec.RemotePrivateCidrs, conn.Spec.TranslatedRemoteCidr)
+			if err != nil {
+				return "", err
+			}
+			// vpc to remote: the vpc accesses the translated remote cidr
+			pre = append(pre, fmt.Sprintf("-A %s -d %s %s -j NETMAP --to %s",
+				IpsecNetmapPreChain, translated, comment, remote))
+			// remote to vpc: the vpc sees the translated remote cidr
+			for _, dst := range peerDsts {
+				post = append(post, fmt.Sprintf("-A %s -s %s -m conntrack --ctorigdst %s %s -j NETMAP --to %s",
+					IpsecNetmapPostChain, remote, dst, comment, translated))
+			}
+		}
+	}
+
+	var b strings.Builder
+	b.WriteString("*nat\n")
+	fmt.Fprintf(&b, ":%s - [0:0]\n", IpsecNetmapPreChain)
+	fmt.Fprintf(&b, ":%s - [0:0]\n", IpsecNetmapPostChain)
+	fmt.Fprintf(&b, ":%s - [0:0]\n", IpsecRemoteAccessChain)
+	for _, rule := range pre {
+		b.WriteString(rule + "\n")
+	}
+	for _, rule := range post {
+		b.WriteString(rule + "\n")
+	}
+	if remoteAccess != nil {
+		// remote access clients virtual ips are masqueraded
+		fmt.Fprintf(&b, "-A %s -s %s -j MASQUERADE\n", IpsecRemoteAccessChain, remoteAccess.PoolCidr)
+	}
+	b.WriteString("COMMIT\n")
+	return b.String(), nil
+}
@@ -0,0 +1,251 @@
+package controller
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// exported peer descriptor of the ipsec vpn
+	IpsecPeerConfigMapSuffix = "-ipsec-peer"
+	IpsecPeerDescriptorKey   = "peer.json"
+	IpsecPeerSignatureKey    = "peer.sig"
+	IpsecPeerCertKey         = "peer.crt"
+
+	// certificate and private key of the ipsec vpn secret
+	IpsecCertKey       = "tls.crt"
+	IpsecPrivateKeyKey = "tls.key"
+
+	// label of the imported peer descriptor configmap, the value is the local vpn gw name
+	IpsecPeerImportLabel = "ipsec-peer-import"
+)
+
+// ipsecPeerDescriptor is everything a peer needs to create the matching ipsec connection
+type ipsecPeerDescriptor struct {
+	PublicIp string                    `json:"publicIp"`
+	CN       string                    `json:"cn"`
+	Ca       string                    `json:"ca"`
+	Cidrs    []vpngwv2.TrafficSelector `json:"cidrs"`
+}
+
+func parseCertificate(data []byte) (*x509.Certificate, error) {
+	block, _ := pem.Decode(data)
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("no pem encoded certificate")
+	}
+	return x509.ParseCertificate(block.Bytes)
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no pem encoded private key")
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %v", err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("unsupported private key type %T", key)
+	}
+	return signer, nil
+}
+
+// signIpsecPeerDescriptor signs the descriptor with the ipsec vpn private key
+func signIpsecPeerDescriptor(descriptor []byte, key crypto.Signer) ([]byte, error) {
+	if _, ok := key.(ed25519.PrivateKey); ok {
+		return key.Sign(rand.Reader, descriptor, crypto.Hash(0))
+	}
+	digest := sha256.Sum256(descriptor)
+	return key.Sign(rand.Reader, digest[:], crypto.SHA256)
+}
+
+func verifySignature(descriptor, signature []byte, cert *x509.Certificate) error {
+	digest := sha256.Sum256(descriptor)
+	switch pub := cert.PublicKey.(type) {
+	case *rsa.PublicKey:
+		return rsa.VerifyPKCS1v15(pub, crypto.SHA256, digest[:], signature)
+	case *ecdsa.PublicKey:
+		if !ecdsa.VerifyASN1(pub, digest[:], signature) {
+			return errors.New("ecdsa signature mismatch")
+		}
+		return nil
+	case ed25519.PublicKey:
+		if !ed25519.Verify(pub, descriptor, signature) {
+			return errors.New("ed25519 signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
+
+// verifyIpsecPeerDescriptor checks the ca in the descriptor is trusted by the importing vpn gw,
+// the peer certificate is issued by the trusted ca for its cn, and the descriptor is signed by the peer certificate key
+func verifyIpsecPeerDescriptor(data map[string]string, trustedCa []byte) (*ipsecPeerDescriptor, error) {
+	raw, ok := data[IpsecPeerDescriptorKey]
+	if !ok {
+		return nil, fmt.Errorf("peer descriptor has no %s key", IpsecPeerDescriptorKey)
+	}
+	descriptor := &ipsecPeerDescriptor{}
+	if err := json.Unmarshal([]byte(raw), descriptor); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", IpsecPeerDescriptorKey, err)
+	}
+	if descriptor.PublicIp == "" || descriptor.CN == "" || len(descriptor.Cidrs) == 0 {
+		return nil, fmt.Errorf("peer descriptor public ip, cn and cidrs are required")
+	}
+	for _, ts := range descriptor.Cidrs {
+		if err := ts.Validate(); err != nil {
+			return nil, fmt.Errorf("invalid peer descriptor cidr: %v", err)
+		}
+	}
+	cert, err := parseCertificate([]byte(data[IpsecPeerCertKey]))
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", IpsecPeerCertKey, err)
+	}
+	// the descriptor is written by the peer, its ca is not a trust anchor by itself
+	trusted := parseCertificates(trustedCa)
+	if len(trusted) == 0 {
+		return nil, fmt.Errorf("no trusted peer ca")
+	}
+	cas := parseCertificates([]byte(descriptor.Ca))
+	if len(cas) == 0 {
+		return nil, fmt.Errorf("peer descriptor has no valid ca")
+	}
+	roots := x509.NewCertPool()
+	for _, ca := range cas {
+		found := false
+		for _, t := range trusted {
+			if ca.Equal(t) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("peer ca %s is not trusted", ca.Subject.String())
+		}
+		roots.AddCert(ca)
+	}
+	_, err = cert.Verify(x509.VerifyOptions{
+		Roots:     roots,
+		KeyUsages: []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("peer certificate is not issued by the trusted peer ca: %v", err)
+	}
+	if cert.Subject.CommonName != descriptor.CN {
+		return nil, fmt.Errorf("peer certificate cn %s mismatches the descriptor cn %s", cert.Subject.CommonName, descriptor.CN)
+	}
+	signature, err := base64.StdEncoding.DecodeString(data[IpsecPeerSignatureKey])
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", IpsecPeerSignatureKey, err)
+	}
+	if err := verifySignature([]byte(raw), signature, cert); err != nil {
+		return nil, fmt.Errorf("invalid peer descriptor signature: %v", err)
+	}
+	return descriptor, nil
+}
+
+// getIpsecIdentity returns the ipsec vpn secret and its certificate, the cn of which identifies the vpn gw
+func getIpsecIdentity(ctx context.Context, c client.Reader, gw *vpngwv2.VpnGw) (*corev1.Secret, *x509.Certificate, error) {
+	secret := &corev1.Secret{}
+	err := c.Get(ctx, types.NamespacedName{Name: gw.Spec.IpsecVpn.IpsecSecret, Namespace: gw.Namespace}, secret)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get ipsec vpn secret %s: %v", gw.Spec.IpsecVpn.IpsecSecret, err)
+	}
+	cert, err := parseCertificate(secret.Data[IpsecCertKey])
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s of ipsec vpn secret %s: %v", IpsecCertKey, secret.Name, err)
+	}
+	return secret, cert, nil
+}
+
+// reconcileIpsecPeerExport creates or updates the signed peer descriptor configmap of the vpn gw,
+// and deletes it once the export is disabled
+func (r *VpnGwReconciler) reconcileIpsecPeerExport(ctx context.Context, gw *vpngwv2.VpnGw) error {
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gw.Name + IpsecPeerConfigMapSuffix,
+			Namespace: gw.Namespace,
+		},
+	}
+	export := gw.Spec.IpsecVpn.PeerExport
+	if export == nil {
+		err := r.Delete(ctx, cm)
+		if err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to delete ipsec peer configmap", "configmap", cm.Name)
+			return err
+		}
+		return nil
+	}
+
+	secret, cert, err := getIpsecIdentity(ctx, r.Client, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get ipsec vpn identity")
+		return err
+	}
+	descriptor, err := json.MarshalIndent(ipsecPeerDescriptor{
+		PublicIp: gw.Spec.PublicEndpoint.Ip,
+		CN:       cert.Subject.CommonName,
+		Ca:       string(secret.Data[IpsecCaKey]),
+		Cidrs:    export.Cidrs,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to render %s: %v", IpsecPeerDescriptorKey, err)
+	}
+	certPem := string(secret.Data[IpsecCertKey])
+
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Labels = labelsForVpnGw(gw)
+		// ecdsa signatures are randomized, keep the signature as long as the descriptor is unchanged
+		if cm.Data[IpsecPeerDescriptorKey] != string(descriptor) || cm.Data[IpsecPeerCertKey] != certPem {
+			key, err := parsePrivateKey(secret.Data[IpsecPrivateKeyKey])
+			if err != nil {
+				return fmt.Errorf("invalid %s of ipsec vpn secret %s: %v", IpsecPrivateKeyKey, secret.Name, err)
+			}
+			signature, err := signIpsecPeerDescriptor(descriptor, key)
+			if err != nil {
+				return fmt.Errorf("failed to sign %s: %v", IpsecPeerDescriptorKey, err)
+			}
+			cm.Data = map[string]string{
+				IpsecPeerDescriptorKey: string(descriptor),
+				IpsecPeerSignatureKey:  base64.StdEncoding.EncodeToString(signature),
+				IpsecPeerCertKey:       certPem,
+			}
+		}
+		return controllerutil.SetControllerReference(gw, cm, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ipsec peer configmap", "configmap", cm.Name)
+		return err
+	}
+	r.Log.Info("ipsec peer configmap reconciled", "configmap", cm.Name, "operation", op)
+	return nil
+}
@@ -0,0 +1,223 @@
+package controller
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"math/big"
+	"strings"
+	"testing"
+	"time"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+type testPki struct {
+	caKey  crypto.Signer
+	ca     *x509.Certificate
+	caPem  []byte
+	newKey func() crypto.Signer
+}
+
+func newTestKeyFunc(t *testing.T, alg string) func() crypto.Signer {
+	return func() crypto.Signer {
+		var key crypto.Signer
+		var err error
+		switch alg {
+		case "rsa":
+			key, err = rsa.GenerateKey(rand.Reader, 2048)
+		case "ecdsa":
+			key, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		case "ed25519":
+			_, key, err = ed25519.GenerateKey(rand.Reader)
+		}
+		if err != nil {
+			t.Fatalf("failed to generate %s key: %v", alg, err)
+		}
+		return key
+	}
+}
+
+func createTestCert(t *testing.T, template, parent *x509.Certificate, pub crypto.PublicKey, signer crypto.Signer) (*x509.Certificate, []byte) {
+	t.Helper()
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, pub, signer)
+	if err != nil {
+		t.Fatalf("failed to create certificate: %v", err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatalf("failed to parse certificate: %v", err)
+	}
+	return cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}
+
+func newTestPki(t *testing.T, alg, cn string) *testPki {
+	newKey := newTestKeyFunc(t, alg)
+	key := newKey()
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: cn},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageCertSign,
+	}
+	ca, caPem := createTestCert(t, template, template, key.Public(), key)
+	return &testPki{caKey: key, ca: ca, caPem: caPem, newKey: newKey}
+}
+
+// issue returns a certificate of the cn issued by the ca and its key
+func (p *testPki) issue(t *testing.T, cn string) ([]byte, crypto.Signer) {
+	key := p.newKey()
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(2),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	_, certPem := createTestCert(t, template, p.ca, key.Public(), p.caKey)
+	return certPem, key
+}
+
+// newTestPeerDescriptor returns the descriptor data signed by the key
+func newTestPeerDescriptor(t *testing.T, descriptor ipsecPeerDescriptor, certPem []byte, key crypto.Signer) map[string]string {
+	raw, err := json.MarshalIndent(descriptor, "", "  ")
+	if err != nil {
+		t.Fatalf("failed to marshal descriptor: %v", err)
+	}
+	signature, err := signIpsecPeerDescriptor(raw, key)
+	if err != nil {
+		t.Fatalf("failed to sign descriptor: %v", err)
+	}
+	return map[string]string{
+		IpsecPeerDescriptorKey: string(raw),
+		IpsecPeerSignatureKey:  base64.StdEncoding.EncodeToString(signature),
+		IpsecPeerCertKey:       string(certPem),
+	}
+}
+
+func TestVerifyIpsecPeerDescriptor(t *testing.T) {
+	for _, alg := range []string{"rsa", "ecdsa", "ed25519"} {
+		t.Run(alg, func(t *testing.T) {
+			peerPki := newTestPki(t, alg, "moon-ca")
+			otherPki := newTestPki(t, alg, "evil-ca")
+			certPem, key := peerPki.issue(t, "moon")
+			otherCertPem, otherKey := otherPki.issue(t, "moon")
+			descriptor := ipsecPeerDescriptor{
+				PublicIp: "192.0.2.2",
+				CN:       "moon",
+				Ca:       string(peerPki.caPem),
+				Cidrs:    []vpngwv2.TrafficSelector{{Cidr: "10.2.0.0/24"}},
+			}
+
+			tests := []struct {
+				name    string
+				data    func() map[string]string
+				trusted []byte
+				err     string
+			}{
+				{
+					name:    "trusted",
+					data:    func() map[string]string { return newTestPeerDescriptor(t, descriptor, certPem, key) },
+					trusted: peerPki.caPem,
+				},
+				{
+					name:    "trusted among several cas",
+					data:    func() map[string]string { return newTestPeerDescriptor(t, descriptor, certPem, key) },
+					trusted: append(append([]byte{}, otherPki.caPem...), peerPki.caPem...),
+				},
+				{
+					name:    "untrusted ca",
+					data:    func() map[string]string { return newTestPeerDescriptor(t, descriptor, certPem, key) },
+					trusted: otherPki.caPem,
+					err:     "is not trusted",
+				},
+				{
+					name: "self declared ca",
+					data: func() map[string]string {
+						d := descriptor
+						d.Ca = string(otherPki.caPem)
+						return newTestPeerDescriptor(t, d, otherCertPem, otherKey)
+					},
+					trusted: peerPki.caPem,
+					err:     "is not trusted",
+				},
+				{
+					name:    "certificate of another ca",
+					data:    func() map[string]string { return newTestPeerDescriptor(t, descriptor, otherCertPem, otherKey) },
+					trusted: peerPki.caPem,
+					err:     "not issued by the trusted peer ca",
+				},
+				{
+					name: "cn mismatch",
+					data: func() map[string]string {
+						d := descriptor
+						d.CN = "sun"
+						return newTestPeerDescriptor(t, d, certPem, key)
+					},
+					trusted: peerPki.caPem,
+					err:     "mismatches the descriptor cn",
+				},
+				{
+					name: "tampered descriptor",
+					data: func() map[string]string {
+						data := newTestPeerDescriptor(t, descriptor, certPem, key)
+						data[IpsecPeerDescriptorKey] = strings.Replace(data[IpsecPeerDescriptorKey], "10.2.0.0/24", "0.0.0.0/0", 1)
+						return data
+					},
+					trusted: peerPki.caPem,
+					err:     "invalid peer descriptor signature",
+				},
+				{
+					name:    "signed by another key",
+					data:    func() map[string]string { return newTestPeerDescriptor(t, descriptor, certPem, otherKey) },
+					trusted: peerPki.caPem,
+					err:     "invalid peer descriptor signature",
+				},
+				{
+					name: "malformed signature",
+					data: func() map[string]string {
+						data := newTestPeerDescriptor(t, descriptor, certPem, key)
+						data[IpsecPeerSignatureKey] = "not base64"
+						return data
+					},
+					trusted: peerPki.caPem,
+					err:     "invalid " + IpsecPeerSignatureKey,
+				},
+				{
+					name:    "no trusted ca",
+					data:    func() map[string]string { return newTestPeerDescriptor(t, descriptor, certPem, key) },
+					trusted: nil,
+					err:     "no trusted peer ca",
+				},
+			}
+			for _, tt := range tests {
+				t.Run(tt.name, func(t *testing.T) {
+					peer, err := verifyIpsecPeerDescriptor(tt.data(), tt.trusted)
+					if tt.err == "" {
+						if err != nil {
+							t.Fatalf("expected trusted, got %v", err)
+						}
+						if peer.CN != "moon" || peer.PublicIp != "192.0.2.2" {
+							t.Errorf("unexpected peer %+v", peer)
+						}
+						return
+					}
+					if err == nil || !strings.Contains(err.Error(), tt.err) {
+						t.Errorf("expected error containing %q, got %v", tt.err, err)
+					}
+				})
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+package controller
+
+import (
+	"fmt"
+	"strings"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+// DefaultIpsecDeniedAlgorithms are the weak algorithms rejected by default
+const DefaultIpsecDeniedAlgorithms = "des,3des,blowfish,md5,md5_128,sha1,sha1_160,prfmd5,prfsha1,modp768,modp1024,modp1024s160,modp1536"
+
+// IpsecAlgorithmPolicy is the cluster wide policy for the proposals and ike version of ipsec connections
+type IpsecAlgorithmPolicy struct {
+	// algorithm keywords which are not allowed
+	DeniedAlgorithms map[string]bool
+	// IKEv1 is not allowed unless explicitly allowed
+	AllowIkeV1 bool
+}
+
+// NewIpsecAlgorithmPolicy builds the policy from comma separated denied and allowed algorithms,
+// the allowed algorithms are removed from the denied ones, aliases are resolved so that eg: sha is denied along with sha1
+func NewIpsecAlgorithmPolicy(denied, allowed string, allowIkeV1 bool) *IpsecAlgorithmPolicy {
+	policy := &IpsecAlgorithmPolicy{
+		DeniedAlgorithms: map[string]bool{},
+		AllowIkeV1:       allowIkeV1,
+	}
+	for _, algorithm := range strings.Split(denied, ",") {
+		if algorithm = strings.TrimSpace(algorithm); algorithm != "" {
+			policy.DeniedAlgorithms[vpngwv2.CanonicalProposalKeyword(algorithm)] = true
+		}
+	}
+	for _, algorithm := range strings.Split(allowed, ",") {
+		delete(policy.DeniedAlgorithms, vpngwv2.CanonicalProposalKeyword(strings.TrimSpace(algorithm)))
+	}
+	return policy
+}
+
+// Check returns an error describing all violations of the ipsec connection, nil policy allows everything
+func (p *IpsecAlgorithmPolicy) Check(spec *vpngwv2.IpsecConnSpec) error {
+	if p == nil {
+		return nil
+	}
+	violations := []string{}
+	if !p.AllowIkeV1 && (spec.IkeVersion == "0" || spec.IkeVersion == "1") {
+		violations = append(violations, fmt.Sprintf("ike version %s allows IKEv1", spec.IkeVersion))
+	}
+	violations = append(violations, p.checkProposals("ike proposals", spec.IkeProposals)...)
+	for _, child := range spec.EffectiveChildren() {
+		violations = append(violations, p.checkProposals("esp proposals of child "+child.Name, child.EspProposals)...)
+	}
+	if len(violations) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%s", strings.Join(violations, "; "))
+}
+
+// AllowedProposals returns the proposals which do not use any denied algorithm, nil policy allows everything
+func (p *IpsecAlgorithmPolicy) AllowedProposals(proposals []string) []string {
+	allowed := []string{}
+	for _, proposal := range proposals {
+		if p == nil || len(p.checkProposals("proposal", proposal)) == 0 {
+			allowed = append(allowed, proposal)
+		}
+	}
+	return allowed
+}
+
+func (p *IpsecAlgorithmPolicy) checkProposals(name, value string) []string {
+	proposals, err := vpngwv2.ParseProposals(value)
+	if err != nil {
+		return []string{fmt.Sprintf("invalid %s: %v", name, err)}
+	}
+	violations := []string{}
+	for _, proposal := range proposals {
+		for _, keyword := range proposal {
+			if p.DeniedAlgorithms[vpngwv2.CanonicalProposalKeyword(keyword)] {
+				violations = append(violations, fmt.Sprintf("%s uses weak algorithm %s", name, keyword))
+			}
+		}
+	}
+	return violations
+}
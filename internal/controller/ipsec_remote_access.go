@@ -0,0 +1,530 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"encoding/xml"
+	"fmt"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/google/uuid"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// generated client profiles of the IKEv2 remote access
+	IpsecProfilesSecretSuffix = "-ipsec-profiles"
+	IpsecMobileconfigSuffix   = ".mobileconfig"
+	IpsecSswanSuffix          = ".sswan"
+
+	// ca of the ipsec vpn secret, trusted by the clients
+	IpsecCaKey = "ca.crt"
+)
+
+// apple configuration profile with an IKEv2 vpn payload and the ca payload
+// reference to: https://developer.apple.com/documentation/devicemanagement/vpn/ikev2
+var mobileconfigTemplate = template.Must(template.New(IpsecMobileconfigSuffix).Funcs(template.FuncMap{
+	"xml": xmlEscape,
+}).Parse(`<?xml version="1.0" encoding="UTF-8"?>
+<!DOCTYPE plist PUBLIC "-//Apple//DTD PLIST 1.0//EN" "http://www.apple.com/DTDs/PropertyList-1.0.dtd">
+<plist version="1.0">
+<dict>
+    <key>PayloadContent</key>
+    <array>
+        <dict>
+            <key>IKEv2</key>
+            <dict>
+                <key>RemoteAddress</key>
+                <string>{{ xml .Server }}</string>
+                <key>RemoteIdentifier</key>
+                <string>{{ xml .ServerId }}</string>
+                <key>LocalIdentifier</key>
+                <string>{{ xml .LocalId }}</string>
+{{- if .Pkcs12 }}
+                <key>AuthenticationMethod</key>
+                <string>Certificate</string>
+                <key>PayloadCertificateUUID</key>
+                <string>{{ .Pkcs12UUID }}</string>
+{{- else }}
+                <key>AuthenticationMethod</key>
+                <string>None</string>
+{{- end }}
+                <key>ExtendedAuthEnabled</key>
+                <integer>1</integer>
+                <key>DeadPeerDetectionRate</key>
+                <string>Medium</string>
+                <key>IKESecurityAssociationParameters</key>
+                <dict>
+                    <key>EncryptionAlgorithm</key>
+                    <string>{{ .IkeSa.EncryptionAlgorithm }}</string>
+                    <key>IntegrityAlgorithm</key>
+                    <string>{{ .IkeSa.IntegrityAlgorithm }}</string>
+                    <key>DiffieHellmanGroup</key>
+                    <integer>{{ .IkeSa.DiffieHellmanGroup }}</integer>
+                </dict>
+                <key>ChildSecurityAssociationParameters</key>
+                <dict>
+                    <key>EncryptionAlgorithm</key>
+                    <string>{{ .ChildSa.EncryptionAlgorithm }}</string>
+{{- if .ChildSa.IntegrityAlgorithm }}
+                    <key>IntegrityAlgorithm</key>
+                    <string>{{ .ChildSa.IntegrityAlgorithm }}</string>
+{{- end }}
+                    <key>DiffieHellmanGroup</key>
+                    <integer>{{ .ChildSa.DiffieHellmanGroup }}</integer>
+                </dict>
+            </dict>
+{{- if .FullTunnel }}
+            <key>IPv4</key>
+            <dict>
+                <key>OverridePrimary</key>
+                <integer>1</integer>
+            </dict>
+{{- end }}
+            <key>PayloadDisplayName</key>
+            <string>{{ xml .Name }}</string>
+            <key>PayloadIdentifier</key>
+            <string>com.kube-combo.vpn.{{ xml .Name }}</string>
+            <key>PayloadType</key>
+            <string>com.apple.vpn.managed</string>
+            <key>PayloadUUID</key>
+            <string>{{ .VpnUUID }}</string>
+            <key>PayloadVersion</key>
+            <integer>1</integer>
+            <key>UserDefinedName</key>
+            <string>{{ xml .Name }}</string>
+            <key>VPNType</key>
+            <string>IKEv2</string>
+        </dict>
+{{- if .Ca }}
+        <dict>
+            <key>PayloadCertificateFileName</key>
+            <string>ca.crt</string>
+            <key>PayloadContent</key>
+            <data>{{ .Ca }}</data>
+            <key>PayloadDisplayName</key>
+            <string>{{ xml .Name }} ca</string>
+            <key>PayloadIdentifier</key>
+            <string>com.kube-combo.vpn.{{ xml .Name }}.ca</string>
+            <key>PayloadType</key>
+            <string>com.apple.security.root</string>
+            <key>PayloadUUID</key>
+            <string>{{ .CaUUID }}</string>
+            <key>PayloadVersion</key>
+            <integer>1</integer>
+        </dict>
+{{- end }}
+{{- if .Pkcs12 }}
+        <dict>
+            <key>PayloadCertificateFileName</key>
+            <string>{{ xml .LocalId }}.p12</string>
+            <key>PayloadContent</key>
+            <data>{{ .Pkcs12 }}</data>
+            <key>PayloadDisplayName</key>
+            <string>{{ xml .LocalId }}</string>
+            <key>PayloadIdentifier</key>
+            <string>com.kube-combo.vpn.{{ xml .Name }}.{{ xml .LocalId }}</string>
+            <key>PayloadType</key>
+            <string>com.apple.security.pkcs12</string>
+            <key>PayloadUUID</key>
+            <string>{{ .Pkcs12UUID }}</string>
+            <key>PayloadVersion</key>
+            <integer>1</integer>
+        </dict>
+{{- end }}
+    </array>
+    <key>PayloadDisplayName</key>
+    <string>{{ xml .Name }}</string>
+    <key>PayloadIdentifier</key>
+    <string>com.kube-combo.{{ xml .Name }}</string>
+    <key>PayloadType</key>
+    <string>Configuration</string>
+    <key>PayloadUUID</key>
+    <string>{{ .ProfileUUID }}</string>
+    <key>PayloadVersion</key>
+    <integer>1</integer>
+</dict>
+</plist>
+`))
+
+// IpsecClientCertSuffix is the suffix of the PKCS#12 bundles in the eap-tls client certs secret
+const IpsecClientCertSuffix = ".p12"
+
+// proposals offered to the remote access clients in order of preference, supported by apple, windows and the strongSwan android app,
+// the ones denied by the algorithm policy are not rendered
+var (
+	ipsecRemoteAccessIkeProposals = []string{
+		"aes256gcm16-prfsha384-ecp384",
+		"aes256-sha384-ecp384",
+		"aes256-sha256-modp2048",
+		"aes128gcm16-prfsha256-ecp256",
+		"aes128-sha256-modp2048",
+	}
+	ipsecRemoteAccessEspProposals = []string{
+		"aes256gcm16-ecp384",
+		"aes256-sha384-ecp384",
+		"aes256-sha256-modp2048",
+		"aes128gcm16-ecp256",
+		"aes128-sha256-modp2048",
+	}
+)
+
+// algorithm keywords in the apple IKEv2 security association parameters
+var (
+	appleEncryptionAlgorithms = map[string]string{
+		"aes128":           "AES-128",
+		"aes256":           "AES-256",
+		"aes128gcm16":      "AES-128-GCM",
+		"aes256gcm16":      "AES-256-GCM",
+		"chacha20poly1305": "ChaCha20Poly1305",
+	}
+	appleIntegrityAlgorithms = map[string]string{
+		"sha256":    "SHA2-256",
+		"sha384":    "SHA2-384",
+		"sha512":    "SHA2-512",
+		"prfsha256": "SHA2-256",
+		"prfsha384": "SHA2-384",
+		"prfsha512": "SHA2-512",
+	}
+	appleDiffieHellmanGroups = map[string]int{
+		"modp2048":   14,
+		"modp3072":   15,
+		"modp4096":   16,
+		"ecp256":     19,
+		"ecp384":     20,
+		"ecp521":     21,
+		"curve25519": 31,
+	}
+)
+
+// appleSaParameters is the IKE or child security association parameters of the apple configuration profile
+type appleSaParameters struct {
+	EncryptionAlgorithm string
+	IntegrityAlgorithm  string
+	DiffieHellmanGroup  int
+}
+
+// newAppleSaParameters translates a strongSwan proposal into the apple parameters, returns false if apple does not support it
+func newAppleSaParameters(proposal string) (appleSaParameters, bool) {
+	params := appleSaParameters{}
+	proposals, err := vpngwv2.ParseProposals(proposal)
+	if err != nil || len(proposals) != 1 {
+		return params, false
+	}
+	for _, keyword := range proposals[0] {
+		keyword = vpngwv2.CanonicalProposalKeyword(keyword)
+		if v, ok := appleEncryptionAlgorithms[keyword]; ok {
+			params.EncryptionAlgorithm = v
+		} else if v, ok := appleIntegrityAlgorithms[keyword]; ok {
+			params.IntegrityAlgorithm = v
+		} else if v, ok := appleDiffieHellmanGroups[keyword]; ok {
+			params.DiffieHellmanGroup = v
+		} else {
+			return params, false
+		}
+	}
+	return params, params.EncryptionAlgorithm != "" && params.DiffieHellmanGroup != 0
+}
+
+// firstAppleSaParameters returns the apple parameters of the first proposal supported by apple
+func firstAppleSaParameters(proposals []string) (appleSaParameters, error) {
+	for _, proposal := range proposals {
+		if params, ok := newAppleSaParameters(proposal); ok {
+			return params, nil
+		}
+	}
+	return appleSaParameters{}, fmt.Errorf("none of the proposals %s is supported by apple clients", strings.Join(proposals, ","))
+}
+
+// mobileconfig is the data to render the apple configuration profile
+type mobileconfig struct {
+	Name        string
+	Server      string
+	ServerId    string
+	FullTunnel  bool
+	Ca          string
+	IkeSa       appleSaParameters
+	ChildSa     appleSaParameters
+	ProfileUUID string
+	VpnUUID     string
+	CaUUID      string
+	// eap-tls identity and its base64 encoded PKCS#12 bundle, eap-mschapv2 asks the user name and password instead
+	LocalId    string
+	Pkcs12     string
+	Pkcs12UUID string
+}
+
+// sswanProfile is the strongSwan android app profile
+// reference to: https://docs.strongswan.org/docs/5.9/os/androidVpnClientProfiles.html
+type sswanProfile struct {
+	UUID           string               `json:"uuid"`
+	Name           string               `json:"name"`
+	Type           string               `json:"type"`
+	Remote         sswanRemote          `json:"remote"`
+	Local          *sswanLocal          `json:"local,omitempty"`
+	SplitTunneling *sswanSplitTunneling `json:"split-tunneling,omitempty"`
+}
+
+type sswanLocal struct {
+	P12 string `json:"p12,omitempty"`
+}
+
+type sswanRemote struct {
+	Addr string `json:"addr"`
+	ID   string `json:"id,omitempty"`
+	Cert string `json:"cert,omitempty"`
+}
+
+type sswanSplitTunneling struct {
+	Subnets string `json:"subnets,omitempty"`
+}
+
+func xmlEscape(s string) (string, error) {
+	var buf bytes.Buffer
+	if err := xml.EscapeText(&buf, []byte(s)); err != nil {
+		return "", err
+	}
+	return buf.String(), nil
+}
+
+// ipsecServerAddr returns how the clients reach the vpn gw, prefer the public hostname
+func ipsecServerAddr(gw *vpngwv2.VpnGw) string {
+	if gw.Spec.PublicEndpoint.Hostname != "" {
+		return gw.Spec.PublicEndpoint.Hostname
+	}
+	return gw.Spec.PublicEndpoint.Ip
+}
+
+// profileUUID returns a stable uuid of the vpn gw, so that the profiles do not change on every reconcile
+func profileUUID(gw *vpngwv2.VpnGw, payload string) string {
+	return strings.ToUpper(uuid.NewSHA1(uuid.NameSpaceURL, []byte(string(gw.UID)+"/"+payload)).String())
+}
+
+// ipsecRemoteAccessProposals returns the ike and esp proposals of the remote access allowed by the algorithm policy
+func (r *VpnGwReconciler) ipsecRemoteAccessProposals() ([]string, []string, error) {
+	ike := r.IpsecPolicy.AllowedProposals(ipsecRemoteAccessIkeProposals)
+	esp := r.IpsecPolicy.AllowedProposals(ipsecRemoteAccessEspProposals)
+	if len(ike) == 0 || len(esp) == 0 {
+		return nil, nil, fmt.Errorf("all the remote access proposals are denied by the ipsec algorithm policy")
+	}
+	return ike, esp, nil
+}
+
+// renderIpsecProfiles renders the apple and strongSwan android client profiles of the remote access,
+// eap-tls renders the profiles of each user in the client certs with the PKCS#12 bundle embedded
+func renderIpsecProfiles(gw *vpngwv2.VpnGw, ca []byte, ikeProposals, espProposals []string, clientCerts map[string][]byte) (map[string][]byte, error) {
+	ra := gw.Spec.IpsecVpn.RemoteAccess
+	name := fmt.Sprintf("%s-%s", gw.Namespace, gw.Name)
+	server := ipsecServerAddr(gw)
+
+	ikeSa, err := firstAppleSaParameters(ikeProposals)
+	if err != nil {
+		return nil, err
+	}
+	childSa, err := firstAppleSaParameters(espProposals)
+	if err != nil {
+		return nil, err
+	}
+	// apple expects the der encoded ca
+	caDer := ""
+	if block, _ := pem.Decode(ca); block != nil {
+		caDer = base64.StdEncoding.EncodeToString(block.Bytes)
+	}
+
+	render := func(user string, p12 []byte) ([]byte, []byte, error) {
+		// the uuids of the user profiles differ, so that the profiles of several users could be installed side by side
+		payload := func(p string) string {
+			if user == "" {
+				return profileUUID(gw, p)
+			}
+			return profileUUID(gw, p+"/"+user)
+		}
+		config := mobileconfig{
+			Name:        name,
+			Server:      server,
+			ServerId:    server,
+			FullTunnel:  len(ra.LocalTs) == 0,
+			Ca:          caDer,
+			IkeSa:       ikeSa,
+			ChildSa:     childSa,
+			ProfileUUID: payload("profile"),
+			VpnUUID:     payload("vpn"),
+			CaUUID:      payload("ca"),
+		}
+		profile := sswanProfile{
+			UUID: strings.ToLower(payload("sswan")),
+			Name: name,
+			Type: "ikev2-eap",
+			Remote: sswanRemote{
+				Addr: server,
+				ID:   server,
+				Cert: base64.StdEncoding.EncodeToString(ca),
+			},
+		}
+		if user != "" {
+			config.LocalId = user
+			config.Pkcs12 = base64.StdEncoding.EncodeToString(p12)
+			config.Pkcs12UUID = payload("pkcs12")
+			profile.Type = "ikev2-eap-tls"
+			profile.Local = &sswanLocal{P12: config.Pkcs12}
+		}
+		if len(ra.LocalTs) != 0 {
+			subnets := []string{}
+			for _, ts := range ra.LocalTs {
+				subnets = append(subnets, ts.Cidr)
+			}
+			profile.SplitTunneling = &sswanSplitTunneling{Subnets: strings.Join(subnets, " ")}
+		}
+
+		var buf bytes.Buffer
+		if err := mobileconfigTemplate.Execute(&buf, config); err != nil {
+			return nil, nil, fmt.Errorf("failed to render %s: %v", IpsecMobileconfigSuffix, err)
+		}
+		sswan, err := json.MarshalIndent(profile, "", "  ")
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to render %s: %v", IpsecSswanSuffix, err)
+		}
+		return buf.Bytes(), sswan, nil
+	}
+
+	profiles := map[string][]byte{}
+	if ra.Auth != IpsecRemoteAccessEapTls {
+		apple, sswan, err := render("", nil)
+		if err != nil {
+			return nil, err
+		}
+		profiles[gw.Name+IpsecMobileconfigSuffix] = apple
+		profiles[gw.Name+IpsecSswanSuffix] = sswan
+		return profiles, nil
+	}
+	for key, p12 := range clientCerts {
+		user := strings.TrimSuffix(key, IpsecClientCertSuffix)
+		if user == key || user == "" {
+			continue
+		}
+		apple, sswan, err := render(user, p12)
+		if err != nil {
+			return nil, err
+		}
+		profiles[fmt.Sprintf("%s-%s%s", gw.Name, user, IpsecMobileconfigSuffix)] = apple
+		profiles[fmt.Sprintf("%s-%s%s", gw.Name, user, IpsecSswanSuffix)] = sswan
+	}
+	return profiles, nil
+}
+
+// getIpsecRemoteAccess returns the remote access connection and the eap-mschapv2 users of a vpn gw
+func (r *VpnGwReconciler) getIpsecRemoteAccess(ctx context.Context, gw *vpngwv2.VpnGw) (*ipsecRemoteAccess, []ipsecEapUser, error) {
+	ra := gw.Spec.IpsecVpn.RemoteAccess
+	remoteAccess := &ipsecRemoteAccess{
+		ServerId: ipsecServerAddr(gw),
+		Auth:     ra.Auth,
+		PoolCidr: ra.PoolCidr,
+		Dns:      strings.Join(ra.Dns, ","),
+		LocalTs:  vpngwv2.FormatTrafficSelectors(ra.LocalTs),
+	}
+	if remoteAccess.LocalTs == "" {
+		remoteAccess.LocalTs = "0.0.0.0/0"
+	}
+	ike, esp, err := r.ipsecRemoteAccessProposals()
+	if err != nil {
+		return nil, nil, err
+	}
+	remoteAccess.IkeProposals = strings.Join(ike, ",")
+	remoteAccess.EspProposals = strings.Join(esp, ",")
+	if ra.Auth != IpsecRemoteAccessMschapV2 {
+		return remoteAccess, nil, nil
+	}
+
+	secret := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: ra.UsersSecret, Namespace: gw.Namespace}, secret)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to get remote access users secret %s: %v", ra.UsersSecret, err)
+	}
+	users := make([]ipsecEapUser, 0, len(secret.Data))
+	for name, password := range secret.Data {
+		users = append(users, ipsecEapUser{Name: name, Password: string(password)})
+	}
+	// keep the rendered secrets stable
+	sort.Slice(users, func(i, j int) bool {
+		return users[i].Name < users[j].Name
+	})
+	return remoteAccess, users, nil
+}
+
+// reconcileIpsecProfiles creates or updates the client profiles secret of the remote access,
+// and deletes it once the remote access is disabled
+func (r *VpnGwReconciler) reconcileIpsecProfiles(ctx context.Context, gw *vpngwv2.VpnGw) error {
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gw.Name + IpsecProfilesSecretSuffix,
+			Namespace: gw.Namespace,
+		},
+	}
+	if gw.Spec.IpsecVpn.RemoteAccess == nil {
+		// only the secret generated for this vpn gw is deleted
+		err := r.Get(ctx, client.ObjectKeyFromObject(secret), secret)
+		if err != nil {
+			if apierrors.IsNotFound(err) {
+				return nil
+			}
+			r.Log.Error(err, "failed to get ipsec profiles secret", "secret", secret.Name)
+			return err
+		}
+		if owner := metav1.GetControllerOf(secret); owner == nil || owner.UID != gw.UID {
+			return nil
+		}
+		if err := r.Delete(ctx, secret); err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to delete ipsec profiles secret", "secret", secret.Name)
+			return err
+		}
+		return nil
+	}
+
+	ipsecSecret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: gw.Spec.IpsecVpn.IpsecSecret, Namespace: gw.Namespace}, ipsecSecret)
+	if err != nil {
+		r.Log.Error(err, "failed to get ipsec vpn secret", "secret", gw.Spec.IpsecVpn.IpsecSecret)
+		return err
+	}
+	var clientCerts map[string][]byte
+	if ra := gw.Spec.IpsecVpn.RemoteAccess; ra.Auth == IpsecRemoteAccessEapTls {
+		certs := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: ra.ClientCertsSecret, Namespace: gw.Namespace}, certs); err != nil {
+			r.Log.Error(err, "failed to get ipsec remote access client certs secret", "secret", ra.ClientCertsSecret)
+			return err
+		}
+		clientCerts = certs.Data
+	}
+	ike, esp, err := r.ipsecRemoteAccessProposals()
+	if err != nil {
+		r.Log.Error(err, "failed to get ipsec remote access proposals")
+		return err
+	}
+	data, err := renderIpsecProfiles(gw, ipsecSecret.Data[IpsecCaKey], ike, esp, clientCerts)
+	if err != nil {
+		return err
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = labelsForVpnGw(gw)
+		secret.Data = data
+		return controllerutil.SetControllerReference(gw, secret, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ipsec profiles secret", "secret", secret.Name)
+		return err
+	}
+	r.Log.Info("ipsec profiles secret reconciled", "secret", secret.Name, "operation", op)
+	return nil
+}
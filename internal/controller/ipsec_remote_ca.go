@@ -0,0 +1,82 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// kinds of the object holding the remote ca of an ipsec connection
+	IpsecRemoteCaSecret    = "Secret"
+	IpsecRemoteCaConfigMap = "ConfigMap"
+
+	// remote ca of an ipsec connection in the generated ipsec secret, <connection>.remote.crt
+	IpsecRemoteCaSuffix = ".remote.crt"
+)
+
+// ipsecRemoteCaPath returns where the ipsec container finds the remote ca of an ipsec connection,
+// swanctl loads the absolute cacerts and certs paths along with the connection
+func ipsecRemoteCaPath(name string) string {
+	return IpsecSecretsPath + "/" + name + IpsecRemoteCaSuffix
+}
+
+// getIpsecRemoteCa returns the pem encoded remote ca or pinned remote certificate of an ipsec connection
+func (r *VpnGwReconciler) getIpsecRemoteCa(ctx context.Context, conn *vpngwv2.IpsecConn) ([]byte, error) {
+	ca := conn.Spec.RemoteCa
+	key := ca.Key
+	if key == "" {
+		key = IpsecCaKey
+	}
+	name := types.NamespacedName{Name: ca.Name, Namespace: conn.Namespace}
+	var data []byte
+	switch ca.Kind {
+	case IpsecRemoteCaSecret:
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, name, secret); err != nil {
+			return nil, fmt.Errorf("failed to get remote ca secret %s: %v", ca.Name, err)
+		}
+		data = secret.Data[key]
+	case IpsecRemoteCaConfigMap:
+		cm := &corev1.ConfigMap{}
+		if err := r.Get(ctx, name, cm); err != nil {
+			return nil, fmt.Errorf("failed to get remote ca configmap %s: %v", ca.Name, err)
+		}
+		data = []byte(cm.Data[key])
+	default:
+		return nil, fmt.Errorf("remote ca kind %q is invalid", ca.Kind)
+	}
+	if _, err := parseCertificate(data); err != nil {
+		return nil, fmt.Errorf("invalid remote ca %s of %s %s: %v", key, ca.Kind, ca.Name, err)
+	}
+	return data, nil
+}
+
+// mapRemoteCaToVpnGw maps the secret or configmap to the vpn gws whose ipsec connections trust it
+func (r *VpnGwReconciler) mapRemoteCaToVpnGw(kind string) handler.MapFunc {
+	return func(object client.Object) []reconcile.Request {
+		conns := &vpngwv2.IpsecConnList{}
+		if err := r.List(context.Background(), conns, client.InNamespace(object.GetNamespace())); err != nil {
+			r.Log.Error(err, "failed to list ipsec connections", "namespace", object.GetNamespace())
+			return nil
+		}
+		requests := []reconcile.Request{}
+		for _, conn := range conns.Items {
+			ca := conn.Spec.RemoteCa
+			if ca == nil || ca.Kind != kind || ca.Name != object.GetName() {
+				continue
+			}
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: conn.Spec.VpnGw, Namespace: conn.Namespace},
+			})
+		}
+		return requests
+	}
+}
@@ -20,8 +20,11 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"reflect"
 
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	"k8s.io/apimachinery/pkg/types"
 	ctrl "sigs.k8s.io/controller-runtime"
@@ -31,7 +34,7 @@ import (
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
 
 	"github.com/go-logr/logr"
-	vpngwv1 "github.com/kubecombo/kube-combo/api/v1"
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
 )
 
 const (
@@ -45,67 +48,212 @@ type IpsecConnReconciler struct {
 	Scheme    *runtime.Scheme
 	Namespace string
 	Reload    chan event.GenericEvent
+	// policy of the ipsec connection proposals and ike version
+	IpsecPolicy *IpsecAlgorithmPolicy
 }
 
-func (r *IpsecConnReconciler) validateIpsecConnection(ipsecConn *vpngwv1.IpsecConn, namespacedName string) error {
+// validateIpsecConnection checks the ipsec connection could be rendered into swanctl.conf,
+// shared by the ipsec connection status and the vpn gw which skips the invalid connections
+func validateIpsecConnection(log logr.Logger, ipsecConn *vpngwv2.IpsecConn) error {
 	if ipsecConn.Spec.VpnGw == "" {
 		err := fmt.Errorf("ipsecConn vpn gw is required")
-		r.Log.Error(err, "should set vpn gw")
+		log.Error(err, "should set vpn gw")
 		return err
 	}
 
 	// TODO:// use webhook to validate vpn gw
 	// if ipsecConn.Status.VpnGw != "" && ipsecConn.Spec.VpnGw != ipsecConn.Status.VpnGw {
 	// 	err := fmt.Errorf("ipsecConn vpn gw can not be changed")
-	// 	r.Log.Error(err, "ipsecConn should not change vpn gw")
+	// 	log.Error(err, "ipsecConn should not change vpn gw")
 	// 	return err
 	// }
 
 	if ipsecConn.Spec.IkeVersion != "0" && ipsecConn.Spec.IkeVersion != "1" && ipsecConn.Spec.IkeVersion != "2" {
 		err := fmt.Errorf("ipsec connection spec ike version is invalid, ike version spec: %s", ipsecConn.Spec.IkeVersion)
-		r.Log.Error(err, "ignore invalid ipsec connection")
+		log.Error(err, "ignore invalid ipsec connection")
+		return err
 	}
 
 	if ipsecConn.Spec.Auth != "psk" && ipsecConn.Spec.Auth != "pubkey" {
 		err := fmt.Errorf("ipsec connection spec auth is invalid, auth spec: %s", ipsecConn.Spec.Auth)
-		r.Log.Error(err, "ignore invalid ipsec connection")
+		log.Error(err, "ignore invalid ipsec connection")
+		return err
+	}
+
+	if ipsecConn.Spec.Auth == "psk" && ipsecConn.Spec.PskSecret == "" {
+		err := fmt.Errorf("ipsecConn psk secret is required if auth is psk")
+		log.Error(err, "should set psk secret")
+		return err
 	}
 
 	if ipsecConn.Spec.RemotePublicIp == "" {
 		err := fmt.Errorf("ipsecConn remote public ip is required")
-		r.Log.Error(err, "should set remote public ip")
+		log.Error(err, "should set remote public ip")
+		return err
+	}
+
+	if ipsecConn.Spec.LocalPublicIp == "" {
+		err := fmt.Errorf("ipsecConn local public ip is required")
+		log.Error(err, "should set local public ip")
+		return err
+	}
+
+	if ipsecConn.Spec.LocalCN == "" || ipsecConn.Spec.RemoteCN == "" {
+		err := fmt.Errorf("ipsecConn local cn and remote cn are required")
+		log.Error(err, "should set local cn and remote cn")
+		return err
+	}
+
+	if err := ipsecConn.Spec.ValidateEndpoints(); err != nil {
+		log.Error(err, "should set valid public ips and cns")
+		return err
+	}
+
+	if ipsecConn.Spec.IkeProposals == "" {
+		err := fmt.Errorf("ipsecConn ike proposals is required")
+		log.Error(err, "should set ike proposals, eg: default")
+		return err
+	}
+
+	if cidrs := ipsecConn.Annotations[vpngwv2.UnconvertedCidrsAnnotation]; cidrs != "" {
+		err := fmt.Errorf("ipsecConn private cidrs %s written by v1 could not be converted into traffic selectors", cidrs)
+		log.Error(err, "should fix the private cidrs and remove annotation "+vpngwv2.UnconvertedCidrsAnnotation)
 		return err
 	}
 
-	if ipsecConn.Spec.RemotePrivateCidrs == "" {
+	if len(ipsecConn.Spec.RemotePrivateCidrs) == 0 {
 		err := fmt.Errorf("ipsecConn remote private cidrs is required")
-		r.Log.Error(err, "should set remote private cidrs")
+		log.Error(err, "should set remote private cidrs")
 		return err
 	}
+	for _, ts := range ipsecConn.Spec.RemotePrivateCidrs {
+		if err := ts.Validate(); err != nil {
+			log.Error(err, "should set valid remote private cidrs")
+			return err
+		}
+	}
 
-	if ipsecConn.Spec.LocalPrivateCidrs == "" {
+	if len(ipsecConn.Spec.LocalPrivateCidrs) == 0 {
 		err := fmt.Errorf("ipsecConn local private cidrs is required")
-		r.Log.Error(err, "should set local private cidrs")
+		log.Error(err, "should set local private cidrs")
 		return err
 	}
+	for _, ts := range ipsecConn.Spec.LocalPrivateCidrs {
+		if err := ts.Validate(); err != nil {
+			log.Error(err, "should set valid local private cidrs")
+			return err
+		}
+	}
+
+	if _, err := vpngwv2.ParseProposals(ipsecConn.Spec.IkeProposals); err != nil {
+		log.Error(err, "should set valid ike proposals")
+		return err
+	}
+	if _, err := vpngwv2.ParseProposals(ipsecConn.Spec.EspProposals); err != nil {
+		log.Error(err, "should set valid esp proposals")
+		return err
+	}
+
+	for name, value := range map[string]string{
+		"dpd delay":        ipsecConn.Spec.DpdDelay,
+		"dpd timeout":      ipsecConn.Spec.DpdTimeout,
+		"rekey time":       ipsecConn.Spec.RekeyTime,
+		"reauth time":      ipsecConn.Spec.ReauthTime,
+		"over time":        ipsecConn.Spec.OverTime,
+		"child rekey time": ipsecConn.Spec.ChildRekeyTime,
+	} {
+		if err := vpngwv2.ValidateSwanctlTime(name, value); err != nil {
+			log.Error(err, "should set valid time, eg: 30s, 10m, 1h")
+			return err
+		}
+	}
+	switch ipsecConn.Spec.DpdAction {
+	case "", "clear", "hold", "restart":
+	default:
+		err := fmt.Errorf("ipsecConn dpd action %q is invalid", ipsecConn.Spec.DpdAction)
+		log.Error(err, "should set dpd action clear, hold or restart")
+		return err
+	}
+	switch ipsecConn.Spec.StartAction {
+	case "", "none", "trap", "start":
+	default:
+		err := fmt.Errorf("ipsecConn start action %q is invalid", ipsecConn.Spec.StartAction)
+		log.Error(err, "should set start action none, trap or start")
+		return err
+	}
+	switch ipsecConn.Spec.CloseAction {
+	case "", "none", "clear", "hold", "restart":
+	default:
+		err := fmt.Errorf("ipsecConn close action %q is invalid", ipsecConn.Spec.CloseAction)
+		log.Error(err, "should set close action none, clear, hold or restart")
+		return err
+	}
+	if ipsecConn.Spec.Keyingtries != nil && *ipsecConn.Spec.Keyingtries < 0 {
+		err := fmt.Errorf("ipsecConn keyingtries %d is invalid", *ipsecConn.Spec.Keyingtries)
+		log.Error(err, "should set keyingtries 0 or more")
+		return err
+	}
+	if ipsecConn.Spec.DpdTimeout != "" && ipsecConn.Spec.IkeVersion == "2" {
+		log.Info("dpd timeout is ignored by IKEv2", "ipsecConn", client.ObjectKeyFromObject(ipsecConn).String())
+	}
+
+	if err := validateIpsecTranslation(&ipsecConn.Spec); err != nil {
+		log.Error(err, "should set valid translated cidrs")
+		return err
+	}
+	if ca := ipsecConn.Spec.RemoteCa; ca != nil {
+		if ipsecConn.Spec.Auth != "pubkey" {
+			err := fmt.Errorf("ipsecConn remote ca requires pubkey auth")
+			log.Error(err, "should set auth pubkey or remove remote ca")
+			return err
+		}
+		if ca.Kind != IpsecRemoteCaSecret && ca.Kind != IpsecRemoteCaConfigMap {
+			err := fmt.Errorf("ipsecConn remote ca kind %q is invalid", ca.Kind)
+			log.Error(err, "should set remote ca kind Secret or ConfigMap")
+			return err
+		}
+		if ca.Name == "" {
+			err := fmt.Errorf("ipsecConn remote ca name is required")
+			log.Error(err, "should set remote ca name")
+			return err
+		}
+	}
+
+	children := map[string]bool{}
+	for _, child := range ipsecConn.Spec.Children {
+		if children[child.Name] {
+			err := fmt.Errorf("ipsecConn child %s is duplicated", child.Name)
+			log.Error(err, "should set unique child names")
+			return err
+		}
+		children[child.Name] = true
+		if err := child.Validate(); err != nil {
+			log.Error(err, "should set valid children")
+			return err
+		}
+		if _, err := vpngwv2.ParseProposals(child.EspProposals); err != nil {
+			log.Error(err, "should set valid esp proposals of child", "child", child.Name)
+			return err
+		}
+	}
 
 	return nil
 }
 
-func labelsForIpsecConnection(conn *vpngwv1.IpsecConn) map[string]string {
+func labelsForIpsecConnection(conn *vpngwv2.IpsecConn) map[string]string {
 	return map[string]string{
 		VpnGwLabel: conn.Spec.VpnGw,
 	}
 }
 
-func (r *IpsecConnReconciler) handleAddOrUpdateIpsecConnection(req ctrl.Request, ipsecConn *vpngwv1.IpsecConn) (SyncState, error) {
+func (r *IpsecConnReconciler) handleAddOrUpdateIpsecConnection(req ctrl.Request, ipsecConn *vpngwv2.IpsecConn) (SyncState, error) {
 	// create ipsecConn statefulset
 	namespacedName := req.NamespacedName.String()
 	r.Log.Info("start handleAddOrUpdateIpsecConnection", "ipsecConn", namespacedName)
 	defer r.Log.Info("end handleAddOrUpdateIpsecConnection", "ipsecConn", namespacedName)
 
 	// validate ipsecConn spec
-	if err := r.validateIpsecConnection(ipsecConn, namespacedName); err != nil {
+	if err := validateIpsecConnection(r.Log, ipsecConn); err != nil {
 		r.Log.Error(err, "failed to validate ipsecConn")
 		// invalid spec no retry
 		return SyncStateErrorNoRetry, err
@@ -113,14 +261,46 @@ func (r *IpsecConnReconciler) handleAddOrUpdateIpsecConnection(req ctrl.Request,
 
 	// patch lable so that vpn gw can find its ipsec conns
 	newConn := ipsecConn.DeepCopy()
-	labels := labelsForIpsecConnection(newConn)
-	newConn.SetLabels(labels)
-	err := r.Patch(context.Background(), newConn, client.MergeFrom(ipsecConn))
-	if err != nil {
-		r.Log.Error(err, "failed to update the ipsecConn")
-		return SyncStateError, err
+	if newConn.Labels == nil {
+		newConn.Labels = map[string]string{}
+	}
+	// keep the other labels, eg: the ipsec topology which generated the connection
+	for k, v := range labelsForIpsecConnection(newConn) {
+		newConn.Labels[k] = v
+	}
+	// the connection is written by the user, it should survive the vpn gw being deleted or recreated,
+	// vpn gw watches the connections by spec vpn gw instead
+	dropVpnGwOwnerReferences(newConn)
+	if !reflect.DeepEqual(newConn.ObjectMeta, ipsecConn.ObjectMeta) {
+		if err := r.Patch(context.Background(), newConn, client.MergeFrom(ipsecConn)); err != nil {
+			r.Log.Error(err, "failed to update the ipsecConn")
+			return SyncStateError, err
+		}
+	}
+
+	// report algorithm policy violations, vpn gw skips the non-compliant ipsec connections
+	condition := metav1.Condition{
+		Type:               vpngwv2.IpsecConnPolicyCompliant,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Compliant",
+		Message:            "proposals and ike version satisfy the algorithm policy",
+		ObservedGeneration: newConn.Generation,
+	}
+	if err := r.IpsecPolicy.Check(&newConn.Spec); err != nil {
+		r.Log.Error(err, "ipsecConn violates the algorithm policy", "ipsecConn", namespacedName)
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "PolicyViolation"
+		condition.Message = err.Error()
+	}
+	conditions := append([]metav1.Condition{}, newConn.Status.Conditions...)
+	meta.SetStatusCondition(&newConn.Status.Conditions, condition)
+	if !reflect.DeepEqual(conditions, newConn.Status.Conditions) {
+		if err := r.Status().Update(context.Background(), newConn); err != nil {
+			r.Log.Error(err, "failed to update the ipsecConn status")
+			return SyncStateError, err
+		}
 	}
-	return SyncStateSuccess, err
+	return SyncStateSuccess, nil
 }
 
 //+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsecconns,verbs=get;list;watch;create;update;patch;delete
@@ -149,7 +329,7 @@ func (r *IpsecConnReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 	}
 	if ipsecConn == nil {
 		// ipsecConn is deleted
-		// onwner reference will trigger vpn gw update ipsec connections
+		// vpn gw watches ipsec connections and updates its configuration
 		return ctrl.Result{}, nil
 	}
 	// update vpn gw spec
@@ -171,11 +351,11 @@ func (r *IpsecConnReconciler) Reconcile(ctx context.Context, req ctrl.Request) (
 // SetupWithManager sets up the controller with the Manager.
 func (r *IpsecConnReconciler) SetupWithManager(mgr ctrl.Manager) error {
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&vpngwv1.IpsecConn{},
+		For(&vpngwv2.IpsecConn{},
 			builder.WithPredicates(
 				predicate.NewPredicateFuncs(
 					func(object client.Object) bool {
-						_, ok := object.(*vpngwv1.IpsecConn)
+						_, ok := object.(*vpngwv2.IpsecConn)
 						if !ok {
 							err := errors.New("invalid ipsecConn")
 							r.Log.Error(err, "expected ipsecConn in worequeue but got something else")
@@ -189,8 +369,8 @@ func (r *IpsecConnReconciler) SetupWithManager(mgr ctrl.Manager) error {
 		Complete(r)
 }
 
-func (r *IpsecConnReconciler) getIpsecConnection(ctx context.Context, name types.NamespacedName) (*vpngwv1.IpsecConn, error) {
-	var res vpngwv1.IpsecConn
+func (r *IpsecConnReconciler) getIpsecConnection(ctx context.Context, name types.NamespacedName) (*vpngwv2.IpsecConn, error) {
+	var res vpngwv2.IpsecConn
 	err := r.Get(ctx, name, &res)
 	if apierrors.IsNotFound(err) { // in case of delete, get fails and we need to pass nil to the handler
 		return nil, nil
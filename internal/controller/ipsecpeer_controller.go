@@ -0,0 +1,295 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+// IpsecPeerReconciler creates the ipsec connections of the imported peer descriptors,
+// a peer descriptor is the ipsec peer configmap exported by a vpn gw of another cluster,
+// imported by labeling it with the local vpn gw name
+type IpsecPeerReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// ipsecConnForPeer returns the ipsec connection from the local vpn gw to the imported peer
+func ipsecConnForPeer(cm *corev1.ConfigMap, gw *vpngwv2.VpnGw, localCN string, peer *ipsecPeerDescriptor) *vpngwv2.IpsecConn {
+	return &vpngwv2.IpsecConn{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      cm.Name,
+			Namespace: cm.Namespace,
+		},
+		Spec: vpngwv2.IpsecConnSpec{
+			VpnGw:              gw.Name,
+			Auth:               "pubkey",
+			IkeVersion:         "2",
+			IkeProposals:       vpngwv2.DefaultProposal,
+			LocalCN:            localCN,
+			LocalPublicIp:      gw.Spec.PublicEndpoint.Ip,
+			LocalPrivateCidrs:  gw.Spec.IpsecVpn.PeerExport.Cidrs,
+			RemoteCN:           peer.CN,
+			RemotePublicIp:     peer.PublicIp,
+			RemotePrivateCidrs: peer.Cidrs,
+			// the peer may run its own pki, trust the verified peer certificate only
+			RemoteCa: &vpngwv2.IpsecRemoteCa{
+				Kind:   IpsecRemoteCaConfigMap,
+				Name:   cm.Name,
+				Key:    IpsecPeerCertKey,
+				Pinned: true,
+			},
+		},
+	}
+}
+
+func (r *IpsecPeerReconciler) handleAddOrUpdateIpsecPeer(ctx context.Context, cm *corev1.ConfigMap) (SyncState, error) {
+	namespacedName := fmt.Sprintf("%s/%s", cm.Namespace, cm.Name)
+	r.Log.Info("start handleAddOrUpdateIpsecPeer", "peer", namespacedName)
+	defer r.Log.Info("end handleAddOrUpdateIpsecPeer", "peer", namespacedName)
+
+	// the local side is the peer descriptor which the local vpn gw exports
+	gw := &vpngwv2.VpnGw{}
+	err := r.Get(ctx, types.NamespacedName{Name: cm.Labels[IpsecPeerImportLabel], Namespace: cm.Namespace}, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get the local vpn gw of the peer")
+		return SyncStateError, err
+	}
+	export := gw.Spec.IpsecVpn.PeerExport
+	if export == nil || gw.Spec.PublicEndpoint.Ip == "" {
+		err := fmt.Errorf("vpn gw %s does not export ipsec peer", gw.Name)
+		r.Log.Error(err, "should set peer export and public endpoint ip of the local vpn gw")
+		if err := r.deleteImportedIpsecConn(ctx, cm); err != nil {
+			return SyncStateError, err
+		}
+		return SyncStateErrorNoRetry, err
+	}
+	if export.TrustedCaSecret == "" {
+		err := fmt.Errorf("vpn gw %s trusts no peer ca", gw.Name)
+		r.Log.Error(err, "should set peer export trusted ca secret of the local vpn gw")
+		if err := r.deleteImportedIpsecConn(ctx, cm); err != nil {
+			return SyncStateError, err
+		}
+		return SyncStateErrorNoRetry, err
+	}
+	// the descriptors are no longer trusted once the trusted ca secret is deleted
+	trusted := &corev1.Secret{}
+	err = r.Get(ctx, types.NamespacedName{Name: export.TrustedCaSecret, Namespace: gw.Namespace}, trusted)
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to get the trusted peer ca secret", "secret", export.TrustedCaSecret)
+		return SyncStateError, err
+	}
+
+	peer, err := verifyIpsecPeerDescriptor(cm.Data, trusted.Data[IpsecCaKey])
+	if err != nil {
+		r.Log.Error(err, "should import the peer descriptor exported by a trusted peer vpn gw as is")
+		// revoke the ipsec connection imported before, eg: the peer ca is removed from the trusted ca secret
+		if err := r.deleteImportedIpsecConn(ctx, cm); err != nil {
+			return SyncStateError, err
+		}
+		return SyncStateErrorNoRetry, err
+	}
+	_, cert, err := getIpsecIdentity(ctx, r.Client, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get the local vpn gw ipsec identity")
+		return SyncStateError, err
+	}
+
+	want := ipsecConnForPeer(cm, gw, cert.Subject.CommonName, peer)
+	conn := &vpngwv2.IpsecConn{ObjectMeta: want.ObjectMeta}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, conn, func() error {
+		if err := takeOverIpsecConn(conn, IpsecPeerImportLabel, cm); err != nil {
+			return err
+		}
+		if conn.Labels == nil {
+			conn.Labels = map[string]string{}
+		}
+		conn.Labels[IpsecPeerImportLabel] = cm.Name
+		// keep the settings tuned after the import, the peer owns the addressing only
+		if conn.CreationTimestamp.IsZero() {
+			conn.Spec = want.Spec
+		} else {
+			conn.Spec.VpnGw = want.Spec.VpnGw
+			conn.Spec.LocalCN = want.Spec.LocalCN
+			conn.Spec.LocalPublicIp = want.Spec.LocalPublicIp
+			conn.Spec.LocalPrivateCidrs = want.Spec.LocalPrivateCidrs
+			conn.Spec.RemoteCN = want.Spec.RemoteCN
+			conn.Spec.RemotePublicIp = want.Spec.RemotePublicIp
+			conn.Spec.RemotePrivateCidrs = want.Spec.RemotePrivateCidrs
+			conn.Spec.RemoteCa = want.Spec.RemoteCa
+		}
+		// the vpn gw watches the ipsec connection by spec.vpnGw, the descriptor is the owner for garbage collection
+		return controllerutil.SetOwnerReference(cm, conn, r.Scheme)
+	})
+	if errors.Is(err, errIpsecConnNotGenerated) {
+		r.Log.Error(err, "should rename the peer descriptor or remove the ipsec connection which is not imported", "ipsecConn", conn.Name)
+		return SyncStateErrorNoRetry, err
+	}
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ipsec connection of the peer", "ipsecConn", conn.Name)
+		return SyncStateError, err
+	}
+	r.Log.Info("ipsec connection of the peer reconciled", "ipsecConn", conn.Name, "operation", op)
+	return SyncStateSuccess, nil
+}
+
+// deleteImportedIpsecConn deletes the ipsec connection imported from the peer descriptor,
+// the ipsec connection of the same name not labeled by the import is kept
+func (r *IpsecPeerReconciler) deleteImportedIpsecConn(ctx context.Context, cm *corev1.ConfigMap) error {
+	conn := &vpngwv2.IpsecConn{}
+	err := r.Get(ctx, types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace}, conn)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil
+		}
+		r.Log.Error(err, "failed to get ipsec connection of the peer", "ipsecConn", cm.Name)
+		return err
+	}
+	if conn.Labels[IpsecPeerImportLabel] != cm.Name {
+		return nil
+	}
+	r.Log.Info("delete ipsec connection of the untrusted peer", "ipsecConn", conn.Name)
+	if err := r.Delete(ctx, conn); err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to delete ipsec connection of the peer", "ipsecConn", conn.Name)
+		return err
+	}
+	return nil
+}
+
+//+kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsecconns,verbs=get;list;watch;create;update;patch;delete
+
+// Reconcile creates the ipsec connection of the imported peer descriptor,
+// the ipsec connection is deleted by the garbage collector along with the descriptor
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
+func (r *IpsecPeerReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start reconcile", "peer", namespacedName)
+	defer r.Log.Info("end reconcile", "peer", namespacedName)
+	updates.Inc()
+
+	cm := &corev1.ConfigMap{}
+	err := r.Get(ctx, req.NamespacedName, cm)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		r.Log.Error(err, "failed to get peer descriptor")
+		return ctrl.Result{}, err
+	}
+	if cm.Labels[IpsecPeerImportLabel] == "" {
+		return ctrl.Result{}, nil
+	}
+
+	res, err := r.handleAddOrUpdateIpsecPeer(ctx, cm)
+	switch res {
+	case SyncStateError:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle peer descriptor")
+		return ctrl.Result{RequeueAfter: 3 * time.Second}, errRetry
+	case SyncStateErrorNoRetry:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle peer descriptor")
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *IpsecPeerReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		Named("ipsecpeer").
+		For(&corev1.ConfigMap{},
+			builder.WithPredicates(
+				predicate.NewPredicateFuncs(
+					func(object client.Object) bool {
+						return object.GetLabels()[IpsecPeerImportLabel] != ""
+					},
+				),
+			),
+		).
+		Watches(&source.Kind{Type: &vpngwv2.IpsecConn{}},
+			&handler.EnqueueRequestForOwner{OwnerType: &corev1.ConfigMap{}, IsController: false},
+		).
+		// the local side of the connection follows the vpn gw peer export
+		Watches(&source.Kind{Type: &vpngwv2.VpnGw{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapVpnGwToIpsecPeer),
+		).
+		// verify the peer descriptors again once the trusted peer cas change
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSecretToIpsecPeer),
+		).
+		Complete(r)
+}
+
+// map trusted peer ca secret to the peer descriptors imported by the vpn gws which trust it
+func (r *IpsecPeerReconciler) mapSecretToIpsecPeer(object client.Object) []reconcile.Request {
+	gws := &vpngwv2.VpnGwList{}
+	if err := r.List(context.Background(), gws, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list vpn gws", "namespace", object.GetNamespace())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range gws.Items {
+		gw := &gws.Items[i]
+		if export := gw.Spec.IpsecVpn.PeerExport; export != nil && export.TrustedCaSecret == object.GetName() {
+			requests = append(requests, r.mapVpnGwToIpsecPeer(gw)...)
+		}
+	}
+	return requests
+}
+
+// map vpn gw to the peer descriptors imported by it
+func (r *IpsecPeerReconciler) mapVpnGwToIpsecPeer(object client.Object) []reconcile.Request {
+	cms := &corev1.ConfigMapList{}
+	err := r.List(context.Background(), cms, client.InNamespace(object.GetNamespace()), client.MatchingLabels{IpsecPeerImportLabel: object.GetName()})
+	if err != nil {
+		r.Log.Error(err, "failed to list peer descriptors", "namespace", object.GetNamespace())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, cm := range cms.Items {
+		requests = append(requests, reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: cm.Name, Namespace: cm.Namespace},
+		})
+	}
+	return requests
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// label of the ipsec connections generated by an ipsec topology
+	IpsecTopologyLabel = "ipsec-topology"
+
+	IpsecTopologyReady = "Ready"
+
+	DefaultIpsecTopologyIkeVersion   = "2"
+	DefaultIpsecTopologyIkeProposals = vpngwv2.DefaultProposal
+)
+
+// errIpsecConnNotGenerated is returned when an ipsec connection of the generated name is written by someone else
+var errIpsecConnNotGenerated = errors.New("ipsec connection is not generated")
+
+// takeOverIpsecConn refuses to update an existing ipsec connection unless it is generated by the owner,
+// which is known by the label of the generator or the owner reference, so that the connections written by users are kept
+func takeOverIpsecConn(conn *vpngwv2.IpsecConn, label string, owner metav1.Object) error {
+	if conn.CreationTimestamp.IsZero() || conn.Labels[label] == owner.GetName() {
+		return nil
+	}
+	for _, ref := range conn.OwnerReferences {
+		if ref.UID == owner.GetUID() {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: ipsec connection %s already exists without label %s=%s", errIpsecConnNotGenerated, conn.Name, label, owner.GetName())
+}
+
+// IpsecTopologyReconciler reconciles a IpsecTopology object
+type IpsecTopologyReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+func (r *IpsecTopologyReconciler) validateIpsecTopology(topology *vpngwv2.IpsecTopology) error {
+	spec := topology.Spec
+	if spec.Mode != vpngwv2.IpsecTopologyMesh && spec.Mode != vpngwv2.IpsecTopologyHubSpoke {
+		err := fmt.Errorf("ipsec topology mode %q is invalid", spec.Mode)
+		r.Log.Error(err, "should set mode mesh or hub-spoke")
+		return err
+	}
+	if spec.Auth != "psk" && spec.Auth != "pubkey" {
+		err := fmt.Errorf("ipsec topology auth %q is invalid", spec.Auth)
+		r.Log.Error(err, "should set auth psk or pubkey")
+		return err
+	}
+	if spec.Auth == "psk" && spec.PskSecret == "" {
+		err := fmt.Errorf("ipsec topology psk secret is required if auth is psk")
+		r.Log.Error(err, "should set psk secret")
+		return err
+	}
+	if len(spec.Sites) < 2 {
+		err := fmt.Errorf("ipsec topology requires two sites at least")
+		r.Log.Error(err, "should set more sites")
+		return err
+	}
+
+	sites := map[string]bool{}
+	hasVpnGw := false
+	for _, site := range spec.Sites {
+		if sites[site.Name] {
+			err := fmt.Errorf("ipsec topology site %s is duplicated", site.Name)
+			r.Log.Error(err, "should set unique site names")
+			return err
+		}
+		sites[site.Name] = true
+		if site.VpnGw != "" {
+			hasVpnGw = true
+		} else if site.PublicIp == "" {
+			err := fmt.Errorf("ipsec topology external site %s public ip is required", site.Name)
+			r.Log.Error(err, "should set public ip of external site")
+			return err
+		}
+		if site.CN == "" {
+			err := fmt.Errorf("ipsec topology site %s cn is required", site.Name)
+			r.Log.Error(err, "should set cn of site")
+			return err
+		}
+		if len(site.Cidrs) == 0 {
+			err := fmt.Errorf("ipsec topology site %s cidrs is required", site.Name)
+			r.Log.Error(err, "should set cidrs of site")
+			return err
+		}
+		for _, ts := range site.Cidrs {
+			if err := ts.Validate(); err != nil {
+				r.Log.Error(err, "should set valid cidrs of site", "site", site.Name)
+				return err
+			}
+		}
+	}
+	if !hasVpnGw {
+		err := fmt.Errorf("ipsec topology requires one vpn gw site at least")
+		r.Log.Error(err, "should set vpn gw of site")
+		return err
+	}
+	if spec.Mode == vpngwv2.IpsecTopologyHubSpoke && !sites[spec.Hub] {
+		err := fmt.Errorf("ipsec topology hub %q is not a site", spec.Hub)
+		r.Log.Error(err, "should set hub to one of the sites")
+		return err
+	}
+	return nil
+}
+
+// ipsecTopologyConnName returns the name of the ipsec connection from the local site to the remote site
+func ipsecTopologyConnName(topology *vpngwv2.IpsecTopology, local, remote string) string {
+	return fmt.Sprintf("%s-%s-%s", topology.Name, local, remote)
+}
+
+// ipsecConnsForTopology returns the ipsec connections of the vpn gw sites,
+// sites is the topology sites whose public ip has been resolved
+func ipsecConnsForTopology(topology *vpngwv2.IpsecTopology, sites []vpngwv2.IpsecTopologySite) []vpngwv2.IpsecConn {
+	spec := topology.Spec
+	ikeVersion := spec.IkeVersion
+	if ikeVersion == "" {
+		ikeVersion = DefaultIpsecTopologyIkeVersion
+	}
+	ikeProposals := spec.IkeProposals
+	if ikeProposals == "" {
+		ikeProposals = DefaultIpsecTopologyIkeProposals
+	}
+	// spokes reach each other through the hub, so the hub side carries the cidrs of the other spokes
+	cidrsVia := func(site vpngwv2.IpsecTopologySite, exclude string) []vpngwv2.TrafficSelector {
+		cidrs := append([]vpngwv2.TrafficSelector{}, site.Cidrs...)
+		if spec.Mode != vpngwv2.IpsecTopologyHubSpoke || site.Name != spec.Hub {
+			return cidrs
+		}
+		for _, spoke := range sites {
+			if spoke.Name != spec.Hub && spoke.Name != exclude {
+				cidrs = append(cidrs, spoke.Cidrs...)
+			}
+		}
+		return cidrs
+	}
+
+	conns := []vpngwv2.IpsecConn{}
+	for _, local := range sites {
+		if local.VpnGw == "" {
+			continue
+		}
+		for _, remote := range sites {
+			if remote.Name == local.Name {
+				continue
+			}
+			if spec.Mode == vpngwv2.IpsecTopologyHubSpoke && local.Name != spec.Hub && remote.Name != spec.Hub {
+				continue
+			}
+			conns = append(conns, vpngwv2.IpsecConn{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      ipsecTopologyConnName(topology, local.Name, remote.Name),
+					Namespace: topology.Namespace,
+				},
+				Spec: vpngwv2.IpsecConnSpec{
+					VpnGw:              local.VpnGw,
+					Auth:               spec.Auth,
+					PskSecret:          spec.PskSecret,
+					IkeVersion:         ikeVersion,
+					IkeProposals:       ikeProposals,
+					EspProposals:       spec.EspProposals,
+					LocalCN:            local.CN,
+					LocalPublicIp:      local.PublicIp,
+					LocalPrivateCidrs:  cidrsVia(local, remote.Name),
+					RemoteCN:           remote.CN,
+					RemotePublicIp:     remote.PublicIp,
+					RemotePrivateCidrs: cidrsVia(remote, local.Name),
+				},
+			})
+		}
+	}
+	return conns
+}
+
+func (r *IpsecTopologyReconciler) handleAddOrUpdateIpsecTopology(ctx context.Context, topology *vpngwv2.IpsecTopology) (SyncState, error) {
+	namespacedName := fmt.Sprintf("%s/%s", topology.Namespace, topology.Name)
+	r.Log.Info("start handleAddOrUpdateIpsecTopology", "ipsecTopology", namespacedName)
+	defer r.Log.Info("end handleAddOrUpdateIpsecTopology", "ipsecTopology", namespacedName)
+
+	if err := r.validateIpsecTopology(topology); err != nil {
+		r.Log.Error(err, "failed to validate ipsec topology")
+		// invalid spec no retry
+		return SyncStateErrorNoRetry, err
+	}
+
+	// resolve the public ip of the vpn gw sites
+	sites := make([]vpngwv2.IpsecTopologySite, 0, len(topology.Spec.Sites))
+	for _, site := range topology.Spec.Sites {
+		if site.VpnGw != "" && site.PublicIp == "" {
+			gw := &vpngwv2.VpnGw{}
+			err := r.Get(ctx, types.NamespacedName{Name: site.VpnGw, Namespace: topology.Namespace}, gw)
+			if err != nil {
+				r.Log.Error(err, "failed to get vpn gw of site", "site", site.Name, "vpnGw", site.VpnGw)
+				return SyncStateError, err
+			}
+			if gw.Spec.PublicEndpoint.Ip == "" {
+				err := fmt.Errorf("vpn gw %s has no public endpoint ip", gw.Name)
+				r.Log.Error(err, "should set public ip of site or public endpoint of vpn gw", "site", site.Name)
+				return SyncStateErrorNoRetry, err
+			}
+			site.PublicIp = gw.Spec.PublicEndpoint.Ip
+		}
+		sites = append(sites, site)
+	}
+
+	desired := ipsecConnsForTopology(topology, sites)
+	names := make(map[string]bool, len(desired))
+	for _, want := range desired {
+		names[want.Name] = true
+		conn := &vpngwv2.IpsecConn{ObjectMeta: want.ObjectMeta}
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Client, conn, func() error {
+			if err := takeOverIpsecConn(conn, IpsecTopologyLabel, topology); err != nil {
+				return err
+			}
+			if conn.Labels == nil {
+				conn.Labels = map[string]string{}
+			}
+			conn.Labels[IpsecTopologyLabel] = topology.Name
+			conn.Spec = want.Spec
+			// the vpn gw watches the ipsec connection by spec.vpnGw, the topology is the owner for garbage collection
+			return controllerutil.SetOwnerReference(topology, conn, r.Scheme)
+		})
+		if errors.Is(err, errIpsecConnNotGenerated) {
+			r.Log.Error(err, "should rename or remove the ipsec connection which is not generated by the topology", "ipsecConn", conn.Name)
+			return SyncStateErrorNoRetry, err
+		}
+		if err != nil {
+			r.Log.Error(err, "failed to create or update ipsec connection", "ipsecConn", conn.Name)
+			return SyncStateError, err
+		}
+		r.Log.Info("ipsec connection reconciled", "ipsecConn", conn.Name, "operation", op)
+	}
+
+	// garbage collect the ipsec connections of the removed sites
+	conns := &vpngwv2.IpsecConnList{}
+	err := r.List(ctx, conns, client.InNamespace(topology.Namespace), client.MatchingLabels{IpsecTopologyLabel: topology.Name})
+	if err != nil {
+		r.Log.Error(err, "failed to list ipsec connections of topology")
+		return SyncStateError, err
+	}
+	for i := range conns.Items {
+		conn := &conns.Items[i]
+		if names[conn.Name] {
+			continue
+		}
+		r.Log.Info("delete stale ipsec connection", "ipsecConn", conn.Name)
+		if err := r.Delete(ctx, conn); err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to delete stale ipsec connection", "ipsecConn", conn.Name)
+			return SyncStateError, err
+		}
+	}
+
+	generated := make([]string, 0, len(names))
+	for name := range names {
+		generated = append(generated, name)
+	}
+	sort.Strings(generated)
+	newTopology := topology.DeepCopy()
+	newTopology.Status.Connections = generated
+	newTopology.Status.ObservedGeneration = topology.Generation
+	meta.SetStatusCondition(&newTopology.Status.Conditions, metav1.Condition{
+		Type:               IpsecTopologyReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Generated",
+		Message:            fmt.Sprintf("%d ipsec connections generated", len(generated)),
+		ObservedGeneration: topology.Generation,
+	})
+	if !reflect.DeepEqual(topology.Status, newTopology.Status) {
+		if err := r.Status().Update(ctx, newTopology); err != nil {
+			r.Log.Error(err, "failed to update ipsec topology status")
+			return SyncStateError, err
+		}
+	}
+	return SyncStateSuccess, nil
+}
+
+// setNotReady reports the topology could not be generated
+func (r *IpsecTopologyReconciler) setNotReady(ctx context.Context, topology *vpngwv2.IpsecTopology, err error) {
+	newTopology := topology.DeepCopy()
+	meta.SetStatusCondition(&newTopology.Status.Conditions, metav1.Condition{
+		Type:               IpsecTopologyReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Invalid",
+		Message:            err.Error(),
+		ObservedGeneration: topology.Generation,
+	})
+	if reflect.DeepEqual(topology.Status, newTopology.Status) {
+		return
+	}
+	if err := r.Status().Update(ctx, newTopology); err != nil {
+		r.Log.Error(err, "failed to update ipsec topology status")
+	}
+}
+
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsectopologies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsectopologies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsectopologies/finalizers,verbs=update
+
+// Reconcile generates the ipsec connections of the topology and garbage collects the stale ones
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
+func (r *IpsecTopologyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start reconcile", "ipsecTopology", namespacedName)
+	defer r.Log.Info("end reconcile", "ipsecTopology", namespacedName)
+	updates.Inc()
+
+	topology := &vpngwv2.IpsecTopology{}
+	err := r.Get(ctx, req.NamespacedName, topology)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// generated ipsec connections are deleted by the garbage collector
+			return ctrl.Result{}, nil
+		}
+		r.Log.Error(err, "failed to get ipsec topology")
+		return ctrl.Result{}, err
+	}
+
+	res, err := r.handleAddOrUpdateIpsecTopology(ctx, topology)
+	switch res {
+	case SyncStateError:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle ipsec topology")
+		return ctrl.Result{RequeueAfter: 3 * time.Second}, errRetry
+	case SyncStateErrorNoRetry:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle ipsec topology")
+		r.setNotReady(ctx, topology, err)
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *IpsecTopologyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vpngwv2.IpsecTopology{},
+			builder.WithPredicates(
+				predicate.NewPredicateFuncs(
+					func(object client.Object) bool {
+						_, ok := object.(*vpngwv2.IpsecTopology)
+						if !ok {
+							err := errors.New("invalid ipsec topology")
+							r.Log.Error(err, "expected ipsec topology in worequeue but got something else")
+							return false
+						}
+						return true
+					},
+				),
+			),
+		).
+		// the topology is not the controller of the generated ipsec connections
+		Watches(&source.Kind{Type: &vpngwv2.IpsecConn{}},
+			&handler.EnqueueRequestForOwner{OwnerType: &vpngwv2.IpsecTopology{}, IsController: false},
+		).
+		// public ip of the vpn gw sites is taken from the vpn gw
+		Watches(&source.Kind{Type: &vpngwv2.VpnGw{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapVpnGwToIpsecTopology),
+		).
+		Complete(r)
+}
+
+// map vpn gw to the ipsec topologies which have it as a site
+func (r *IpsecTopologyReconciler) mapVpnGwToIpsecTopology(object client.Object) []reconcile.Request {
+	topologies := &vpngwv2.IpsecTopologyList{}
+	if err := r.List(context.Background(), topologies, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list ipsec topologies", "namespace", object.GetNamespace())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, topology := range topologies.Items {
+		for _, site := range topology.Spec.Sites {
+			if site.VpnGw == object.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: topology.Name, Namespace: topology.Namespace},
+				})
+				break
+			}
+		}
+	}
+	return requests
+}
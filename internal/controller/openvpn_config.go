@@ -0,0 +1,394 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// openvpn server configuration delivered by configmap, mounted into the ssl container,
+	// configure.sh appends the route of the pod subnet and the search domains of the pod
+	SslVpnConfigMapSuffix = "-ssl-vpn-conf"
+	SslVpnConfigPath      = "/etc/ovpn/conf"
+	SslVpnConfKey         = "openvpn.conf"
+
+	// restart the ssl vpn server once its configuration changes
+	SslVpnConfHashAnnotation = "vpn-gw.kube-combo.com/ssl-vpn-conf-hash"
+
+	DefaultSslVpnDigest            = "SHA1"
+	DefaultSslVpnTlsVersionMin     = "1.2"
+	DefaultSslVpnLinkMtu           = 1300
+	DefaultSslVpnKeepaliveInterval = 10
+	DefaultSslVpnKeepaliveTimeout  = 600
+
+	// vpn gw pod env, newClientCert.sh renders the data channel options of the server into the client profiles
+	OvpnDataCiphersKey = "OVPN_DATA_CIPHERS"
+	OvpnDigestKey      = "OVPN_DIGEST"
+	OvpnTunMtuKey      = "OVPN_TUN_MTU"
+	OvpnLinkMtuKey     = "OVPN_LINK_MTU"
+)
+
+// openssl cipher and digest names
+var openVpnAlgorithmRegexp = regexp.MustCompile(`^[A-Za-z0-9][-A-Za-z0-9]*$`)
+
+var openVpnConfTemplate = template.Must(template.New(SslVpnConfKey).Funcs(template.FuncMap{
+	"join": strings.Join,
+}).Parse(`# rendered by kube-combo from the vpn gw spec
+server {{ .Network }} {{ .Netmask }} nopool
+topology subnet
+# the upper half of the subnet is reserved for the static ips pushed by the client config dir
+ifconfig-pool {{ .PoolStart }} {{ .PoolEnd }}
+proto {{ .Proto }}
+port {{ .Port }}
+dev {{ .Dev }}
+status {{ .StatusFile }}
+verb 3
+# sessions are listed and killed by the operator through management.sh
+management 127.0.0.1 {{ .ManagementPort }}
+
+key /etc/openvpn/certs/pki/private/server.key
+ca /etc/openvpn/certs/pki/ca.crt
+cert /etc/openvpn/certs/pki/issued/server.crt
+{{- if .DhNone }}
+# the ecdh groups are used only
+dh none
+{{- else }}
+dh /etc/openvpn/certs/pki/dh.pem
+{{- end }}
+key-direction 0
+tls-version-min {{ .TlsVersionMin }}
+
+data-ciphers {{ join .DataCiphers ":" }}
+data-ciphers-fallback {{ .Cipher }}
+auth {{ .Digest }}
+{{- if .Mtu }}
+tun-mtu {{ .Mtu }}
+{{- else }}
+link-mtu {{ .LinkMtu }}
+{{- end }}
+keepalive {{ .KeepaliveInterval }} {{ .KeepaliveTimeout }}
+{{- with .Compress }}
+allow-compression yes
+compress {{ . }}
+push "compress {{ . }}"
+{{- end }}
+{{- with .MaxClients }}
+max-clients {{ . }}
+{{- end }}
+# the renewed certificate and key are read again on SIGHUP by reload-certs.sh, so the key is not persisted,
+# the tun device is kept as openvpn runs as nobody after start up
+persist-tun
+{{- if eq .Proto "udp" }}
+# tell the clients to reconnect at once when the server restarts on SIGHUP
+explicit-exit-notify 1
+{{- end }}
+
+user nobody
+group nogroup
+script-security 2
+{{- if or .Auth .Totp }}
+auth-user-pass-verify /etc/openvpn/setup/auth-user-pass-verify.sh via-file
+{{- end }}
+{{- if .Auth }}
+# clients are authenticated again on renegotiation, the users removed from the identity provider are disconnected
+reneg-sec {{ .RenegSec }}
+{{- end }}
+{{- if .Totp }}
+# clients can not enter a new totp code on renegotiation, they renegotiate with the auth token instead,
+# which is verified by the verify script as well, and authenticate again once it expires after the reauth interval
+auth-gen-token {{ .RenegSec }} external-auth
+{{- end }}
+
+# static ips and routes of the clients, access rules applied once openvpn learns the client address,
+# openvpn runs as nobody, so the iptables script runs through sudo
+client-config-dir {{ .CcdPath }}
+learn-address "/usr/bin/sudo /etc/openvpn/setup/access-policy.sh"
+
+# routes and dns pushed to the clients besides the pod subnet
+{{- range .Routes }}
+push "route {{ . }}"
+{{- end }}
+{{- if .FullTunnel }}
+push "redirect-gateway def1 bypass-dhcp"
+{{- end }}
+{{- range .DnsServers }}
+push "dhcp-option DNS {{ . }}"
+{{- end }}
+{{- range .SearchDomains }}
+push "dhcp-option DOMAIN-SEARCH {{ . }}"
+{{- end }}
+`))
+
+// openVpnConfig is the openvpn server configuration of a vpn gw
+type openVpnConfig struct {
+	Network    string
+	Netmask    string
+	PoolStart  string
+	PoolEnd    string
+	Proto      string
+	Port       int32
+	Dev        string
+	StatusFile string
+	DhNone     bool
+
+	ManagementPort int32
+
+	TlsVersionMin     string
+	Cipher            string
+	DataCiphers       []string
+	Digest            string
+	Mtu               int32
+	LinkMtu           int32
+	KeepaliveInterval int32
+	KeepaliveTimeout  int32
+	Compress          string
+	MaxClients        int32
+
+	Auth     bool
+	RenegSec int
+	Totp     bool
+	CcdPath  string
+
+	// address and netmask
+	Routes        []string
+	FullTunnel    bool
+	DnsServers    []string
+	SearchDomains []string
+}
+
+// validateOpenVpnConfig validates the openvpn server options of the ssl vpn
+func validateOpenVpnConfig(ssl *vpngwv2.SslVpnSpec) error {
+	for _, cipher := range append([]string{ssl.Cipher}, ssl.DataCiphers...) {
+		if !openVpnAlgorithmRegexp.MatchString(cipher) {
+			return fmt.Errorf("ssl vpn cipher %q is invalid", cipher)
+		}
+	}
+	if ssl.Digest != "" && !openVpnAlgorithmRegexp.MatchString(ssl.Digest) {
+		return fmt.Errorf("ssl vpn digest %q is invalid", ssl.Digest)
+	}
+	switch ssl.TlsVersionMin {
+	case "", "1.2", "1.3":
+	default:
+		return fmt.Errorf("ssl vpn tls version min %q should be 1.2 or 1.3", ssl.TlsVersionMin)
+	}
+	if ssl.Mtu != 0 && (ssl.Mtu < 576 || ssl.Mtu > 9000) {
+		return fmt.Errorf("ssl vpn mtu %d should be between 576 and 9000", ssl.Mtu)
+	}
+	if ssl.KeepaliveInterval < 0 || ssl.KeepaliveTimeout < 0 {
+		return fmt.Errorf("ssl vpn keepalive should not be negative")
+	}
+	interval, timeout := sslVpnKeepalive(ssl)
+	if timeout < 2*interval {
+		return fmt.Errorf("ssl vpn keepalive timeout %d should be twice the interval %d at least", timeout, interval)
+	}
+	switch ssl.Compress {
+	case "", "stub-v2", "lz4-v2", "lz4":
+	default:
+		return fmt.Errorf("ssl vpn compress %q is invalid", ssl.Compress)
+	}
+	if ssl.MaxClients < 0 {
+		return fmt.Errorf("ssl vpn max clients should not be negative")
+	}
+	return nil
+}
+
+// sslVpnKeepalive returns the keepalive interval and timeout of the ssl vpn
+func sslVpnKeepalive(ssl *vpngwv2.SslVpnSpec) (interval, timeout int32) {
+	interval, timeout = ssl.KeepaliveInterval, ssl.KeepaliveTimeout
+	if interval == 0 {
+		interval = DefaultSslVpnKeepaliveInterval
+	}
+	if timeout == 0 {
+		timeout = DefaultSslVpnKeepaliveTimeout
+	}
+	return interval, timeout
+}
+
+// sslVpnDataCiphers returns the data channel ciphers negotiated with the clients
+func sslVpnDataCiphers(ssl *vpngwv2.SslVpnSpec) []string {
+	if len(ssl.DataCiphers) == 0 {
+		return []string{ssl.Cipher}
+	}
+	return ssl.DataCiphers
+}
+
+// sslVpnDigest returns the hmac digest of the data channel
+func sslVpnDigest(ssl *vpngwv2.SslVpnSpec) string {
+	if ssl.Digest == "" {
+		return DefaultSslVpnDigest
+	}
+	return ssl.Digest
+}
+
+// sslVpnClientEnv returns the ssl container env of the data channel options,
+// the client profiles must match the server on the digest and the mtu
+func sslVpnClientEnv(ssl *vpngwv2.SslVpnSpec) []corev1.EnvVar {
+	env := []corev1.EnvVar{
+		{Name: OvpnDataCiphersKey, Value: strings.Join(sslVpnDataCiphers(ssl), ":")},
+		{Name: OvpnDigestKey, Value: sslVpnDigest(ssl)},
+	}
+	if ssl.Mtu != 0 {
+		return append(env, corev1.EnvVar{Name: OvpnTunMtuKey, Value: strconv.Itoa(int(ssl.Mtu))})
+	}
+	return append(env, corev1.EnvVar{Name: OvpnLinkMtuKey, Value: strconv.Itoa(DefaultSslVpnLinkMtu)})
+}
+
+// newOpenVpnConfig returns the openvpn server configuration of the vpn gw
+func newOpenVpnConfig(gw *vpngwv2.VpnGw) (*openVpnConfig, error) {
+	ssl := &gw.Spec.SslVpn
+	prefix, err := parseSslVpnSubnet(ssl.SubnetCidr)
+	if err != nil {
+		return nil, err
+	}
+	poolStart, poolEnd := sslVpnDynamicPool(prefix)
+	config := &openVpnConfig{
+		Network:        prefix.Addr().String(),
+		Netmask:        sslVpnNetmask(prefix),
+		PoolStart:      poolStart.String(),
+		PoolEnd:        poolEnd.String(),
+		Proto:          ssl.Proto,
+		Port:           ssl.Port,
+		Dev:            "tun0",
+		StatusFile:     "/openvpn-status.log",
+		ManagementPort: SslVpnManagementPort,
+		DhNone:         ssl.DisableDh,
+		TlsVersionMin:  ssl.TlsVersionMin,
+		Cipher:         ssl.Cipher,
+		DataCiphers:    sslVpnDataCiphers(ssl),
+		Digest:         sslVpnDigest(ssl),
+		Mtu:            ssl.Mtu,
+		LinkMtu:        DefaultSslVpnLinkMtu,
+		Compress:       ssl.Compress,
+		MaxClients:     ssl.MaxClients,
+		Auth:           ssl.Auth != nil,
+		Totp:           ssl.RequireTotp,
+		CcdPath:        SslVpnCcdPath,
+		FullTunnel:     ssl.TunnelMode == SslVpnTunnelFull,
+		DnsServers:     ssl.DnsServers,
+		SearchDomains:  ssl.SearchDomains,
+	}
+	if config.TlsVersionMin == "" {
+		config.TlsVersionMin = DefaultSslVpnTlsVersionMin
+	}
+	config.KeepaliveInterval, config.KeepaliveTimeout = sslVpnKeepalive(ssl)
+	if ssl.Auth != nil || ssl.RequireTotp {
+		config.RenegSec = int(sslVpnReauthInterval(ssl.Auth).Seconds())
+	}
+	for _, route := range ssl.Routes {
+		route, err := parseSslVpnRoute(route)
+		if err != nil {
+			return nil, err
+		}
+		config.Routes = append(config.Routes, route)
+	}
+	return config, nil
+}
+
+// renderOpenVpnConfig renders openvpn.conf of the ssl vpn server
+func renderOpenVpnConfig(config *openVpnConfig) (string, error) {
+	var conf bytes.Buffer
+	if err := openVpnConfTemplate.Execute(&conf, config); err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", SslVpnConfKey, err)
+	}
+	return conf.String(), nil
+}
+
+// newOpenVpnTcpConfig returns the configuration of the tcp fallback instance,
+// it shares the options of the udp instance but serves its own subnet
+func newOpenVpnTcpConfig(gw *vpngwv2.VpnGw, config *openVpnConfig) (*openVpnConfig, error) {
+	fallback := gw.Spec.SslVpn.TcpFallback
+	prefix, err := parseSslVpnSubnet(fallback.SubnetCidr)
+	if err != nil {
+		return nil, err
+	}
+	poolStart, poolEnd := sslVpnDynamicPool(prefix)
+	tcp := *config
+	tcp.Network = prefix.Addr().String()
+	tcp.Netmask = sslVpnNetmask(prefix)
+	tcp.PoolStart = poolStart.String()
+	tcp.PoolEnd = poolEnd.String()
+	tcp.Proto = "tcp"
+	tcp.Port = fallback.Port
+	tcp.Dev = SslVpnTcpDev
+	tcp.StatusFile = "/openvpn-status-tcp.log"
+	tcp.ManagementPort = SslVpnTcpManagementPort
+	tcp.CcdPath = SslVpnTcpCcdPath
+	return &tcp, nil
+}
+
+// renderSslVpnConfig renders openvpn.conf, and openvpn-tcp.conf if the tcp fallback is enabled
+func renderSslVpnConfig(gw *vpngwv2.VpnGw) (map[string]string, error) {
+	config, err := newOpenVpnConfig(gw)
+	if err != nil {
+		return nil, err
+	}
+	conf, err := renderOpenVpnConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	data := map[string]string{SslVpnConfKey: conf}
+	if gw.Spec.SslVpn.TcpFallback == nil {
+		return data, nil
+	}
+	tcpConfig, err := newOpenVpnTcpConfig(gw, config)
+	if err != nil {
+		return nil, err
+	}
+	if data[SslVpnTcpConfKey], err = renderOpenVpnConfig(tcpConfig); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// sslVpnConfHash returns the hash of the rendered configuration, empty if it fails to render
+func sslVpnConfHash(gw *vpngwv2.VpnGw) string {
+	data, err := renderSslVpnConfig(gw)
+	if err != nil {
+		return ""
+	}
+	hash := sha256.New()
+	for _, key := range []string{SslVpnConfKey, SslVpnTcpConfKey} {
+		if conf, ok := data[key]; ok {
+			fmt.Fprintf(hash, "%s\x00%s\x00", key, conf)
+		}
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// reconcileSslVpnConfig creates or updates the openvpn configmap of a vpn gw
+func (r *VpnGwReconciler) reconcileSslVpnConfig(ctx context.Context, gw *vpngwv2.VpnGw) error {
+	data, err := renderSslVpnConfig(gw)
+	if err != nil {
+		return err
+	}
+	cm := &corev1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gw.Name + SslVpnConfigMapSuffix,
+			Namespace: gw.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+		cm.Labels = labelsForVpnGw(gw)
+		cm.Data = data
+		return controllerutil.SetControllerReference(gw, cm, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ssl vpn configmap", "configmap", cm.Name)
+		return err
+	}
+	r.Log.Info("ssl vpn configmap reconciled", "configmap", cm.Name, "operation", op)
+	return nil
+}
@@ -0,0 +1,297 @@
+package controller
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+func newTestSslVpnGw() *vpngwv2.VpnGw {
+	return &vpngwv2.VpnGw{
+		ObjectMeta: metav1.ObjectMeta{Name: "gw", Namespace: "default"},
+		Spec: vpngwv2.VpnGwSpec{
+			SslVpn: vpngwv2.SslVpnSpec{
+				Enabled:    true,
+				Cipher:     "AES-256-GCM",
+				Proto:      "udp",
+				Port:       1194,
+				SubnetCidr: "10.240.0.0/16",
+			},
+		},
+	}
+}
+
+func renderTestOpenVpnConfig(t *testing.T, gw *vpngwv2.VpnGw) string {
+	t.Helper()
+	config, err := newOpenVpnConfig(gw)
+	if err != nil {
+		t.Fatalf("failed to build openvpn config: %v", err)
+	}
+	conf, err := renderOpenVpnConfig(config)
+	if err != nil {
+		t.Fatalf("failed to render openvpn config: %v", err)
+	}
+	return conf
+}
+
+func assertLines(t *testing.T, conf string, want, notWant []string) {
+	t.Helper()
+	lines := map[string]bool{}
+	for _, line := range strings.Split(conf, "\n") {
+		lines[line] = true
+	}
+	for _, line := range want {
+		if !lines[line] {
+			t.Errorf("missing line %q in:\n%s", line, conf)
+		}
+	}
+	for _, line := range notWant {
+		if lines[line] {
+			t.Errorf("unexpected line %q in:\n%s", line, conf)
+		}
+	}
+}
+
+func TestRenderOpenVpnConfigDefaults(t *testing.T) {
+	conf := renderTestOpenVpnConfig(t, newTestSslVpnGw())
+	assertLines(t, conf, []string{
+		"server 10.240.0.0 255.255.0.0 nopool",
+		"topology subnet",
+		"ifconfig-pool 10.240.0.2 10.240.127.255",
+		"proto udp",
+		"port 1194",
+		"dh /etc/openvpn/certs/pki/dh.pem",
+		"tls-version-min 1.2",
+		"data-ciphers AES-256-GCM",
+		"data-ciphers-fallback AES-256-GCM",
+		"auth SHA1",
+		"link-mtu 1300",
+		"keepalive 10 600",
+		"client-config-dir /etc/ovpn/ccd",
+		"management 127.0.0.1 7505",
+		"persist-tun",
+		"explicit-exit-notify 1",
+	}, []string{
+		"persist-key",
+		"dh none",
+		"auth-gen-token 900 external-auth",
+		`push "redirect-gateway def1 bypass-dhcp"`,
+	})
+	for _, option := range []string{"compress", "allow-compression", "max-clients", "tun-mtu", "auth-user-pass-verify", "reneg-sec"} {
+		if strings.Contains(conf, "\n"+option+" ") {
+			t.Errorf("unexpected option %s in:\n%s", option, conf)
+		}
+	}
+}
+
+func TestRenderOpenVpnConfigOptions(t *testing.T) {
+	gw := newTestSslVpnGw()
+	ssl := &gw.Spec.SslVpn
+	ssl.Proto = "tcp"
+	ssl.Port = 443
+	ssl.DisableDh = true
+	ssl.DataCiphers = []string{"AES-256-GCM", "CHACHA20-POLY1305"}
+	ssl.Digest = "SHA256"
+	ssl.TlsVersionMin = "1.3"
+	ssl.Mtu = 1400
+	ssl.KeepaliveInterval = 20
+	ssl.KeepaliveTimeout = 120
+	ssl.Compress = "stub-v2"
+	ssl.MaxClients = 100
+	conf := renderTestOpenVpnConfig(t, gw)
+	assertLines(t, conf, []string{
+		"proto tcp",
+		"port 443",
+		"dh none",
+		"tls-version-min 1.3",
+		"data-ciphers AES-256-GCM:CHACHA20-POLY1305",
+		"data-ciphers-fallback AES-256-GCM",
+		"auth SHA256",
+		"tun-mtu 1400",
+		"keepalive 20 120",
+		"allow-compression yes",
+		"compress stub-v2",
+		`push "compress stub-v2"`,
+		"max-clients 100",
+	}, []string{
+		"dh /etc/openvpn/certs/pki/dh.pem",
+		"link-mtu 1300",
+	})
+}
+
+func TestRenderOpenVpnConfigAuth(t *testing.T) {
+	gw := newTestSslVpnGw()
+	gw.Spec.SslVpn.Auth = &vpngwv2.SslVpnAuthSpec{
+		Type:           SslVpnAuthLdap,
+		ReauthInterval: &metav1.Duration{Duration: 30 * time.Minute},
+	}
+	gw.Spec.SslVpn.RequireTotp = true
+	conf := renderTestOpenVpnConfig(t, gw)
+	assertLines(t, conf, []string{
+		"script-security 2",
+		"auth-user-pass-verify /etc/openvpn/setup/auth-user-pass-verify.sh via-file",
+		"reneg-sec 1800",
+		"auth-gen-token 1800 external-auth",
+	}, nil)
+
+	gw.Spec.SslVpn.Auth.ReauthInterval = nil
+	conf = renderTestOpenVpnConfig(t, gw)
+	assertLines(t, conf, []string{
+		"reneg-sec 900",
+		"auth-gen-token 900 external-auth",
+	}, nil)
+}
+
+func TestRenderOpenVpnConfigPush(t *testing.T) {
+	gw := newTestSslVpnGw()
+	ssl := &gw.Spec.SslVpn
+	ssl.Routes = []string{"10.96.0.0/12", "192.168.1.0/24"}
+	ssl.DnsServers = []string{"10.96.0.10"}
+	ssl.SearchDomains = []string{"svc.cluster.local"}
+	ssl.TunnelMode = SslVpnTunnelFull
+	conf := renderTestOpenVpnConfig(t, gw)
+	assertLines(t, conf, []string{
+		`push "route 10.96.0.0 255.240.0.0"`,
+		`push "route 192.168.1.0 255.255.255.0"`,
+		`push "redirect-gateway def1 bypass-dhcp"`,
+		`push "dhcp-option DNS 10.96.0.10"`,
+		`push "dhcp-option DOMAIN-SEARCH svc.cluster.local"`,
+	}, nil)
+}
+
+func TestRenderOpenVpnConfigTcpFallback(t *testing.T) {
+	gw := newTestSslVpnGw()
+	gw.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.241.0.0/16"}
+	data, err := renderSslVpnConfig(gw)
+	if err != nil {
+		t.Fatalf("failed to render openvpn config: %v", err)
+	}
+	assertLines(t, data[SslVpnConfKey], []string{
+		"proto udp",
+		"port 1194",
+		"dev tun0",
+		"client-config-dir /etc/ovpn/ccd",
+	}, nil)
+	assertLines(t, data[SslVpnTcpConfKey], []string{
+		"server 10.241.0.0 255.255.0.0 nopool",
+		"ifconfig-pool 10.241.0.2 10.241.127.255",
+		"proto tcp",
+		"port 443",
+		"dev tun1",
+		"status /openvpn-status-tcp.log",
+		"client-config-dir /etc/ovpn/ccd-tcp",
+		"management 127.0.0.1 7506",
+	}, []string{
+		"explicit-exit-notify 1",
+	})
+
+	ip, err := sslVpnTcpFallbackIp(gw, "10.240.200.10")
+	if err != nil || ip.String() != "10.241.200.10" {
+		t.Errorf("expected tcp fallback ip 10.241.200.10, got %v, %v", ip, err)
+	}
+}
+
+func TestValidateSslVpnListeners(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(gw *vpngwv2.VpnGw)
+		valid  bool
+	}{
+		{"udp only", func(gw *vpngwv2.VpnGw) {}, true},
+		{"ipsec port", func(gw *vpngwv2.VpnGw) {
+			gw.Spec.IpsecVpn.Enabled = true
+			gw.Spec.SslVpn.Port = IpSecNatPort
+		}, false},
+		{"tcp fallback", func(gw *vpngwv2.VpnGw) {
+			gw.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.241.0.0/16"}
+		}, true},
+		{"tcp fallback of tcp", func(gw *vpngwv2.VpnGw) {
+			gw.Spec.SslVpn.Proto = "tcp"
+			gw.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.241.0.0/16"}
+		}, false},
+		{"tcp fallback prefix length", func(gw *vpngwv2.VpnGw) {
+			gw.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.241.0.0/24"}
+		}, false},
+		{"tcp fallback overlap", func(gw *vpngwv2.VpnGw) {
+			gw.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.240.0.0/16"}
+		}, false},
+		{"tcp fallback larger than /16", func(gw *vpngwv2.VpnGw) {
+			gw.Spec.SslVpn.SubnetCidr = "10.240.0.0/15"
+			gw.Spec.SslVpn.TcpFallback = &vpngwv2.SslVpnTcpFallback{Port: 443, SubnetCidr: "10.242.0.0/15"}
+		}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newTestSslVpnGw()
+			tt.modify(gw)
+			err := validateSslVpnListeners(gw)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected invalid")
+			}
+		})
+	}
+}
+
+func TestValidateOpenVpnConfig(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(ssl *vpngwv2.SslVpnSpec)
+		valid  bool
+	}{
+		{"defaults", func(ssl *vpngwv2.SslVpnSpec) {}, true},
+		{"data ciphers", func(ssl *vpngwv2.SslVpnSpec) { ssl.DataCiphers = []string{"AES-128-GCM"} }, true},
+		{"invalid cipher", func(ssl *vpngwv2.SslVpnSpec) { ssl.DataCiphers = []string{"AES-256-GCM:BF-CBC"} }, false},
+		{"invalid digest", func(ssl *vpngwv2.SslVpnSpec) { ssl.Digest = "SHA256\npush" }, false},
+		{"invalid tls version", func(ssl *vpngwv2.SslVpnSpec) { ssl.TlsVersionMin = "1.1" }, false},
+		{"small mtu", func(ssl *vpngwv2.SslVpnSpec) { ssl.Mtu = 500 }, false},
+		{"keepalive interval", func(ssl *vpngwv2.SslVpnSpec) { ssl.KeepaliveInterval = 60 }, true},
+		{"keepalive timeout less than twice the interval", func(ssl *vpngwv2.SslVpnSpec) {
+			ssl.KeepaliveInterval = 60
+			ssl.KeepaliveTimeout = 100
+		}, false},
+		{"invalid compress", func(ssl *vpngwv2.SslVpnSpec) { ssl.Compress = "lzo" }, false},
+		{"negative max clients", func(ssl *vpngwv2.SslVpnSpec) { ssl.MaxClients = -1 }, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gw := newTestSslVpnGw()
+			tt.modify(&gw.Spec.SslVpn)
+			err := validateOpenVpnConfig(&gw.Spec.SslVpn)
+			if tt.valid && err != nil {
+				t.Errorf("expected valid, got %v", err)
+			}
+			if !tt.valid && err == nil {
+				t.Errorf("expected invalid")
+			}
+		})
+	}
+}
+
+func TestSslVpnClientEnv(t *testing.T) {
+	gw := newTestSslVpnGw()
+	env := map[string]string{}
+	for _, e := range sslVpnClientEnv(&gw.Spec.SslVpn) {
+		env[e.Name] = e.Value
+	}
+	if env[OvpnDataCiphersKey] != "AES-256-GCM" || env[OvpnDigestKey] != DefaultSslVpnDigest || env[OvpnLinkMtuKey] != "1300" || env[OvpnTunMtuKey] != "" {
+		t.Errorf("unexpected default client env %v", env)
+	}
+
+	gw.Spec.SslVpn.DataCiphers = []string{"AES-256-GCM", "CHACHA20-POLY1305"}
+	gw.Spec.SslVpn.Digest = "SHA256"
+	gw.Spec.SslVpn.Mtu = 1400
+	env = map[string]string{}
+	for _, e := range sslVpnClientEnv(&gw.Spec.SslVpn) {
+		env[e.Name] = e.Value
+	}
+	if env[OvpnDataCiphersKey] != "AES-256-GCM:CHACHA20-POLY1305" || env[OvpnDigestKey] != "SHA256" || env[OvpnTunMtuKey] != "1400" || env[OvpnLinkMtuKey] != "" {
+		t.Errorf("unexpected client env %v", env)
+	}
+}
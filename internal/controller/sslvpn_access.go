@@ -0,0 +1,322 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// client config dir of the ssl vpn server keyed by the client CN, <vpn gw>-ssl-vpn-ccd
+	SslVpnCcdConfigMapSuffix = "-ssl-vpn-ccd"
+	SslVpnCcdPath            = "/etc/ovpn/ccd"
+
+	// access rules of the clients keyed by the client CN, <vpn gw>-ssl-vpn-access,
+	// applied by access-policy.sh in the ssl container once openvpn learns the client address
+	SslVpnAccessConfigMapSuffix = "-ssl-vpn-access"
+	SslVpnAccessPath            = "/etc/ovpn/access"
+	// a CN never starts with a dot
+	SslVpnAccessDefaultKey = ".default"
+	SslVpnAccessHashKey    = ".hash"
+
+	// apply the changed access rules and rate limits to the connected clients, the argument is the hash of them,
+	// the script waits for kubelet to refresh the mounted configmaps
+	SslVpnAccessReloadCMD = "/etc/openvpn/setup/access-policy.sh reload"
+)
+
+// CN of the client certificate, it is the file name in the client config dir
+var sslVpnCNRegexp = regexp.MustCompile(`^[-_a-zA-Z0-9][-._a-zA-Z0-9]*$`)
+
+// validateVpnAccessRule validates the destination of the access rule, the ssl vpn client pool is ipv4 only
+func validateVpnAccessRule(rule vpngwv2.VpnAccessRule) error {
+	prefix, err := netip.ParsePrefix(rule.Cidr)
+	if err != nil || !prefix.Addr().Is4() || prefix.Masked() != prefix {
+		return fmt.Errorf("access rule cidr %q should be an ipv4 cidr", rule.Cidr)
+	}
+	switch rule.Protocol {
+	case "", "tcp", "udp":
+	case "icmp":
+		if len(rule.Ports) != 0 {
+			return fmt.Errorf("access rule ports require tcp or udp")
+		}
+	default:
+		return fmt.Errorf("access rule protocol %q is invalid", rule.Protocol)
+	}
+	for _, port := range rule.Ports {
+		from, to, isRange := strings.Cut(port, "-")
+		if !isRange {
+			to = from
+		}
+		start, err1 := strconv.Atoi(from)
+		end, err2 := strconv.Atoi(to)
+		if err1 != nil || err2 != nil || start < 1 || end > 65535 || start > end {
+			return fmt.Errorf("access rule port %q is invalid", port)
+		}
+	}
+	return nil
+}
+
+// validateVpnAccessPolicyRules validates the CNs and the rules rendered into the ssl vpn client config
+func validateVpnAccessPolicyRules(policy *vpngwv2.VpnAccessPolicy) error {
+	for _, cn := range policy.Spec.CNs {
+		if !sslVpnCNRegexp.MatchString(cn) {
+			return fmt.Errorf("vpn access policy cn %q is invalid", cn)
+		}
+	}
+	for _, rule := range policy.Spec.Rules {
+		if err := validateVpnAccessRule(rule); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// vpnAccessRuleArgs returns the iptables match arguments of the access rule, one rule per line
+func vpnAccessRuleArgs(rule vpngwv2.VpnAccessRule) []string {
+	protocols := []string{rule.Protocol}
+	if rule.Protocol == "" && len(rule.Ports) != 0 {
+		protocols = []string{"tcp", "udp"}
+	}
+	args := []string{}
+	for _, proto := range protocols {
+		match := "-d " + rule.Cidr
+		if proto != "" {
+			match += " -p " + proto
+		}
+		if len(rule.Ports) == 0 {
+			args = append(args, match)
+			continue
+		}
+		for _, port := range rule.Ports {
+			args = append(args, match+" --dport "+strings.Replace(port, "-", ":", 1))
+		}
+	}
+	return args
+}
+
+// vpnAccessRoute returns the route pushed to the clients for the access rule
+func vpnAccessRoute(rule vpngwv2.VpnAccessRule) string {
+	prefix := netip.MustParsePrefix(rule.Cidr)
+	return fmt.Sprintf("push \"route %s %s\"", prefix.Addr(), sslVpnNetmask(prefix))
+}
+
+// vpnAccessPolicyCNs returns the CNs of the clients which the policy applies to
+func vpnAccessPolicyCNs(policy *vpngwv2.VpnAccessPolicy, clients []vpngwv2.SslVpnClient) []string {
+	cns := map[string]bool{}
+	for _, cn := range policy.Spec.CNs {
+		cns[cn] = true
+	}
+	for i := range clients {
+		c := &clients[i]
+		if c.Spec.VpnGw != policy.Spec.VpnGw {
+			continue
+		}
+		for _, group := range c.Spec.Groups {
+			for _, want := range policy.Spec.Groups {
+				if group == want {
+					cns[sslVpnClientCN(c)] = true
+				}
+			}
+		}
+	}
+	res := make([]string, 0, len(cns))
+	for cn := range cns {
+		res = append(res, cn)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// sslVpnClientConfig is the client config dir entries, the access rules and the rate limits of the ssl vpn clients keyed by CN,
+// the tcp fallback listener has its own client config dir
+type sslVpnClientConfig struct {
+	Ccd       map[string][]string
+	TcpCcd    map[string][]string
+	Access    map[string][]string
+	Bandwidth map[string][]string
+}
+
+func newSslVpnClientConfig() *sslVpnClientConfig {
+	return &sslVpnClientConfig{
+		Ccd:       map[string][]string{},
+		TcpCcd:    map[string][]string{},
+		Access:    map[string][]string{},
+		Bandwidth: map[string][]string{},
+	}
+}
+
+// addLine appends the line unless the CN has it already
+func addLine(lines map[string][]string, cn, line string) {
+	for _, l := range lines[cn] {
+		if l == line {
+			return
+		}
+	}
+	lines[cn] = append(lines[cn], line)
+}
+
+// addAccessPolicies adds the access rules and the pushed routes of the policies, the policies are sorted by name
+func (c *sslVpnClientConfig) addAccessPolicies(policies []vpngwv2.VpnAccessPolicy, clients []vpngwv2.SslVpnClient) {
+	for i := range policies {
+		policy := &policies[i]
+		for _, cn := range vpnAccessPolicyCNs(policy, clients) {
+			// the matched clients get the routes of their policies instead of the whole subnet
+			addLine(c.Ccd, cn, "push-remove route")
+			addLine(c.TcpCcd, cn, "push-remove route")
+			for _, rule := range policy.Spec.Rules {
+				for _, args := range vpnAccessRuleArgs(rule) {
+					addLine(c.Access, cn, args)
+				}
+				addLine(c.Ccd, cn, vpnAccessRoute(rule))
+				addLine(c.TcpCcd, cn, vpnAccessRoute(rule))
+			}
+		}
+	}
+}
+
+func renderLines(lines map[string][]string) map[string]string {
+	data := map[string]string{}
+	for cn, l := range lines {
+		data[cn] = strings.Join(l, "\n") + "\n"
+	}
+	return data
+}
+
+// render returns the data of the client configmaps keyed by the configmap suffix, the access configmap has the default access,
+// both the access and the bandwidth configmaps have the hash of the access rules and the rate limits
+func (c *sslVpnClientConfig) render(gw *vpngwv2.VpnGw) map[string]map[string]string {
+	access := renderLines(c.Access)
+	defaultAccess := gw.Spec.SslVpn.DefaultAccess
+	if defaultAccess == "" {
+		defaultAccess = vpngwv2.VpnAccessAllow
+	}
+	access[SslVpnAccessDefaultKey] = defaultAccess
+	bandwidth := renderLines(c.Bandwidth)
+
+	hash := sha256.New()
+	for _, data := range []map[string]string{access, bandwidth} {
+		keys := make([]string, 0, len(data))
+		for key := range data {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			fmt.Fprintf(hash, "%s\x00%s\x00", key, data[key])
+		}
+		fmt.Fprint(hash, "\x00")
+	}
+	access[SslVpnAccessHashKey] = hex.EncodeToString(hash.Sum(nil))
+	bandwidth[SslVpnAccessHashKey] = access[SslVpnAccessHashKey]
+	return map[string]map[string]string{
+		SslVpnCcdConfigMapSuffix:       renderLines(c.Ccd),
+		SslVpnTcpCcdConfigMapSuffix:    renderLines(c.TcpCcd),
+		SslVpnAccessConfigMapSuffix:    access,
+		SslVpnBandwidthConfigMapSuffix: bandwidth,
+	}
+}
+
+// getVpnAccessPolicies returns the access policies of the vpn gw sorted by name
+func (r *VpnGwReconciler) getVpnAccessPolicies(ctx context.Context, gw *vpngwv2.VpnGw) ([]vpngwv2.VpnAccessPolicy, error) {
+	policies := &vpngwv2.VpnAccessPolicyList{}
+	if err := r.List(ctx, policies, client.InNamespace(gw.Namespace), client.MatchingLabels{VpnGwLabel: gw.Name}); err != nil {
+		return nil, err
+	}
+	res := []vpngwv2.VpnAccessPolicy{}
+	for _, policy := range policies.Items {
+		if policy.Spec.VpnGw != gw.Name {
+			continue
+		}
+		if err := validateVpnAccessPolicyRules(&policy); err != nil {
+			r.Log.Error(err, "skip invalid vpn access policy", "vpnAccessPolicy", policy.Name)
+			continue
+		}
+		res = append(res, policy)
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Name < res[j].Name })
+	return res, nil
+}
+
+// reconcileSslVpnClientConfig renders the client config dir, the static ips, the access rules and the rate limits
+// of the ssl vpn clients, returns the hash of the access rules and the rate limits
+func (r *VpnGwReconciler) reconcileSslVpnClientConfig(ctx context.Context, gw *vpngwv2.VpnGw) (string, error) {
+	clients, err := r.getSslVpnClients(ctx, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients")
+		return "", err
+	}
+	policies, err := r.getVpnAccessPolicies(ctx, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list vpn access policies")
+		return "", err
+	}
+	config := newSslVpnClientConfig()
+	config.addStaticIps(gw, clients)
+	config.addAccessPolicies(policies, clients)
+	config.addBandwidth(policies, clients)
+	configMaps := config.render(gw)
+	hash := configMaps[SslVpnAccessConfigMapSuffix][SslVpnAccessHashKey]
+
+	if gw.Spec.SslVpn.TcpFallback == nil {
+		// the tcp fallback is disabled
+		delete(configMaps, SslVpnTcpCcdConfigMapSuffix)
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      gw.Name + SslVpnTcpCcdConfigMapSuffix,
+				Namespace: gw.Namespace,
+			},
+		}
+		if err := r.Delete(ctx, cm); client.IgnoreNotFound(err) != nil {
+			r.Log.Error(err, "failed to delete ssl vpn client configmap", "configmap", cm.Name)
+			return "", err
+		}
+	}
+	for suffix, data := range configMaps {
+		name := gw.Name + suffix
+		cm := &corev1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      name,
+				Namespace: gw.Namespace,
+			},
+		}
+		data := data
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Client, cm, func() error {
+			cm.Labels = labelsForVpnGw(gw)
+			cm.Data = data
+			return controllerutil.SetControllerReference(gw, cm, r.Scheme)
+		})
+		if err != nil {
+			r.Log.Error(err, "failed to create or update ssl vpn client configmap", "configmap", name)
+			return "", err
+		}
+		r.Log.Info("ssl vpn client configmap reconciled", "configmap", name, "operation", op)
+	}
+	return hash, nil
+}
+
+// reloadSslVpnAccess applies the changed access rules and rate limits to the connected clients,
+// returns the hash of them applied by the ssl vpn server
+func (r *VpnGwReconciler) reloadSslVpnAccess(gw *vpngwv2.VpnGw, pod *corev1.Pod, hash string, restarted bool) (string, error) {
+	// a restarted server applies the current access rules once the clients connect
+	if restarted || hash == gw.Status.SslVpnAccessHash {
+		return hash, nil
+	}
+	r.Log.Info("access rules or rate limits changed, reload them", "hash", hash)
+	stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, SslVpnServer, []string{"/bin/bash", "-c", SslVpnAccessReloadCMD + " " + hash}...)
+	if err != nil {
+		return "", fmt.Errorf("failed to reload access rules, stdOutput: %v, errOutput: %v, err: %v", stdOutput, errOutput, err)
+	}
+	return hash, nil
+}
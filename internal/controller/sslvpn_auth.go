@@ -0,0 +1,153 @@
+package controller
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// ssl vpn user name and password authentication, verified by auth-user-pass-verify.sh in the ssl container
+	SslVpnAuthLdap = "ldap"
+	SslVpnAuthOidc = "oidc"
+
+	SslVpnOidcFlowPassword = "password"
+	SslVpnOidcFlowToken    = "token"
+
+	// the ldap bind secret or the oidc client secret
+	SslVpnAuthSecretPath = "/etc/ovpn/auth"
+	SslVpnAuthVolume     = "ssl-vpn-auth"
+
+	// openvpn checks the identity provider on renegotiation only, a user removed from it keeps the session
+	// for up to the reauth interval, so the default is kept short
+	DefaultSslVpnReauthInterval = 15 * time.Minute
+	DefaultLdapUserFilter       = "(uid=%u)"
+	DefaultOidcUsernameClaim    = "preferred_username"
+	DefaultOidcGroupsClaim      = "groups"
+
+	// vpn gw pod env
+	OvpnAuthKey              = "OVPN_AUTH"
+	OvpnLdapUrlKey           = "OVPN_LDAP_URL"
+	OvpnLdapBaseDnKey        = "OVPN_LDAP_BASE_DN"
+	OvpnLdapUserFilterKey    = "OVPN_LDAP_USER_FILTER"
+	OvpnLdapGroupFilterKey   = "OVPN_LDAP_GROUP_FILTER"
+	OvpnOidcIssuerKey        = "OVPN_OIDC_ISSUER"
+	OvpnOidcFlowKey          = "OVPN_OIDC_FLOW"
+	OvpnOidcClientIdKey      = "OVPN_OIDC_CLIENT_ID"
+	OvpnOidcUsernameClaimKey = "OVPN_OIDC_USERNAME_CLAIM"
+	OvpnOidcGroupsClaimKey   = "OVPN_OIDC_GROUPS_CLAIM"
+	OvpnOidcGroupsKey        = "OVPN_OIDC_GROUPS"
+)
+
+// validateSslVpnAuth validates the user name and password authentication of the ssl vpn
+func validateSslVpnAuth(auth *vpngwv2.SslVpnAuthSpec) error {
+	if auth.ReauthInterval != nil && auth.ReauthInterval.Duration < time.Minute {
+		return fmt.Errorf("ssl vpn reauth interval %s should be 1m at least", auth.ReauthInterval.Duration)
+	}
+	switch auth.Type {
+	case SslVpnAuthLdap:
+		ldap := auth.Ldap
+		if ldap == nil || ldap.Url == "" || ldap.BindSecret == "" || ldap.BaseDn == "" {
+			return fmt.Errorf("ssl vpn ldap url, bind secret and base dn are required")
+		}
+		u, err := url.Parse(ldap.Url)
+		if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+			return fmt.Errorf("ssl vpn ldap url %q is invalid", ldap.Url)
+		}
+		if ldap.UserFilter != "" && !strings.Contains(ldap.UserFilter, "%u") {
+			return fmt.Errorf("ssl vpn ldap user filter %q should contain %%u", ldap.UserFilter)
+		}
+	case SslVpnAuthOidc:
+		oidc := auth.Oidc
+		if oidc == nil || oidc.Issuer == "" || oidc.ClientId == "" {
+			return fmt.Errorf("ssl vpn oidc issuer and client id are required")
+		}
+		u, err := url.Parse(oidc.Issuer)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return fmt.Errorf("ssl vpn oidc issuer %q should be a https url", oidc.Issuer)
+		}
+		if oidc.Flow != "" && oidc.Flow != SslVpnOidcFlowPassword && oidc.Flow != SslVpnOidcFlowToken {
+			return fmt.Errorf("ssl vpn oidc flow %q is invalid", oidc.Flow)
+		}
+		for _, group := range oidc.Groups {
+			if group == "" || strings.Contains(group, ",") {
+				return fmt.Errorf("ssl vpn oidc group %q is invalid", group)
+			}
+		}
+	default:
+		return fmt.Errorf("ssl vpn auth type %q is invalid", auth.Type)
+	}
+	return nil
+}
+
+// sslVpnAuthSecret returns the secret mounted for the ssl vpn authentication, empty if none
+func sslVpnAuthSecret(auth *vpngwv2.SslVpnAuthSpec) string {
+	switch {
+	case auth == nil:
+		return ""
+	case auth.Type == SslVpnAuthLdap && auth.Ldap != nil:
+		return auth.Ldap.BindSecret
+	case auth.Type == SslVpnAuthOidc && auth.Oidc != nil:
+		return auth.Oidc.ClientSecret
+	}
+	return ""
+}
+
+// sslVpnReauthInterval returns the renegotiation interval of the authenticated clients
+func sslVpnReauthInterval(auth *vpngwv2.SslVpnAuthSpec) time.Duration {
+	if auth != nil && auth.ReauthInterval != nil {
+		return auth.ReauthInterval.Duration
+	}
+	return DefaultSslVpnReauthInterval
+}
+
+// sslVpnAuthEnv returns the ssl container env of the authentication, configure.sh saves it for the verify script
+func sslVpnAuthEnv(auth *vpngwv2.SslVpnAuthSpec) []corev1.EnvVar {
+	if auth == nil {
+		return nil
+	}
+	env := []corev1.EnvVar{
+		{Name: OvpnAuthKey, Value: auth.Type},
+	}
+	switch {
+	case auth.Type == SslVpnAuthLdap && auth.Ldap != nil:
+		filter := auth.Ldap.UserFilter
+		if filter == "" {
+			filter = DefaultLdapUserFilter
+		}
+		env = append(env,
+			corev1.EnvVar{Name: OvpnLdapUrlKey, Value: auth.Ldap.Url},
+			corev1.EnvVar{Name: OvpnLdapBaseDnKey, Value: auth.Ldap.BaseDn},
+			corev1.EnvVar{Name: OvpnLdapUserFilterKey, Value: filter},
+			corev1.EnvVar{Name: OvpnLdapGroupFilterKey, Value: auth.Ldap.GroupFilter},
+		)
+	case auth.Type == SslVpnAuthOidc && auth.Oidc != nil:
+		oidc := auth.Oidc
+		flow := oidc.Flow
+		if flow == "" {
+			flow = SslVpnOidcFlowPassword
+		}
+		usernameClaim := oidc.UsernameClaim
+		if usernameClaim == "" {
+			usernameClaim = DefaultOidcUsernameClaim
+		}
+		groupsClaim := oidc.GroupsClaim
+		if groupsClaim == "" {
+			groupsClaim = DefaultOidcGroupsClaim
+		}
+		env = append(env,
+			corev1.EnvVar{Name: OvpnOidcIssuerKey, Value: oidc.Issuer},
+			corev1.EnvVar{Name: OvpnOidcFlowKey, Value: flow},
+			corev1.EnvVar{Name: OvpnOidcClientIdKey, Value: oidc.ClientId},
+			corev1.EnvVar{Name: OvpnOidcUsernameClaimKey, Value: usernameClaim},
+			corev1.EnvVar{Name: OvpnOidcGroupsClaimKey, Value: groupsClaim},
+			corev1.EnvVar{Name: OvpnOidcGroupsKey, Value: strings.Join(oidc.Groups, ",")},
+		)
+	}
+	return env
+}
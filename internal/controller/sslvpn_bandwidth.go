@@ -0,0 +1,60 @@
+package controller
+
+import (
+	"fmt"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// rate limits of the clients keyed by the client CN, <vpn gw>-ssl-vpn-bandwidth,
+	// applied with tc on the tun devices by access-policy.sh once openvpn learns the client address
+	SslVpnBandwidthConfigMapSuffix = "-ssl-vpn-bandwidth"
+	SslVpnBandwidthPath            = "/etc/ovpn/bandwidth"
+)
+
+// lowerRate returns the lower rate, zero is unlimited
+func lowerRate(a, b int32) int32 {
+	if a <= 0 {
+		return b
+	}
+	if b <= 0 || a < b {
+		return a
+	}
+	return b
+}
+
+// addBandwidth adds the rate limits of the policies and the clients, the bandwidth of a client overrides its policies,
+// every line is the upload and the download rate in Mbps, zero is unlimited
+func (c *sslVpnClientConfig) addBandwidth(policies []vpngwv2.VpnAccessPolicy, clients []vpngwv2.SslVpnClient) {
+	bandwidth := map[string]vpngwv2.SslVpnBandwidth{}
+	for i := range policies {
+		policy := &policies[i]
+		if policy.Spec.Bandwidth == nil {
+			continue
+		}
+		for _, cn := range vpnAccessPolicyCNs(policy, clients) {
+			b, ok := bandwidth[cn]
+			if !ok {
+				bandwidth[cn] = *policy.Spec.Bandwidth
+				continue
+			}
+			b.Upload = lowerRate(b.Upload, policy.Spec.Bandwidth.Upload)
+			b.Download = lowerRate(b.Download, policy.Spec.Bandwidth.Download)
+			bandwidth[cn] = b
+		}
+	}
+	for i := range clients {
+		if clients[i].Spec.Bandwidth != nil {
+			bandwidth[sslVpnClientCN(&clients[i])] = *clients[i].Spec.Bandwidth
+		}
+	}
+	for cn, b := range bandwidth {
+		// negative rates are unlimited as well
+		upload, download := lowerRate(b.Upload, 0), lowerRate(b.Download, 0)
+		if upload == 0 && download == 0 {
+			continue
+		}
+		c.Bandwidth[cn] = []string{fmt.Sprintf("%d %d", upload, download)}
+	}
+}
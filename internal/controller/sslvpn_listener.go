@@ -0,0 +1,77 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// the tcp fallback listener is served by another openvpn instance with its own tun and client config dir
+	SslVpnTcpConfKey            = "openvpn-tcp.conf"
+	SslVpnTcpDev                = "tun1"
+	SslVpnTcpCcdConfigMapSuffix = "-ssl-vpn-ccd-tcp"
+	SslVpnTcpCcdPath            = "/etc/ovpn/ccd-tcp"
+
+	// vpn gw pod env, newClientCert.sh adds the tcp remote to the client profiles
+	OvpnTcpPortKey       = "OVPN_TCP_PORT"
+	OvpnTcpSubnetCidrKey = "OVPN_TCP_SUBNET_CIDR"
+)
+
+// validateSslVpnListeners validates the ports of the ssl vpn do not conflict with the ipsec vpn,
+// and the subnet of the tcp fallback listener
+func validateSslVpnListeners(gw *vpngwv2.VpnGw) error {
+	ssl := &gw.Spec.SslVpn
+	if ssl.Port < 1 || ssl.Port > 65535 {
+		return fmt.Errorf("ssl vpn port %d is invalid", ssl.Port)
+	}
+	if gw.Spec.IpsecVpn.Enabled && ssl.Proto == "udp" {
+		switch ssl.Port {
+		case IpSecIsakmpPort, IpSecNatPort, IpSecBootPcPort:
+			return fmt.Errorf("ssl vpn udp port %d is used by the ipsec vpn", ssl.Port)
+		}
+	}
+	fallback := ssl.TcpFallback
+	if fallback == nil {
+		return nil
+	}
+	if ssl.Proto != "udp" {
+		return fmt.Errorf("ssl vpn tcp fallback requires udp proto")
+	}
+	if fallback.Port < 1 || fallback.Port > 65535 {
+		return fmt.Errorf("ssl vpn tcp fallback port %d is invalid", fallback.Port)
+	}
+	prefix, err := parseSslVpnSubnet(ssl.SubnetCidr)
+	if err != nil {
+		return err
+	}
+	tcpPrefix, err := parseSslVpnSubnet(fallback.SubnetCidr)
+	if err != nil {
+		return err
+	}
+	if tcpPrefix.Bits() != prefix.Bits() {
+		return fmt.Errorf("ssl vpn tcp fallback subnet cidr %s should have the same prefix length as %s", fallback.SubnetCidr, ssl.SubnetCidr)
+	}
+	if tcpPrefix.Overlaps(prefix) {
+		return fmt.Errorf("ssl vpn tcp fallback subnet cidr %s overlaps %s", fallback.SubnetCidr, ssl.SubnetCidr)
+	}
+	return nil
+}
+
+// sslVpnTcpFallbackIp maps the static ip of a client to the same offset of the tcp fallback subnet
+func sslVpnTcpFallbackIp(gw *vpngwv2.VpnGw, ip string) (netip.Addr, error) {
+	prefix, err := parseSslVpnSubnet(gw.Spec.SslVpn.SubnetCidr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	tcpPrefix, err := parseSslVpnSubnet(gw.Spec.SslVpn.TcpFallback.SubnetCidr)
+	if err != nil {
+		return netip.Addr{}, err
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is4() || !prefix.Contains(addr) {
+		return netip.Addr{}, fmt.Errorf("ssl vpn client ip %q is not in %s", ip, prefix)
+	}
+	return addrAt(tcpPrefix, addrToUint32(addr)-addrToUint32(prefix.Addr())), nil
+}
@@ -0,0 +1,70 @@
+package controller
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// split tunnels the pushed routes only, full tunnels all the traffic by redirect-gateway
+	SslVpnTunnelSplit = "split"
+	SslVpnTunnelFull  = "full"
+
+	// vpn gw pod env, newClientCert.sh renders the tunnel mode into the client profiles,
+	// configure.sh pushes the search domains of the pod if no search domain is set
+	OvpnTunnelModeKey    = "OVPN_TUNNEL_MODE"
+	OvpnSearchDomainsKey = "OVPN_SEARCH_DOMAINS"
+)
+
+// validateSslVpnPush validates the routes, dns servers and search domains pushed to the ssl vpn clients
+func validateSslVpnPush(ssl *vpngwv2.SslVpnSpec) error {
+	switch ssl.TunnelMode {
+	case "", SslVpnTunnelSplit, SslVpnTunnelFull:
+	default:
+		return fmt.Errorf("ssl vpn tunnel mode %q is invalid", ssl.TunnelMode)
+	}
+	for _, route := range ssl.Routes {
+		if _, err := parseSslVpnRoute(route); err != nil {
+			return err
+		}
+	}
+	for _, server := range ssl.DnsServers {
+		addr, err := netip.ParseAddr(server)
+		if err != nil || !addr.Is4() {
+			return fmt.Errorf("ssl vpn dns server %q should be an ipv4 address", server)
+		}
+	}
+	for _, domain := range ssl.SearchDomains {
+		if errs := validation.IsDNS1123Subdomain(domain); len(errs) != 0 {
+			return fmt.Errorf("ssl vpn search domain %q is invalid: %s", domain, strings.Join(errs, ", "))
+		}
+	}
+	return nil
+}
+
+// parseSslVpnRoute returns the address and the netmask of the route pushed to the clients
+func parseSslVpnRoute(route string) (string, error) {
+	prefix, err := netip.ParsePrefix(route)
+	if err != nil || !prefix.Addr().Is4() || prefix.Masked() != prefix {
+		return "", fmt.Errorf("ssl vpn route %q should be an ipv4 cidr", route)
+	}
+	return prefix.Addr().String() + " " + sslVpnNetmask(prefix), nil
+}
+
+// sslVpnPushEnv returns the ssl container env of the pushed options
+func sslVpnPushEnv(ssl *vpngwv2.SslVpnSpec) []corev1.EnvVar {
+	mode := ssl.TunnelMode
+	if mode == "" {
+		mode = SslVpnTunnelSplit
+	}
+	return []corev1.EnvVar{
+		{Name: OvpnTunnelModeKey, Value: mode},
+		{Name: OvpnSearchDomainsKey, Value: strings.Join(ssl.SearchDomains, " ")},
+	}
+}
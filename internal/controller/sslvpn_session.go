@@ -0,0 +1,256 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// openvpn management interface on localhost of the ssl container, one port per openvpn instance
+	SslVpnManagementPort    = 7505
+	SslVpnTcpManagementPort = 7506
+
+	SslVpnManagementCMD = "/etc/openvpn/setup/management.sh"
+
+	// the clients are disconnected once their session is deleted
+	VpnSessionFinalizer = "vpn-gw.kube-combo.com/vpn-session"
+
+	// all the connected clients are disconnected with the message once the annotation changes,
+	// openvpn can not send a text without disconnecting, the clients show it and reconnect
+	SslVpnBroadcastAnnotation = "vpn-gw.kube-combo.com/ssl-vpn-broadcast"
+
+	SslVpnSessionSyncInterval = 30 * time.Second
+)
+
+// sslVpnSession is a client listed by the openvpn management interface
+type sslVpnSession struct {
+	Proto  string
+	CN     string
+	Status vpngwv2.VpnSessionStatus
+}
+
+// parseSslVpnSessions parses the output of management.sh status,
+// the proto of the listener followed by a CLIENT_LIST line of openvpn status 3 per client
+func parseSslVpnSessions(output string) []sslVpnSession {
+	sessions := []sslVpnSession{}
+	for _, line := range strings.Split(output, "\n") {
+		// proto, CLIENT_LIST, common name, real address, virtual address, virtual ipv6 address,
+		// bytes received, bytes sent, connected since, connected since (time_t), username, client id, peer id, cipher
+		fields := strings.Split(strings.TrimRight(line, "\r"), "\t")
+		if len(fields) < 12 || fields[1] != "CLIENT_LIST" {
+			continue
+		}
+		session := sslVpnSession{
+			Proto: fields[0],
+			CN:    fields[2],
+			Status: vpngwv2.VpnSessionStatus{
+				RealAddress:    fields[3],
+				VirtualAddress: fields[4],
+			},
+		}
+		session.Status.BytesReceived, _ = strconv.ParseInt(fields[6], 10, 64)
+		session.Status.BytesSent, _ = strconv.ParseInt(fields[7], 10, 64)
+		if since, err := strconv.ParseInt(fields[9], 10, 64); err == nil {
+			t := metav1.NewTime(time.Unix(since, 0))
+			session.Status.ConnectedSince = &t
+		}
+		if fields[10] != "UNDEF" {
+			session.Status.Username = fields[10]
+		}
+		if len(fields) > 13 {
+			session.Status.Cipher = fields[13]
+		}
+		sessions = append(sessions, session)
+	}
+	return sessions
+}
+
+// vpnSessionName returns the name of the session, openvpn allows one session per CN in each listener
+func vpnSessionName(gw, proto, cn string) string {
+	hash := sha256.Sum256([]byte(cn))
+	return fmt.Sprintf("%s-%s-%s", gw, proto, hex.EncodeToString(hash[:])[:10])
+}
+
+// validateVpnSession validates the arguments of management.sh kill
+func validateVpnSession(session *vpngwv2.VpnSession) error {
+	if session.Spec.Proto != "udp" && session.Spec.Proto != "tcp" {
+		return fmt.Errorf("vpn session proto %q should be udp or tcp", session.Spec.Proto)
+	}
+	if !sslVpnCNRegexp.MatchString(session.Spec.CN) {
+		return fmt.Errorf("vpn session cn %q is invalid", session.Spec.CN)
+	}
+	return nil
+}
+
+// broadcastSslVpn sends the message of the broadcast annotation to the connected clients once it changes,
+// returns the message sent
+func (r *VpnGwReconciler) broadcastSslVpn(gw *vpngwv2.VpnGw, pod *corev1.Pod) (string, error) {
+	message := gw.Annotations[SslVpnBroadcastAnnotation]
+	if message == "" || message == gw.Status.SslVpnBroadcast {
+		return message, nil
+	}
+	// the message is quoted in the management command
+	if strings.ContainsAny(message, "\"\\\r\n") {
+		err := fmt.Errorf("ssl vpn broadcast message should be a single line without quotes and backslashes")
+		r.Log.Error(err, "ignore invalid ssl vpn broadcast message")
+		return gw.Status.SslVpnBroadcast, nil
+	}
+	r.Log.Info("broadcast to ssl vpn clients", "message", message)
+	stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, SslVpnServer, SslVpnManagementCMD, "broadcast", message)
+	if err != nil {
+		return "", fmt.Errorf("failed to broadcast to ssl vpn clients, stdOutput: %v, errOutput: %v, err: %v", stdOutput, errOutput, err)
+	}
+	return message, nil
+}
+
+// SslVpnSessionMonitor lists the clients connected to the ssl vpn servers periodically,
+// and keeps a VpnSession for each of them
+type SslVpnSessionMonitor struct {
+	Client     client.Client
+	KubeClient kubernetes.Interface
+	RestConfig *rest.Config
+	Log        logr.Logger
+	Scheme     *runtime.Scheme
+}
+
+// NeedLeaderElection makes sure only the leader syncs the sessions
+func (m *SslVpnSessionMonitor) NeedLeaderElection() bool {
+	return true
+}
+
+// Start syncs the sessions of all the vpn gws until the manager stops
+func (m *SslVpnSessionMonitor) Start(ctx context.Context) error {
+	ticker := time.NewTicker(SslVpnSessionSyncInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+		gws := &vpngwv2.VpnGwList{}
+		if err := m.Client.List(ctx, gws); err != nil {
+			m.Log.Error(err, "failed to list vpn gws")
+			continue
+		}
+		for i := range gws.Items {
+			gw := &gws.Items[i]
+			if err := m.sync(ctx, gw); err != nil {
+				m.Log.Error(err, "failed to sync ssl vpn sessions", "vpn gw", client.ObjectKeyFromObject(gw).String())
+			}
+		}
+	}
+}
+
+// listSslVpnSessions returns the connected clients of the vpn gw, none if its ssl vpn server is not running
+func (m *SslVpnSessionMonitor) listSslVpnSessions(ctx context.Context, gw *vpngwv2.VpnGw) ([]sslVpnSession, error) {
+	if !gw.Spec.SslVpn.Enabled || !gw.DeletionTimestamp.IsZero() {
+		return nil, nil
+	}
+	pod := &corev1.Pod{}
+	if err := m.Client.Get(ctx, client.ObjectKey{Name: gw.Name + "-0", Namespace: gw.Namespace}, pod); err != nil {
+		if apierrors.IsNotFound(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	if !isVpnGwPodRunning(pod) {
+		return nil, nil
+	}
+	stdOutput, errOutput, err := ExecuteCommandInContainer(m.KubeClient, m.RestConfig, pod.Namespace, pod.Name, SslVpnServer, SslVpnManagementCMD, "status")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssl vpn sessions, errOutput: %v, err: %v", errOutput, err)
+	}
+	return parseSslVpnSessions(stdOutput), nil
+}
+
+// sync creates or updates the sessions of the connected clients and deletes the others
+func (m *SslVpnSessionMonitor) sync(ctx context.Context, gw *vpngwv2.VpnGw) error {
+	sessions, err := m.listSslVpnSessions(ctx, gw)
+	if err != nil {
+		return err
+	}
+	existing := &vpngwv2.VpnSessionList{}
+	if err := m.Client.List(ctx, existing, client.InNamespace(gw.Namespace), client.MatchingLabels{VpnGwLabel: gw.Name}); err != nil {
+		return err
+	}
+	connected := map[string]bool{}
+	for _, s := range sessions {
+		name := vpnSessionName(gw.Name, s.Proto, s.CN)
+		connected[name] = true
+		if err := m.syncSession(ctx, gw, name, s); err != nil {
+			return err
+		}
+	}
+	for i := range existing.Items {
+		session := &existing.Items[i]
+		if connected[session.Name] || !session.DeletionTimestamp.IsZero() {
+			continue
+		}
+		// the client is gone already, do not disconnect it again
+		if controllerutil.RemoveFinalizer(session, VpnSessionFinalizer) {
+			if err := m.Client.Update(ctx, session); err != nil {
+				return err
+			}
+		}
+		if err := m.Client.Delete(ctx, session); client.IgnoreNotFound(err) != nil {
+			return err
+		}
+		m.Log.Info("ssl vpn session closed", "vpnSession", session.Name, "cn", session.Spec.CN)
+	}
+	return nil
+}
+
+func (m *SslVpnSessionMonitor) syncSession(ctx context.Context, gw *vpngwv2.VpnGw, name string, s sslVpnSession) error {
+	session := &vpngwv2.VpnSession{}
+	err := m.Client.Get(ctx, client.ObjectKey{Name: name, Namespace: gw.Namespace}, session)
+	if err != nil {
+		if !apierrors.IsNotFound(err) {
+			return err
+		}
+		session = &vpngwv2.VpnSession{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:       name,
+				Namespace:  gw.Namespace,
+				Labels:     map[string]string{VpnGwLabel: gw.Name},
+				Finalizers: []string{VpnSessionFinalizer},
+			},
+			Spec: vpngwv2.VpnSessionSpec{
+				VpnGw: gw.Name,
+				CN:    s.CN,
+				Proto: s.Proto,
+			},
+		}
+		if err := controllerutil.SetControllerReference(gw, session, m.Scheme); err != nil {
+			return err
+		}
+		if err := m.Client.Create(ctx, session); err != nil {
+			return err
+		}
+		m.Log.Info("ssl vpn session opened", "vpnSession", name, "cn", s.CN)
+	}
+	// connected since read back from the api server is in local time
+	if !session.DeletionTimestamp.IsZero() || equality.Semantic.DeepEqual(session.Status, s.Status) {
+		return nil
+	}
+	session.Status = s.Status
+	return m.Client.Status().Update(ctx, session)
+}
@@ -0,0 +1,166 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"fmt"
+	"net/url"
+	"strings"
+
+	corev1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// totp key of the client totp secret, base32 encoded
+	SslVpnTotpKey = "totp"
+	// 160 bits key, recommended by rfc 4226
+	TotpKeySize = 20
+
+	// client profile secret, <ssl vpn client>-ssl-vpn-profile
+	SslVpnProfileSecretSuffix = "-ssl-vpn-profile"
+	SslVpnTotpUriKey          = "totp.uri"
+
+	// totp keys of the clients of the vpn gw keyed by the client CN, <vpn gw>-ssl-vpn-totp,
+	// verified by auth-user-pass-verify.sh in the ssl container
+	SslVpnTotpSecretSuffix = "-ssl-vpn-totp"
+	SslVpnTotpSecretPath   = "/etc/ovpn/totp"
+
+	// vpn gw pod env
+	OvpnTotpKey = "OVPN_TOTP"
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// generateTotpKey generates a base32 encoded random totp key
+func generateTotpKey() (string, error) {
+	key := make([]byte, TotpKeySize)
+	if _, err := rand.Read(key); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(key), nil
+}
+
+// parseTotpKey returns the normalized base32 totp key, authenticator apps show the key in lower case or with spaces
+func parseTotpKey(data []byte) (string, error) {
+	key := strings.ToUpper(strings.Join(strings.Fields(string(data)), ""))
+	key = strings.TrimRight(key, "=")
+	decoded, err := totpEncoding.DecodeString(key)
+	if err != nil {
+		return "", fmt.Errorf("totp key is not base32 encoded: %v", err)
+	}
+	if len(decoded) < 10 {
+		return "", fmt.Errorf("totp key should be 80 bits at least")
+	}
+	return key, nil
+}
+
+// totpURI returns the key uri enrolled by the authenticator apps, sha1, 6 digits and 30s period as the apps default
+// reference to: https://github.com/google/google-authenticator/wiki/Key-Uri-Format
+func totpURI(issuer, account, key string) string {
+	values := url.Values{}
+	values.Set("secret", key)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", "6")
+	values.Set("period", "30")
+	u := url.URL{
+		Scheme:   "otpauth",
+		Host:     "totp",
+		Path:     "/" + issuer + ":" + account,
+		RawQuery: values.Encode(),
+	}
+	return u.String()
+}
+
+// getSslVpnClients returns the clients of the vpn gw, a client with a duplicated CN is skipped
+func (r *VpnGwReconciler) getSslVpnClients(ctx context.Context, gw *vpngwv2.VpnGw) ([]vpngwv2.SslVpnClient, error) {
+	clients := &vpngwv2.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(gw.Namespace), client.MatchingLabels{VpnGwLabel: gw.Name}); err != nil {
+		return nil, err
+	}
+	res := []vpngwv2.SslVpnClient{}
+	for i := range clients.Items {
+		c := &clients.Items[i]
+		if c.Spec.VpnGw != gw.Name {
+			continue
+		}
+		if winner := sslVpnClientConflict(c, clients.Items, sameSslVpnClientCN); winner != nil {
+			r.Log.Info("skip ssl vpn client with duplicated cn", "sslVpnClient", c.Name, "cn", sslVpnClientCN(c), "winner", winner.Name)
+			continue
+		}
+		res = append(res, *c)
+	}
+	return res, nil
+}
+
+// reconcileSslVpnTotp collects the totp keys of the clients into the totp secret mounted by the ssl container
+func (r *VpnGwReconciler) reconcileSslVpnTotp(ctx context.Context, gw *vpngwv2.VpnGw) error {
+	clients, err := r.getSslVpnClients(ctx, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients")
+		return err
+	}
+	keys := map[string][]byte{}
+	for i := range clients {
+		c := &clients[i]
+		if c.Spec.Totp == nil {
+			continue
+		}
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: c.Spec.Totp.Secret, Namespace: c.Namespace}, secret); err != nil {
+			// the client controller generates the totp secret, the secret watch requeues the vpn gw
+			r.Log.Error(err, "skip ssl vpn client without totp secret", "sslVpnClient", c.Name)
+			continue
+		}
+		key, err := parseTotpKey(secret.Data[SslVpnTotpKey])
+		if err != nil {
+			r.Log.Error(err, "skip ssl vpn client with invalid totp key", "sslVpnClient", c.Name)
+			continue
+		}
+		keys[sslVpnClientCN(c)] = []byte(key)
+	}
+
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      gw.Name + SslVpnTotpSecretSuffix,
+			Namespace: gw.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = labelsForVpnGw(gw)
+		secret.Data = keys
+		return controllerutil.SetControllerReference(gw, secret, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ssl vpn totp secret")
+		return err
+	}
+	r.Log.Info("ssl vpn totp secret reconciled", "secret", secret.Name, "clients", len(keys), "operation", op)
+	return nil
+}
+
+// map the totp secret to the vpn gws of the clients which reference it
+func (r *VpnGwReconciler) mapTotpSecretToVpnGw(object client.Object) []reconcile.Request {
+	clients := &vpngwv2.SslVpnClientList{}
+	if err := r.List(context.Background(), clients, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients", "namespace", object.GetNamespace())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, c := range clients.Items {
+		if c.Spec.Totp != nil && c.Spec.Totp.Secret == object.GetName() {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: c.Spec.VpnGw, Namespace: c.Namespace},
+			})
+		}
+	}
+	return requests
+}
@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// the server takes the first address, the dynamic and the static halves need a few addresses at least
+	MaxSslVpnSubnetBits = 28
+	// the rate limits of a client are keyed by the lower 16 bits of its address, which are unique in a /16 at most
+	MinSslVpnSubnetBits = 16
+)
+
+// parseSslVpnSubnet parses the ssl vpn subnet cidr of the vpn gw
+func parseSslVpnSubnet(cidr string) (netip.Prefix, error) {
+	prefix, err := netip.ParsePrefix(cidr)
+	if err != nil || !prefix.Addr().Is4() || prefix.Masked() != prefix {
+		return netip.Prefix{}, fmt.Errorf("ssl vpn subnet cidr %q should be an ipv4 cidr", cidr)
+	}
+	if prefix.Bits() > MaxSslVpnSubnetBits {
+		return netip.Prefix{}, fmt.Errorf("ssl vpn subnet cidr %q should be /%d at most", cidr, MaxSslVpnSubnetBits)
+	}
+	if prefix.Bits() < MinSslVpnSubnetBits {
+		return netip.Prefix{}, fmt.Errorf("ssl vpn subnet cidr %q should be /%d at least", cidr, MinSslVpnSubnetBits)
+	}
+	return prefix, nil
+}
+
+func addrToUint32(addr netip.Addr) uint32 {
+	ip := addr.As4()
+	return uint32(ip[0])<<24 | uint32(ip[1])<<16 | uint32(ip[2])<<8 | uint32(ip[3])
+}
+
+// addrAt returns the address at the offset of the ipv4 prefix
+func addrAt(prefix netip.Prefix, offset uint32) netip.Addr {
+	n := addrToUint32(prefix.Addr()) + offset
+	return netip.AddrFrom4([4]byte{byte(n >> 24), byte(n >> 16), byte(n >> 8), byte(n)})
+}
+
+// sslVpnDynamicPool returns the dynamic client pool, the lower half of the subnet without the network and the server address
+func sslVpnDynamicPool(prefix netip.Prefix) (start, end netip.Addr) {
+	half := uint32(1) << (32 - prefix.Bits() - 1)
+	return addrAt(prefix, 2), addrAt(prefix, half-1)
+}
+
+// sslVpnNetmask returns the dotted netmask of the subnet
+func sslVpnNetmask(prefix netip.Prefix) string {
+	return net.IP(net.CIDRMask(prefix.Bits(), 32)).String()
+}
+
+// validateSslVpnClientIp validates the static ip is in the upper half of the subnet and is not the broadcast address
+func validateSslVpnClientIp(cidr, ip string) error {
+	prefix, err := parseSslVpnSubnet(cidr)
+	if err != nil {
+		return err
+	}
+	addr, err := netip.ParseAddr(ip)
+	if err != nil || !addr.Is4() {
+		return fmt.Errorf("ssl vpn client ip %q should be an ipv4 address", ip)
+	}
+	size := uint32(1) << (32 - prefix.Bits())
+	if !prefix.Contains(addr) || addr.Less(addrAt(prefix, size/2)) || addr == addrAt(prefix, size-1) {
+		return fmt.Errorf("ssl vpn client ip %s should be in the upper half of %s except the broadcast address", ip, cidr)
+	}
+	return nil
+}
+
+func sameSslVpnClientIp(a, b *vpngwv2.SslVpnClient) bool {
+	return a.Spec.Ip != "" && a.Spec.Ip == b.Spec.Ip
+}
+
+// addStaticIps pushes the static ips of the clients, the clients with an invalid or a conflicting ip get a dynamic one
+func (c *sslVpnClientConfig) addStaticIps(gw *vpngwv2.VpnGw, clients []vpngwv2.SslVpnClient) {
+	prefix, err := parseSslVpnSubnet(gw.Spec.SslVpn.SubnetCidr)
+	if err != nil {
+		return
+	}
+	for i := range clients {
+		client := &clients[i]
+		if client.Spec.Ip == "" || validateSslVpnClientIp(gw.Spec.SslVpn.SubnetCidr, client.Spec.Ip) != nil ||
+			sslVpnClientConflict(client, clients, sameSslVpnClientIp) != nil {
+			continue
+		}
+		cn := sslVpnClientCN(client)
+		addLine(c.Ccd, cn, fmt.Sprintf("ifconfig-push %s %s", client.Spec.Ip, sslVpnNetmask(prefix)))
+		if gw.Spec.SslVpn.TcpFallback == nil {
+			continue
+		}
+		// the same offset of the tcp fallback subnet
+		ip, err := sslVpnTcpFallbackIp(gw, client.Spec.Ip)
+		if err != nil {
+			continue
+		}
+		addLine(c.TcpCcd, cn, fmt.Sprintf("ifconfig-push %s %s", ip, sslVpnNetmask(prefix)))
+	}
+}
@@ -0,0 +1,379 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	SslVpnClientReady = "Ready"
+)
+
+// SslVpnClientReconciler reconciles a SslVpnClient object
+type SslVpnClientReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+// sslVpnClientCN returns the common name of the client certificate
+func sslVpnClientCN(c *vpngwv2.SslVpnClient) string {
+	if c.Spec.CN != "" {
+		return c.Spec.CN
+	}
+	return c.Name
+}
+
+func sameSslVpnClientCN(a, b *vpngwv2.SslVpnClient) bool {
+	return sslVpnClientCN(a) == sslVpnClientCN(b)
+}
+
+// sslVpnClientConflict returns the client of the same vpn gw which conflicts with the client and wins,
+// the earlier created client wins, nil if the client wins
+func sslVpnClientConflict(c *vpngwv2.SslVpnClient, clients []vpngwv2.SslVpnClient, conflict func(a, b *vpngwv2.SslVpnClient) bool) *vpngwv2.SslVpnClient {
+	for i := range clients {
+		other := &clients[i]
+		if other.Name == c.Name || other.Spec.VpnGw != c.Spec.VpnGw || !other.DeletionTimestamp.IsZero() || !conflict(c, other) {
+			continue
+		}
+		if other.CreationTimestamp.Before(&c.CreationTimestamp) ||
+			(other.CreationTimestamp.Equal(&c.CreationTimestamp) && other.Name < c.Name) {
+			return other
+		}
+	}
+	return nil
+}
+
+func (r *SslVpnClientReconciler) validateSslVpnClient(c *vpngwv2.SslVpnClient) error {
+	if c.Spec.VpnGw == "" {
+		err := fmt.Errorf("ssl vpn client vpn gw is required")
+		r.Log.Error(err, "should set vpn gw")
+		return err
+	}
+	if !sslVpnCNRegexp.MatchString(sslVpnClientCN(c)) {
+		err := fmt.Errorf("ssl vpn client cn %q is invalid", sslVpnClientCN(c))
+		r.Log.Error(err, "should set cn of letters, digits, '-', '_' and '.' not starting with '.'")
+		return err
+	}
+	if c.Spec.Totp != nil && c.Spec.Totp.Secret == "" {
+		err := fmt.Errorf("ssl vpn client totp secret is required")
+		r.Log.Error(err, "should set totp secret, the totp key is generated into it if it does not exist")
+		return err
+	}
+	return nil
+}
+
+// reconcileTotpKey returns the totp key of the client, generates it if the totp secret does not exist
+func (r *SslVpnClientReconciler) reconcileTotpKey(ctx context.Context, c *vpngwv2.SslVpnClient) (string, error) {
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: c.Spec.Totp.Secret, Namespace: c.Namespace}, secret)
+	if err == nil {
+		return parseTotpKey(secret.Data[SslVpnTotpKey])
+	}
+	if !apierrors.IsNotFound(err) {
+		return "", err
+	}
+	key, err := generateTotpKey()
+	if err != nil {
+		return "", err
+	}
+	secret = &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.Spec.Totp.Secret,
+			Namespace: c.Namespace,
+		},
+		Data: map[string][]byte{SslVpnTotpKey: []byte(key)},
+	}
+	// the generated totp key is deleted along with the client
+	if err := controllerutil.SetControllerReference(c, secret, r.Scheme); err != nil {
+		return "", err
+	}
+	if err := r.Create(ctx, secret); err != nil {
+		return "", err
+	}
+	r.Log.Info("totp key generated", "sslVpnClient", c.Name, "secret", secret.Name)
+	return key, nil
+}
+
+func (r *SslVpnClientReconciler) handleAddOrUpdateSslVpnClient(ctx context.Context, c *vpngwv2.SslVpnClient) (SyncState, error) {
+	namespacedName := fmt.Sprintf("%s/%s", c.Namespace, c.Name)
+	r.Log.Info("start handleAddOrUpdateSslVpnClient", "sslVpnClient", namespacedName)
+	defer r.Log.Info("end handleAddOrUpdateSslVpnClient", "sslVpnClient", namespacedName)
+
+	if err := r.validateSslVpnClient(c); err != nil {
+		r.Log.Error(err, "failed to validate ssl vpn client")
+		// invalid spec no retry
+		return SyncStateErrorNoRetry, err
+	}
+	gw := &vpngwv2.VpnGw{}
+	err := r.Get(ctx, types.NamespacedName{Name: c.Spec.VpnGw, Namespace: c.Namespace}, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get the vpn gw of ssl vpn client")
+		return SyncStateError, err
+	}
+	if !gw.Spec.SslVpn.Enabled {
+		err := fmt.Errorf("vpn gw %s does not enable ssl vpn", gw.Name)
+		r.Log.Error(err, "should enable ssl vpn of the vpn gw")
+		return SyncStateErrorNoRetry, err
+	}
+	clients := &vpngwv2.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(c.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients")
+		return SyncStateError, err
+	}
+	if winner := sslVpnClientConflict(c, clients.Items, sameSslVpnClientCN); winner != nil {
+		err := fmt.Errorf("cn %s is used by ssl vpn client %s", sslVpnClientCN(c), winner.Name)
+		r.Log.Error(err, "should set unique cn of the vpn gw clients")
+		return SyncStateErrorNoRetry, err
+	}
+	if c.Spec.Ip != "" {
+		if err := validateSslVpnClientIp(gw.Spec.SslVpn.SubnetCidr, c.Spec.Ip); err != nil {
+			r.Log.Error(err, "should set static ip in the upper half of the vpn gw ssl vpn subnet cidr")
+			return SyncStateErrorNoRetry, err
+		}
+		if winner := sslVpnClientConflict(c, clients.Items, sameSslVpnClientIp); winner != nil {
+			err := fmt.Errorf("ip %s is used by ssl vpn client %s", c.Spec.Ip, winner.Name)
+			r.Log.Error(err, "should set unique ip of the vpn gw clients")
+			return SyncStateErrorNoRetry, err
+		}
+	}
+
+	// patch label so that vpn gw can find its clients
+	newClient := c.DeepCopy()
+	if newClient.Labels == nil {
+		newClient.Labels = map[string]string{}
+	}
+	newClient.Labels[VpnGwLabel] = gw.Name
+	// the client and its totp key are written by the user, they should survive the vpn gw being deleted or recreated,
+	// vpn gw watches the clients by spec vpn gw instead
+	dropVpnGwOwnerReferences(newClient)
+	if !reflect.DeepEqual(newClient.ObjectMeta, c.ObjectMeta) {
+		if err = r.Patch(ctx, newClient, client.MergeFrom(c)); err != nil {
+			r.Log.Error(err, "failed to patch the ssl vpn client")
+			return SyncStateError, err
+		}
+	}
+
+	profile := map[string][]byte{}
+	if c.Spec.Totp != nil {
+		key, err := r.reconcileTotpKey(ctx, c)
+		if err != nil {
+			r.Log.Error(err, "failed to get totp key of ssl vpn client")
+			return SyncStateError, err
+		}
+		issuer := c.Spec.Totp.Issuer
+		if issuer == "" {
+			issuer = gw.Name
+		}
+		profile[SslVpnTotpUriKey] = []byte(totpURI(issuer, sslVpnClientCN(c), key))
+	}
+	secret := &corev1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      c.Name + SslVpnProfileSecretSuffix,
+			Namespace: c.Namespace,
+		},
+	}
+	op, err := controllerutil.CreateOrUpdate(ctx, r.Client, secret, func() error {
+		secret.Labels = map[string]string{VpnGwLabel: gw.Name}
+		secret.Data = profile
+		return controllerutil.SetControllerReference(newClient, secret, r.Scheme)
+	})
+	if err != nil {
+		r.Log.Error(err, "failed to create or update ssl vpn client profile secret")
+		return SyncStateError, err
+	}
+	r.Log.Info("ssl vpn client profile secret reconciled", "secret", secret.Name, "operation", op)
+
+	newClient.Status.CN = sslVpnClientCN(c)
+	newClient.Status.Groups = c.Spec.Groups
+	newClient.Status.Ip = c.Spec.Ip
+	newClient.Status.ProfileSecret = secret.Name
+	meta.SetStatusCondition(&newClient.Status.Conditions, metav1.Condition{
+		Type:               SslVpnClientReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            fmt.Sprintf("client profile is generated into secret %s", secret.Name),
+		ObservedGeneration: c.Generation,
+	})
+	if !reflect.DeepEqual(c.Status, newClient.Status) {
+		if err := r.Status().Update(ctx, newClient); err != nil {
+			r.Log.Error(err, "failed to update ssl vpn client status")
+			return SyncStateError, err
+		}
+	}
+	return SyncStateSuccess, nil
+}
+
+// setNotReady reports the client could not be reconciled
+func (r *SslVpnClientReconciler) setNotReady(ctx context.Context, c *vpngwv2.SslVpnClient, err error) {
+	newClient := c.DeepCopy()
+	meta.SetStatusCondition(&newClient.Status.Conditions, metav1.Condition{
+		Type:               SslVpnClientReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Invalid",
+		Message:            err.Error(),
+		ObservedGeneration: c.Generation,
+	})
+	if reflect.DeepEqual(c.Status, newClient.Status) {
+		return
+	}
+	if err := r.Status().Update(ctx, newClient); err != nil {
+		r.Log.Error(err, "failed to update ssl vpn client status")
+	}
+}
+
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=sslvpnclients,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=sslvpnclients/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=sslvpnclients/finalizers,verbs=update
+
+// Reconcile generates the totp key and the profile of the ssl vpn client
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
+func (r *SslVpnClientReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start reconcile", "sslVpnClient", namespacedName)
+	defer r.Log.Info("end reconcile", "sslVpnClient", namespacedName)
+	updates.Inc()
+
+	c := &vpngwv2.SslVpnClient{}
+	err := r.Get(ctx, req.NamespacedName, c)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// the profile and the generated totp key are deleted by the garbage collector,
+			// the vpn gw watches the ssl vpn clients by spec.vpnGw, the deletion updates its ssl vpn clients
+			return ctrl.Result{}, nil
+		}
+		r.Log.Error(err, "failed to get ssl vpn client")
+		return ctrl.Result{}, err
+	}
+	if !c.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	res, err := r.handleAddOrUpdateSslVpnClient(ctx, c)
+	switch res {
+	case SyncStateError:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle ssl vpn client")
+		return ctrl.Result{}, errRetry
+	case SyncStateErrorNoRetry:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle ssl vpn client")
+		r.setNotReady(ctx, c, err)
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *SslVpnClientReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vpngwv2.SslVpnClient{},
+			builder.WithPredicates(
+				predicate.NewPredicateFuncs(
+					func(object client.Object) bool {
+						_, ok := object.(*vpngwv2.SslVpnClient)
+						if !ok {
+							err := errors.New("invalid ssl vpn client")
+							r.Log.Error(err, "expected ssl vpn client in worequeue but got something else")
+							return false
+						}
+						return true
+					},
+				),
+			),
+		).
+		Owns(&corev1.Secret{}).
+		// refresh the totp enrollment uri once the totp key changes
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapTotpSecretToSslVpnClient),
+		).
+		Watches(&source.Kind{Type: &vpngwv2.VpnGw{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapVpnGwToSslVpnClient),
+		).
+		// the conflicting clients are reconciled again once the winner changes
+		Watches(&source.Kind{Type: &vpngwv2.SslVpnClient{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSslVpnClientToConflicts),
+		).
+		Complete(r)
+}
+
+func (r *SslVpnClientReconciler) listSslVpnClients(namespace string, match func(c *vpngwv2.SslVpnClient) bool) []reconcile.Request {
+	clients := &vpngwv2.SslVpnClientList{}
+	if err := r.List(context.Background(), clients, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients", "namespace", namespace)
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for i := range clients.Items {
+		c := &clients.Items[i]
+		if match(c) {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: c.Name, Namespace: c.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// map totp secret to the clients which reference it
+func (r *SslVpnClientReconciler) mapTotpSecretToSslVpnClient(object client.Object) []reconcile.Request {
+	return r.listSslVpnClients(object.GetNamespace(), func(c *vpngwv2.SslVpnClient) bool {
+		return c.Spec.Totp != nil && c.Spec.Totp.Secret == object.GetName()
+	})
+}
+
+// map vpn gw to its clients
+func (r *SslVpnClientReconciler) mapVpnGwToSslVpnClient(object client.Object) []reconcile.Request {
+	return r.listSslVpnClients(object.GetNamespace(), func(c *vpngwv2.SslVpnClient) bool {
+		return c.Spec.VpnGw == object.GetName()
+	})
+}
+
+// map ssl vpn client to the other clients of the same vpn gw
+func (r *SslVpnClientReconciler) mapSslVpnClientToConflicts(object client.Object) []reconcile.Request {
+	changed, ok := object.(*vpngwv2.SslVpnClient)
+	if !ok {
+		return nil
+	}
+	return r.listSslVpnClients(object.GetNamespace(), func(c *vpngwv2.SslVpnClient) bool {
+		return c.Name != changed.Name && c.Spec.VpnGw == changed.Spec.VpnGw
+	})
+}
@@ -1,6 +1,9 @@
 package controller
 
-import "github.com/prometheus/client_golang/prometheus"
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"sigs.k8s.io/controller-runtime/pkg/metrics"
+)
 
 var (
 	updates = prometheus.NewCounter(prometheus.CounterOpts{
@@ -30,6 +33,13 @@ var (
 		Name:      "config_stale_bool",
 		Help:      "1 if running on a stale configuration, because the latest config failed to load.",
 	})
+
+	// served by the manager metrics endpoint
+	certExpiry = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Subsystem: "kube_combo",
+		Name:      "cert_expiry_timestamp_seconds",
+		Help:      "Expiry time of the certificates used by the vpn gw in unix seconds.",
+	}, []string{"namespace", "vpn_gw", "secret", "key", "cn"})
 )
 
 func init() {
@@ -37,4 +47,5 @@ func init() {
 	prometheus.MustRegister(updateErrors)
 	prometheus.MustRegister(configLoaded)
 	prometheus.MustRegister(configStale)
+	metrics.Registry.MustRegister(certExpiry)
 }
@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"time"
+
+	"github.com/go-logr/logr"
+	apiextensionsv1 "k8s.io/apiextensions-apiserver/pkg/apis/apiextensions/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	VpnGwCRDName     = "vpngws.vpn-gw.kube-combo.com"
+	IpsecConnCRDName = "ipsecconns.vpn-gw.kube-combo.com"
+
+	storageMigrationRetryInterval = 10 * time.Second
+)
+
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions,verbs=get
+// +kubebuilder:rbac:groups=apiextensions.k8s.io,resources=customresourcedefinitions/status,verbs=get;update;patch
+
+// StorageVersionMigrator rewrites all vpn gw and ipsec connection objects in the storage version,
+// and then drops the old versions from the crd status, so that v1 could be removed in the future
+type StorageVersionMigrator struct {
+	Client client.Client
+	// uncached reader, crd is not watched by the manager
+	Reader client.Reader
+	Log    logr.Logger
+}
+
+type storageMigrationTarget struct {
+	crd  string
+	list client.ObjectList
+}
+
+// NeedLeaderElection makes sure only the leader migrates the objects
+func (m *StorageVersionMigrator) NeedLeaderElection() bool {
+	return true
+}
+
+// Start migrates every crd until it succeeds or the manager stops
+func (m *StorageVersionMigrator) Start(ctx context.Context) error {
+	targets := []storageMigrationTarget{
+		{crd: VpnGwCRDName, list: &vpngwv2.VpnGwList{}},
+		{crd: IpsecConnCRDName, list: &vpngwv2.IpsecConnList{}},
+	}
+	for _, target := range targets {
+		for {
+			err := m.migrate(ctx, target)
+			if err == nil {
+				break
+			}
+			m.Log.Error(err, "failed to migrate storage version, retry later", "crd", target.crd)
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(storageMigrationRetryInterval):
+			}
+		}
+	}
+	return nil
+}
+
+func (m *StorageVersionMigrator) migrate(ctx context.Context, target storageMigrationTarget) error {
+	m.Log.Info("start migrate storage version", "crd", target.crd)
+	defer m.Log.Info("end migrate storage version", "crd", target.crd)
+
+	crd := &apiextensionsv1.CustomResourceDefinition{}
+	if err := m.Reader.Get(ctx, types.NamespacedName{Name: target.crd}, crd); err != nil {
+		return fmt.Errorf("failed to get crd %s: %v", target.crd, err)
+	}
+	storageVersion := ""
+	for _, version := range crd.Spec.Versions {
+		if version.Storage {
+			storageVersion = version.Name
+			break
+		}
+	}
+	if storageVersion == "" {
+		return fmt.Errorf("crd %s has no storage version", target.crd)
+	}
+	storedVersions := []string{storageVersion}
+	if reflect.DeepEqual(crd.Status.StoredVersions, storedVersions) {
+		m.Log.Info("no need to migrate storage version", "crd", target.crd, "version", storageVersion)
+		return nil
+	}
+
+	// a no-op update makes the apiserver write the object in the storage version
+	if err := m.Reader.List(ctx, target.list); err != nil {
+		return fmt.Errorf("failed to list %s: %v", target.crd, err)
+	}
+	items, err := meta.ExtractList(target.list)
+	if err != nil {
+		return err
+	}
+	for _, item := range items {
+		obj, ok := item.(client.Object)
+		if !ok {
+			continue
+		}
+		if err := m.Client.Update(ctx, obj); err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to migrate %s/%s: %v", obj.GetNamespace(), obj.GetName(), err)
+		}
+	}
+
+	crd.Status.StoredVersions = storedVersions
+	if err := m.Client.Status().Update(ctx, crd); err != nil {
+		return fmt.Errorf("failed to update stored versions of crd %s: %v", target.crd, err)
+	}
+	m.Log.Info("storage version migrated", "crd", target.crd, "version", storageVersion, "count", len(items))
+	return nil
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/go-logr/logr"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	VpnAccessPolicyReady = "Ready"
+)
+
+// VpnAccessPolicyReconciler reconciles a VpnAccessPolicy object
+type VpnAccessPolicyReconciler struct {
+	client.Client
+	Log    logr.Logger
+	Scheme *runtime.Scheme
+}
+
+func (r *VpnAccessPolicyReconciler) validateVpnAccessPolicy(policy *vpngwv2.VpnAccessPolicy) error {
+	if policy.Spec.VpnGw == "" {
+		err := fmt.Errorf("vpn access policy vpn gw is required")
+		r.Log.Error(err, "should set vpn gw")
+		return err
+	}
+	if len(policy.Spec.CNs) == 0 && len(policy.Spec.Groups) == 0 {
+		err := fmt.Errorf("vpn access policy cns or groups are required")
+		r.Log.Error(err, "should set the clients which the policy applies to")
+		return err
+	}
+	if len(policy.Spec.Rules) == 0 {
+		err := fmt.Errorf("vpn access policy rules are required")
+		r.Log.Error(err, "should set the destinations the clients are allowed to reach")
+		return err
+	}
+	if err := validateVpnAccessPolicyRules(policy); err != nil {
+		r.Log.Error(err, "should set valid cns and access rules")
+		return err
+	}
+	return nil
+}
+
+func (r *VpnAccessPolicyReconciler) handleAddOrUpdateVpnAccessPolicy(ctx context.Context, policy *vpngwv2.VpnAccessPolicy) (SyncState, error) {
+	namespacedName := fmt.Sprintf("%s/%s", policy.Namespace, policy.Name)
+	r.Log.Info("start handleAddOrUpdateVpnAccessPolicy", "vpnAccessPolicy", namespacedName)
+	defer r.Log.Info("end handleAddOrUpdateVpnAccessPolicy", "vpnAccessPolicy", namespacedName)
+
+	if err := r.validateVpnAccessPolicy(policy); err != nil {
+		r.Log.Error(err, "failed to validate vpn access policy")
+		// invalid spec no retry
+		return SyncStateErrorNoRetry, err
+	}
+	gw := &vpngwv2.VpnGw{}
+	err := r.Get(ctx, types.NamespacedName{Name: policy.Spec.VpnGw, Namespace: policy.Namespace}, gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get the vpn gw of vpn access policy")
+		return SyncStateError, err
+	}
+	if !gw.Spec.SslVpn.Enabled {
+		err := fmt.Errorf("vpn gw %s does not enable ssl vpn", gw.Name)
+		r.Log.Error(err, "should enable ssl vpn of the vpn gw")
+		return SyncStateErrorNoRetry, err
+	}
+
+	// patch label so that vpn gw can find its policies
+	newPolicy := policy.DeepCopy()
+	if newPolicy.Labels == nil {
+		newPolicy.Labels = map[string]string{}
+	}
+	newPolicy.Labels[VpnGwLabel] = gw.Name
+	// the policy is written by the user, it should survive the vpn gw being deleted or recreated,
+	// vpn gw watches the policies by spec vpn gw instead
+	dropVpnGwOwnerReferences(newPolicy)
+	if !reflect.DeepEqual(newPolicy.ObjectMeta, policy.ObjectMeta) {
+		if err = r.Patch(ctx, newPolicy, client.MergeFrom(policy)); err != nil {
+			r.Log.Error(err, "failed to patch the vpn access policy")
+			return SyncStateError, err
+		}
+	}
+
+	clients := &vpngwv2.SslVpnClientList{}
+	if err := r.List(ctx, clients, client.InNamespace(policy.Namespace)); err != nil {
+		r.Log.Error(err, "failed to list ssl vpn clients")
+		return SyncStateError, err
+	}
+	newPolicy.Status.CNs = vpnAccessPolicyCNs(policy, clients.Items)
+	meta.SetStatusCondition(&newPolicy.Status.Conditions, metav1.Condition{
+		Type:               VpnAccessPolicyReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            fmt.Sprintf("policy applies to %d clients", len(newPolicy.Status.CNs)),
+		ObservedGeneration: policy.Generation,
+	})
+	if !reflect.DeepEqual(policy.Status, newPolicy.Status) {
+		if err := r.Status().Update(ctx, newPolicy); err != nil {
+			r.Log.Error(err, "failed to update vpn access policy status")
+			return SyncStateError, err
+		}
+	}
+	return SyncStateSuccess, nil
+}
+
+// setNotReady reports the policy could not be reconciled
+func (r *VpnAccessPolicyReconciler) setNotReady(ctx context.Context, policy *vpngwv2.VpnAccessPolicy, err error) {
+	newPolicy := policy.DeepCopy()
+	meta.SetStatusCondition(&newPolicy.Status.Conditions, metav1.Condition{
+		Type:               VpnAccessPolicyReady,
+		Status:             metav1.ConditionFalse,
+		Reason:             "Invalid",
+		Message:            err.Error(),
+		ObservedGeneration: policy.Generation,
+	})
+	if reflect.DeepEqual(policy.Status, newPolicy.Status) {
+		return
+	}
+	if err := r.Status().Update(ctx, newPolicy); err != nil {
+		r.Log.Error(err, "failed to update vpn access policy status")
+	}
+}
+
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=vpnaccesspolicies,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=vpnaccesspolicies/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=vpnaccesspolicies/finalizers,verbs=update
+
+// Reconcile binds the vpn access policy to its vpn gw and resolves the clients it applies to
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
+func (r *VpnAccessPolicyReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start reconcile", "vpnAccessPolicy", namespacedName)
+	defer r.Log.Info("end reconcile", "vpnAccessPolicy", namespacedName)
+	updates.Inc()
+
+	policy := &vpngwv2.VpnAccessPolicy{}
+	err := r.Get(ctx, req.NamespacedName, policy)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			// the vpn gw watches the access policies by spec.vpnGw, the deletion updates its access rules
+			return ctrl.Result{}, nil
+		}
+		r.Log.Error(err, "failed to get vpn access policy")
+		return ctrl.Result{}, err
+	}
+	if !policy.DeletionTimestamp.IsZero() {
+		return ctrl.Result{}, nil
+	}
+
+	res, err := r.handleAddOrUpdateVpnAccessPolicy(ctx, policy)
+	switch res {
+	case SyncStateError:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle vpn access policy")
+		return ctrl.Result{}, errRetry
+	case SyncStateErrorNoRetry:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle vpn access policy")
+		r.setNotReady(ctx, policy, err)
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VpnAccessPolicyReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vpngwv2.VpnAccessPolicy{},
+			builder.WithPredicates(
+				predicate.NewPredicateFuncs(
+					func(object client.Object) bool {
+						_, ok := object.(*vpngwv2.VpnAccessPolicy)
+						if !ok {
+							err := errors.New("invalid vpn access policy")
+							r.Log.Error(err, "expected vpn access policy in worequeue but got something else")
+							return false
+						}
+						return true
+					},
+				),
+			),
+		).
+		Watches(&source.Kind{Type: &vpngwv2.VpnGw{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapVpnGwToVpnAccessPolicy),
+		).
+		// the clients of the policy groups change along with the clients
+		Watches(&source.Kind{Type: &vpngwv2.SslVpnClient{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSslVpnClientToVpnAccessPolicy),
+		).
+		Complete(r)
+}
+
+func (r *VpnAccessPolicyReconciler) listVpnAccessPolicies(namespace, gw string) []reconcile.Request {
+	policies := &vpngwv2.VpnAccessPolicyList{}
+	if err := r.List(context.Background(), policies, client.InNamespace(namespace)); err != nil {
+		r.Log.Error(err, "failed to list vpn access policies", "namespace", namespace)
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, policy := range policies.Items {
+		if policy.Spec.VpnGw == gw {
+			requests = append(requests, reconcile.Request{
+				NamespacedName: types.NamespacedName{Name: policy.Name, Namespace: policy.Namespace},
+			})
+		}
+	}
+	return requests
+}
+
+// map vpn gw to its policies
+func (r *VpnAccessPolicyReconciler) mapVpnGwToVpnAccessPolicy(object client.Object) []reconcile.Request {
+	return r.listVpnAccessPolicies(object.GetNamespace(), object.GetName())
+}
+
+// map ssl vpn client to the policies of its vpn gw
+func (r *VpnAccessPolicyReconciler) mapSslVpnClientToVpnAccessPolicy(object client.Object) []reconcile.Request {
+	c, ok := object.(*vpngwv2.SslVpnClient)
+	if !ok {
+		return nil
+	}
+	return r.listVpnAccessPolicies(c.Namespace, c.Spec.VpnGw)
+}
@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// DefaultCertExpiryThreshold is how long before expiry a certificate is reported as expiring soon
+	DefaultCertExpiryThreshold = 30 * 24 * time.Hour
+
+	// certificates expire without any event, so the vpn gw is checked periodically
+	CertExpiryCheckInterval = time.Hour
+
+	// the ssl vpn client certificates are issued by newClientCert.sh into the pki of the ssl container,
+	// reported as the certificates of this source in the metrics
+	SslVpnClientCertsSource = "ssl-vpn-pki"
+	SslVpnClientCertsCMD    = "find /etc/openvpn/certs/pki/issued -name '*.crt' ! -name server.crt -exec cat {} +"
+)
+
+// monitoredCert is a certificate used by the vpn gw
+type monitoredCert struct {
+	Secret   string
+	Key      string
+	CN       string
+	NotAfter time.Time
+}
+
+// parseCertificates returns all the certificates of a pem bundle, the other blocks are skipped
+func parseCertificates(data []byte) []*x509.Certificate {
+	certs := []*x509.Certificate{}
+	for {
+		var block *pem.Block
+		block, data = pem.Decode(data)
+		if block == nil {
+			return certs
+		}
+		if block.Type != "CERTIFICATE" {
+			continue
+		}
+		if cert, err := x509.ParseCertificate(block.Bytes); err == nil {
+			certs = append(certs, cert)
+		}
+	}
+}
+
+func monitoredCerts(source, key string, data []byte) []monitoredCert {
+	certs := []monitoredCert{}
+	for _, cert := range parseCertificates(data) {
+		certs = append(certs, monitoredCert{
+			Secret:   source,
+			Key:      key,
+			CN:       cert.Subject.CommonName,
+			NotAfter: cert.NotAfter,
+		})
+	}
+	return certs
+}
+
+// getSslVpnClientCerts returns the client certificates issued by the ssl vpn server
+func (r *VpnGwReconciler) getSslVpnClientCerts(pod *corev1.Pod) ([]monitoredCert, error) {
+	stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, SslVpnServer, "/bin/bash", "-c", SslVpnClientCertsCMD)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list ssl vpn client certificates, errOutput: %v, err: %v", errOutput, err)
+	}
+	certs := []monitoredCert{}
+	for _, cert := range parseCertificates([]byte(stdOutput)) {
+		certs = append(certs, monitoredCert{
+			Secret:   SslVpnClientCertsSource,
+			Key:      "issued/" + cert.Subject.CommonName + ".crt",
+			CN:       cert.Subject.CommonName,
+			NotAfter: cert.NotAfter,
+		})
+	}
+	return certs, nil
+}
+
+// getMonitoredCerts returns the certificates of the ssl and ipsec vpn secrets, the ssl vpn clients and the remote cas of the ipsec connections,
+// and the sources which could not be checked, eg: the missing secrets, so that one of them does not block the others
+func (r *VpnGwReconciler) getMonitoredCerts(ctx context.Context, gw *vpngwv2.VpnGw, pod *corev1.Pod) ([]monitoredCert, []string, error) {
+	certs := []monitoredCert{}
+	unchecked := []string{}
+	secrets := []string{}
+	if gw.Spec.SslVpn.Enabled {
+		secrets = append(secrets, gw.Spec.SslVpn.SslSecret)
+	}
+	if gw.Spec.IpsecVpn.Enabled {
+		secrets = append(secrets, gw.Spec.IpsecVpn.IpsecSecret)
+	}
+	for _, name := range secrets {
+		secret := &corev1.Secret{}
+		if err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: gw.Namespace}, secret); err != nil {
+			if apierrors.IsNotFound(err) {
+				unchecked = append(unchecked, fmt.Sprintf("secret %s is not found", name))
+				continue
+			}
+			return nil, nil, fmt.Errorf("failed to get secret %s: %v", name, err)
+		}
+		for _, key := range []string{IpsecCertKey, IpsecCaKey} {
+			certs = append(certs, monitoredCerts(name, key, secret.Data[key])...)
+		}
+	}
+	if gw.Spec.SslVpn.Enabled && pod != nil {
+		clientCerts, err := r.getSslVpnClientCerts(pod)
+		if err != nil {
+			r.Log.Error(err, "skip ssl vpn client certificates expiry check")
+			unchecked = append(unchecked, "ssl vpn client certificates could not be listed")
+		}
+		certs = append(certs, clientCerts...)
+	}
+	if !gw.Spec.IpsecVpn.Enabled {
+		return certs, unchecked, nil
+	}
+
+	conns, err := r.getIpsecConnections(ctx, gw)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to list ipsec connections: %v", err)
+	}
+	for i := range conns {
+		conn := &conns[i]
+		if conn.Spec.RemoteCa == nil {
+			continue
+		}
+		data, err := r.getIpsecRemoteCa(ctx, conn)
+		if err != nil {
+			// the connection is not rendered without its remote ca
+			r.Log.Error(err, "skip remote ca expiry check", "ipsecConn", conn.Name)
+			unchecked = append(unchecked, fmt.Sprintf("remote ca %s of ipsec connection %s could not be read", conn.Spec.RemoteCa.Name, conn.Name))
+			continue
+		}
+		key := conn.Spec.RemoteCa.Key
+		if key == "" {
+			key = IpsecCaKey
+		}
+		certs = append(certs, monitoredCerts(conn.Spec.RemoteCa.Name, key, data)...)
+	}
+	return certs, unchecked, nil
+}
+
+// certExpiryChecks records the last certificate expiry check of each vpn gw,
+// so that the reconciles triggered by pod, client or status changes do not check again within the interval
+type certExpiryChecks struct {
+	mu     sync.Mutex
+	checks map[types.NamespacedName]certExpiryCheck
+}
+
+type certExpiryCheck struct {
+	// the vpn gw generation, the pod and the loaded certificates checked
+	key  string
+	time time.Time
+}
+
+func newCertExpiryChecks() *certExpiryChecks {
+	return &certExpiryChecks{checks: map[types.NamespacedName]certExpiryCheck{}}
+}
+
+// due returns whether the vpn gw should be checked, the check is due once the interval passes,
+// or the spec, the pod or the loaded certificates change
+func (c *certExpiryChecks) due(name types.NamespacedName, key string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	check, ok := c.checks[name]
+	return !ok || check.key != key || time.Since(check.time) >= CertExpiryCheckInterval
+}
+
+func (c *certExpiryChecks) done(name types.NamespacedName, key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks[name] = certExpiryCheck{key: key, time: time.Now()}
+}
+
+func (c *certExpiryChecks) forget(name types.NamespacedName) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.checks, name)
+}
+
+// checkCertificateExpiryIfDue checks the certificate expiry at most once per CertExpiryCheckInterval,
+// returns the CertificateExpiringSoon condition of the last check otherwise
+func (r *VpnGwReconciler) checkCertificateExpiryIfDue(ctx context.Context, gw *vpngwv2.VpnGw, pod *corev1.Pod, sslCert, ipsecCert *vpngwv2.CertificateStatus) (*metav1.Condition, error) {
+	name := types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace}
+	key := fmt.Sprintf("%d/%s", gw.Generation, pod.UID)
+	for _, cert := range []*vpngwv2.CertificateStatus{sslCert, ipsecCert} {
+		if cert != nil {
+			key += "/" + cert.Hash
+		}
+	}
+	if last := meta.FindStatusCondition(gw.Status.Conditions, vpngwv2.VpnGwCertificateExpiringSoon); last != nil && !r.certChecks.due(name, key) {
+		condition := *last
+		return &condition, nil
+	}
+	condition, err := r.checkCertificateExpiry(ctx, gw, pod)
+	if err != nil {
+		return nil, err
+	}
+	r.certChecks.done(name, key)
+	return condition, nil
+}
+
+// checkCertificateExpiry exports the expiry of the certificates used by the vpn gw,
+// returns the CertificateExpiringSoon condition
+func (r *VpnGwReconciler) checkCertificateExpiry(ctx context.Context, gw *vpngwv2.VpnGw, pod *corev1.Pod) (*metav1.Condition, error) {
+	certs, unchecked, err := r.getMonitoredCerts(ctx, gw, pod)
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(unchecked)
+	// drop the series of the replaced certificates
+	certExpiry.DeletePartialMatch(prometheus.Labels{"namespace": gw.Namespace, "vpn_gw": gw.Name})
+
+	threshold := r.CertExpiryThreshold
+	if threshold == 0 {
+		threshold = DefaultCertExpiryThreshold
+	}
+	expiring := []string{}
+	for _, cert := range certs {
+		certExpiry.WithLabelValues(gw.Namespace, gw.Name, cert.Secret, cert.Key, cert.CN).Set(float64(cert.NotAfter.Unix()))
+		if time.Until(cert.NotAfter) < threshold {
+			expiring = append(expiring, fmt.Sprintf("%s/%s (cn %s) expires at %s", cert.Secret, cert.Key, cert.CN, cert.NotAfter.UTC().Format(time.RFC3339)))
+		}
+	}
+	sort.Strings(expiring)
+
+	condition := &metav1.Condition{
+		Type:               vpngwv2.VpnGwCertificateExpiringSoon,
+		Status:             metav1.ConditionFalse,
+		Reason:             "NotExpiring",
+		Message:            fmt.Sprintf("no certificate expires within %s", threshold),
+		ObservedGeneration: gw.Generation,
+	}
+	if len(expiring) != 0 {
+		condition.Status = metav1.ConditionTrue
+		condition.Reason = "ExpiringSoon"
+		condition.Message = strings.Join(expiring, "; ")
+		// warn once the certificates start expiring
+		if !meta.IsStatusConditionTrue(gw.Status.Conditions, vpngwv2.VpnGwCertificateExpiringSoon) && r.Recorder != nil {
+			r.Recorder.Event(gw, corev1.EventTypeWarning, vpngwv2.VpnGwCertificateExpiringSoon, condition.Message)
+		}
+	}
+	if len(unchecked) != 0 {
+		if condition.Status == metav1.ConditionFalse {
+			condition.Reason = "Unchecked"
+		}
+		condition.Message += "; unchecked: " + strings.Join(unchecked, "; ")
+	}
+	return condition, nil
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/apimachinery/pkg/types"
+)
+
+func TestCertExpiryChecksDue(t *testing.T) {
+	checks := newCertExpiryChecks()
+	name := types.NamespacedName{Name: "gw", Namespace: "default"}
+	if !checks.due(name, "1/pod/hash") {
+		t.Errorf("expected the first check due")
+	}
+	checks.done(name, "1/pod/hash")
+	if checks.due(name, "1/pod/hash") {
+		t.Errorf("expected no check due within the interval")
+	}
+	if !checks.due(name, "1/pod/renewed") {
+		t.Errorf("expected a check due once the certificate changes")
+	}
+	checks.checks[name] = certExpiryCheck{key: "1/pod/hash", time: time.Now().Add(-CertExpiryCheckInterval)}
+	if !checks.due(name, "1/pod/hash") {
+		t.Errorf("expected a check due once the interval passes")
+	}
+	checks.forget(name)
+	if !checks.due(name, "1/pod/hash") {
+		t.Errorf("expected a check due for a forgotten vpn gw")
+	}
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// reload the renewed certificate in place, the argument is the sha256 of the renewed tls.crt,
+	// the scripts wait for kubelet to refresh the mounted secret,
+	// openvpn restarts by SIGHUP without restarting the container, strongswan loads the credentials
+	SslVpnCertReloadCMD   = "/etc/openvpn/setup/reload-certs.sh"
+	IpsecVpnCertReloadCMD = "/connection.sh reload-creds"
+)
+
+// certificateStatus returns the certificate of the secret which the vpn server should load
+func certificateStatus(secret *corev1.Secret) (*vpngwv2.CertificateStatus, error) {
+	data, ok := secret.Data[IpsecCertKey]
+	if !ok {
+		return nil, fmt.Errorf("secret %s has no %s key", secret.Name, IpsecCertKey)
+	}
+	cert, err := parseCertificate(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s of secret %s: %v", IpsecCertKey, secret.Name, err)
+	}
+	hash := sha256.Sum256(data)
+	return &vpngwv2.CertificateStatus{
+		Secret:   secret.Name,
+		Hash:     hex.EncodeToString(hash[:]),
+		Serial:   cert.SerialNumber.Text(16),
+		NotAfter: metav1.NewTime(cert.NotAfter),
+	}, nil
+}
+
+// reloadCertificate reloads the certificate of the vpn server if the secret changed since it was last loaded,
+// returns the certificate loaded by the vpn server
+func (r *VpnGwReconciler) reloadCertificate(ctx context.Context, pod *corev1.Pod, container, secretName, cmd string, loaded *vpngwv2.CertificateStatus, restarted bool) (*vpngwv2.CertificateStatus, error) {
+	secret := &corev1.Secret{}
+	if err := r.Get(ctx, types.NamespacedName{Name: secretName, Namespace: pod.Namespace}, secret); err != nil {
+		if apierrors.IsNotFound(err) {
+			// the vpn server keeps the certificate it has loaded, the expiry check reports the missing secret
+			r.Log.Error(err, "keep the loaded certificate", "container", container, "secret", secretName)
+			return loaded, nil
+		}
+		return nil, fmt.Errorf("failed to get secret %s: %v", secretName, err)
+	}
+	current, err := certificateStatus(secret)
+	if err != nil {
+		return nil, err
+	}
+	// a restarted server has loaded the current certificate on start up
+	if restarted || loaded == nil || (loaded.Secret == current.Secret && loaded.Hash == current.Hash) {
+		return current, nil
+	}
+
+	r.Log.Info("certificate changed, reload it", "container", container, "secret", secretName, "serial", current.Serial)
+	stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, container, []string{"/bin/bash", "-c", cmd + " " + current.Hash}...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reload certificate, stdOutput: %v, errOutput: %v, err: %v", stdOutput, errOutput, err)
+	}
+	return current, nil
+}
+
+// reloadCertificates reloads the renewed certificates of the ssl and ipsec vpn servers in place
+func (r *VpnGwReconciler) reloadCertificates(ctx context.Context, gw *vpngwv2.VpnGw, pod *corev1.Pod, restarted bool) (ssl, ipsec *vpngwv2.CertificateStatus, err error) {
+	if gw.Spec.SslVpn.Enabled {
+		ssl, err = r.reloadCertificate(ctx, pod, SslVpnServer, gw.Spec.SslVpn.SslSecret, SslVpnCertReloadCMD, gw.Status.SslVpnCertificate, restarted)
+		if err != nil {
+			r.Log.Error(err, "failed to reload ssl vpn certificate")
+			return nil, nil, err
+		}
+	}
+	if gw.Spec.IpsecVpn.Enabled {
+		ipsec, err = r.reloadCertificate(ctx, pod, IpsecVpnServer, gw.Spec.IpsecVpn.IpsecSecret, IpsecVpnCertReloadCMD, gw.Status.IpsecVpnCertificate, restarted)
+		if err != nil {
+			r.Log.Error(err, "failed to reload ipsec vpn certificate")
+			return nil, nil, err
+		}
+	}
+	return ssl, ipsec, nil
+}
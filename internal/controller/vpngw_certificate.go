@@ -0,0 +1,207 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// certificates of the vpn gw issued by cert-manager, <vpn gw>-ssl-vpn and <vpn gw>-ipsec-vpn
+	SslVpnCertificateSuffix   = "-ssl-vpn"
+	IpsecVpnCertificateSuffix = "-ipsec-vpn"
+
+	CertManagerGroup = "cert-manager.io"
+)
+
+// cert-manager is optional, so its certificates are handled as unstructured objects
+var certificateGVK = schema.GroupVersionKind{Group: CertManagerGroup, Version: "v1", Kind: "Certificate"}
+
+// vpnGwCertificate is a certificate of the vpn gw and the secret it is issued into
+type vpnGwCertificate struct {
+	Name       string
+	SecretName string
+	// key usages, openvpn checks the server certificate has key usage by remote-cert-tls,
+	// ipsec site-to-site peers are both initiator and responder
+	Usages []interface{}
+}
+
+// vpnGwCertificates returns the certificates wanted by the enabled vpn servers
+func vpnGwCertificates(gw *vpngwv2.VpnGw) []vpnGwCertificate {
+	certs := []vpnGwCertificate{}
+	if gw.Spec.SslVpn.Enabled {
+		certs = append(certs, vpnGwCertificate{
+			Name:       gw.Name + SslVpnCertificateSuffix,
+			SecretName: gw.Spec.SslVpn.SslSecret,
+			Usages:     []interface{}{"digital signature", "key encipherment", "server auth"},
+		})
+	}
+	if gw.Spec.IpsecVpn.Enabled {
+		certs = append(certs, vpnGwCertificate{
+			Name:       gw.Name + IpsecVpnCertificateSuffix,
+			SecretName: gw.Spec.IpsecVpn.IpsecSecret,
+			Usages:     []interface{}{"digital signature", "key encipherment", "server auth", "client auth"},
+		})
+	}
+	return certs
+}
+
+// certificateCommonName returns the common name of the vpn gw certificates
+func certificateCommonName(gw *vpngwv2.VpnGw) string {
+	if gw.Spec.CertManager.CommonName != "" {
+		return gw.Spec.CertManager.CommonName
+	}
+	if addr := ipsecServerAddr(gw); addr != "" {
+		return addr
+	}
+	return gw.Name
+}
+
+func newCertificate(name, namespace string) *unstructured.Unstructured {
+	cert := &unstructured.Unstructured{}
+	cert.SetGroupVersionKind(certificateGVK)
+	cert.SetName(name)
+	cert.SetNamespace(namespace)
+	return cert
+}
+
+// certificateSpec returns the cert-manager certificate spec of the vpn gw certificate
+func certificateSpec(gw *vpngwv2.VpnGw, want vpnGwCertificate) map[string]interface{} {
+	cm := gw.Spec.CertManager
+	issuerRef := map[string]interface{}{
+		"name": cm.IssuerRef.Name,
+	}
+	if cm.IssuerRef.Kind != "" {
+		issuerRef["kind"] = cm.IssuerRef.Kind
+	}
+	if cm.IssuerRef.Group != "" {
+		issuerRef["group"] = cm.IssuerRef.Group
+	}
+	spec := map[string]interface{}{
+		"secretName": want.SecretName,
+		"commonName": certificateCommonName(gw),
+		"issuerRef":  issuerRef,
+		"usages":     want.Usages,
+	}
+	if gw.Spec.PublicEndpoint.Hostname != "" {
+		spec["dnsNames"] = []interface{}{gw.Spec.PublicEndpoint.Hostname}
+	}
+	if gw.Spec.PublicEndpoint.Ip != "" {
+		spec["ipAddresses"] = []interface{}{gw.Spec.PublicEndpoint.Ip}
+	}
+	if cm.Duration != nil {
+		spec["duration"] = cm.Duration.Duration.String()
+	}
+	if cm.RenewBefore != nil {
+		spec["renewBefore"] = cm.RenewBefore.Duration.String()
+	}
+	return spec
+}
+
+// certificateReady returns whether the cert-manager certificate is ready and the reason if not
+func certificateReady(cert *unstructured.Unstructured) (bool, string) {
+	conditions, _, _ := unstructured.NestedSlice(cert.Object, "status", "conditions")
+	for _, c := range conditions {
+		condition, ok := c.(map[string]interface{})
+		if !ok || condition["type"] != "Ready" {
+			continue
+		}
+		if condition["status"] == string(metav1.ConditionTrue) {
+			return true, ""
+		}
+		message, _ := condition["message"].(string)
+		return false, message
+	}
+	return false, "waiting for cert-manager to issue the certificate"
+}
+
+// reconcileCertificates creates or updates the cert-manager certificates of the vpn gw,
+// returns the CertificateReady condition, nil if the secrets are created out of band
+func (r *VpnGwReconciler) reconcileCertificates(ctx context.Context, gw *vpngwv2.VpnGw) (*metav1.Condition, error) {
+	if gw.Spec.CertManager == nil {
+		// clean up the certificates issued before, cert-manager may be not installed at all
+		if meta.FindStatusCondition(gw.Status.Conditions, vpngwv2.VpnGwCertificateReady) == nil {
+			return nil, nil
+		}
+		for _, suffix := range []string{SslVpnCertificateSuffix, IpsecVpnCertificateSuffix} {
+			err := r.Delete(ctx, newCertificate(gw.Name+suffix, gw.Namespace))
+			if err != nil && !apierrors.IsNotFound(err) && !meta.IsNoMatchError(err) {
+				r.Log.Error(err, "failed to delete certificate", "certificate", gw.Name+suffix)
+				return nil, err
+			}
+		}
+		return nil, nil
+	}
+
+	condition := &metav1.Condition{
+		Type:               vpngwv2.VpnGwCertificateReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            "certificates are issued by cert-manager",
+		ObservedGeneration: gw.Generation,
+	}
+	wanted := vpnGwCertificates(gw)
+	notReady := []string{}
+	for _, want := range wanted {
+		cert := newCertificate(want.Name, gw.Namespace)
+		op, err := controllerutil.CreateOrUpdate(ctx, r.Client, cert, func() error {
+			cert.SetLabels(labelsForVpnGw(gw))
+			if err := unstructured.SetNestedMap(cert.Object, certificateSpec(gw, want), "spec"); err != nil {
+				return err
+			}
+			return controllerutil.SetControllerReference(gw, cert, r.Scheme)
+		})
+		if err != nil {
+			r.Log.Error(err, "failed to create or update certificate", "certificate", want.Name)
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "CertificateError"
+			condition.Message = fmt.Sprintf("failed to create or update certificate %s: %v", want.Name, err)
+			return condition, err
+		}
+		r.Log.Info("certificate reconciled", "certificate", want.Name, "operation", op)
+		if ready, message := certificateReady(cert); !ready {
+			notReady = append(notReady, fmt.Sprintf("%s: %s", want.Name, message))
+		}
+	}
+	// the certificate of a disabled vpn server is not needed any more
+	for _, suffix := range []string{SslVpnCertificateSuffix, IpsecVpnCertificateSuffix} {
+		name := gw.Name + suffix
+		found := false
+		for _, want := range wanted {
+			found = found || want.Name == name
+		}
+		if found {
+			continue
+		}
+		if err := r.Delete(ctx, newCertificate(name, gw.Namespace)); err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to delete certificate", "certificate", name)
+			return nil, err
+		}
+	}
+	if len(notReady) != 0 {
+		condition.Status = metav1.ConditionFalse
+		condition.Reason = "Issuing"
+		condition.Message = strings.Join(notReady, "; ")
+	}
+	return condition, nil
+}
+
+// updateVpnGwCondition sets the condition of the vpn gw status if it changed
+func (r *VpnGwReconciler) updateVpnGwCondition(ctx context.Context, gw *vpngwv2.VpnGw, condition metav1.Condition) error {
+	newGw := gw.DeepCopy()
+	meta.SetStatusCondition(&newGw.Status.Conditions, condition)
+	if reflect.DeepEqual(gw.Status.Conditions, newGw.Status.Conditions) {
+		return nil
+	}
+	return r.Status().Update(ctx, newGw)
+}
@@ -20,26 +20,36 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"reflect"
 	"strconv"
 	"strings"
 	"time"
 
 	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+	"k8s.io/apimachinery/pkg/api/equality"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
-	"k8s.io/apimachinery/pkg/api/resource"
+	"k8s.io/apimachinery/pkg/api/meta"
+	"k8s.io/apimachinery/pkg/labels"
 	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/selection"
 	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
+	"k8s.io/client-go/tools/record"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
 	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
 	"sigs.k8s.io/controller-runtime/pkg/event"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
-	vpngwv1 "github.com/kubecombo/kube-combo/api/v1"
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
 
 	// kubeovnv1 "github.com/kubeovn/kube-ovn/pkg/apis/kubeovn/v1"
 	appsv1 "k8s.io/api/apps/v1"
@@ -58,9 +68,9 @@ const (
 	DhSecretPath       = "/etc/ovpn/dh"
 	IpsecVpnSecretPath = "/etc/ipsec/certs"
 
-	SslVpnStartUpCMD               = "/etc/openvpn/setup/configure.sh"
-	IpsecVpnStartUpCMD             = "/usr/sbin/charon-systemd"
-	IpsecConnectionRefreshTemplate = "/connection.sh refresh %s"
+	SslVpnStartUpCMD         = "/etc/openvpn/setup/configure.sh"
+	IpsecVpnStartUpCMD       = "/start.sh"
+	IpsecConnectionReloadCMD = "/connection.sh reload"
 
 	EnableSslVpnLabel   = "enable-ssl-vpn"
 	EnableIpsecVpnLabel = "enable-ipsec-vpn"
@@ -85,7 +95,6 @@ const (
 	// vpn gw pod env
 	OvpnProtoKey      = "OVPN_PROTO"
 	OvpnPortKey       = "OVPN_PORT"
-	OvpnCipherKey     = "OVPN_CIPHER"
 	OvpnSubnetCidrKey = "OVPN_SUBNET_CIDR"
 
 	IpsecRemoteAddrsKey = "IPSEC_REMOTE_ADDRS"
@@ -101,19 +110,22 @@ type VpnGwReconciler struct {
 	Scheme     *runtime.Scheme
 	Namespace  string
 	Reload     chan event.GenericEvent
+	// policy of the ipsec connection proposals and ike version
+	IpsecPolicy *IpsecAlgorithmPolicy
+	// how long before expiry a certificate is reported as expiring soon
+	CertExpiryThreshold time.Duration
+	Recorder            record.EventRecorder
+
+	dh         *dhGenerator
+	certChecks *certExpiryChecks
 }
 
-func (r *VpnGwReconciler) validateVpnGw(gw *vpngwv1.VpnGw, namespacedName string) error {
+func (r *VpnGwReconciler) validateVpnGw(gw *vpngwv2.VpnGw, namespacedName string) error {
 	if gw.Spec.Subnet == "" {
 		err := fmt.Errorf("vpn gw subnet is required")
 		r.Log.Error(err, "should set subnet")
 		return err
 	}
-	if gw.Status.Subnet != "" && gw.Spec.Subnet != gw.Status.Subnet {
-		err := fmt.Errorf("vpn gw subnet not support change")
-		r.Log.Error(err, "vpn gw should not change subnet")
-		return err
-	}
 
 	if gw.Spec.Ip == "" {
 		r.Log.Info("vpn gw pod ip random allocate", "name", namespacedName)
@@ -127,121 +139,169 @@ func (r *VpnGwReconciler) validateVpnGw(gw *vpngwv1.VpnGw, namespacedName string
 		return err
 	}
 
-	if gw.Spec.EnableSslVpn {
-		if gw.Spec.OvpnCipher == "" {
+	if gw.Spec.SslVpn.Enabled {
+		if gw.Spec.SslVpn.Cipher == "" {
 			err := fmt.Errorf("ssl vpn cipher is required")
 			r.Log.Error(err, "should set cipher")
 			return err
 		}
-		if gw.Spec.OvpnProto == "" {
+		if gw.Spec.SslVpn.Proto == "" {
 			err := fmt.Errorf("ssl vpn proto is required")
 			r.Log.Error(err, "should set ssl vpn proto")
 			return err
 		}
-		if gw.Spec.OvpnPort != 1149 && gw.Spec.OvpnPort != 443 {
+		if gw.Spec.SslVpn.Port == 0 {
 			err := fmt.Errorf("ssl vpn port is required")
-			r.Log.Error(err, "should set vpn port, udp 1149, tcp 443")
+			r.Log.Error(err, "should set ssl vpn port, such as udp 1194, and tcpFallback port such as tcp 443")
 			return err
 		}
-		if gw.Spec.OvpnSubnetCidr == "" {
+		if gw.Spec.SslVpn.SubnetCidr == "" {
 			err := fmt.Errorf("ssl vpn subnet cidr is required")
 			r.Log.Error(err, "should set ssl vpn client and server subnet")
 			return err
 		}
-		if gw.Spec.OvpnProto != "udp" && gw.Spec.OvpnProto != "tcp" {
+		if _, err := parseSslVpnSubnet(gw.Spec.SslVpn.SubnetCidr); err != nil {
+			r.Log.Error(err, "should set valid ssl vpn client and server subnet")
+			return err
+		}
+		if gw.Spec.SslVpn.Proto != "udp" && gw.Spec.SslVpn.Proto != "tcp" {
 			err := fmt.Errorf("ssl vpn proto should be udp or tcp")
 			r.Log.Error(err, "should set reasonable vpn proto")
 			return err
 		}
-		if gw.Spec.SslVpnImage == "" {
+		if err := validateSslVpnListeners(gw); err != nil {
+			r.Log.Error(err, "should set ssl vpn ports not used by ipsec vpn and a valid tcp fallback")
+			return err
+		}
+		if gw.Spec.SslVpn.Image == "" {
 			err := fmt.Errorf("ssl vpn image is required")
 			r.Log.Error(err, "should set ssl vpn image")
 			return err
 		}
+		if err := validateOpenVpnConfig(&gw.Spec.SslVpn); err != nil {
+			r.Log.Error(err, "should set valid ssl vpn server options")
+			return err
+		}
+		if err := validateSslVpnPush(&gw.Spec.SslVpn); err != nil {
+			r.Log.Error(err, "should set valid ssl vpn routes, dns servers and search domains")
+			return err
+		}
+		if gw.Spec.SslVpn.Auth != nil {
+			if err := validateSslVpnAuth(gw.Spec.SslVpn.Auth); err != nil {
+				r.Log.Error(err, "should set valid ssl vpn auth")
+				return err
+			}
+		}
 	}
-	return nil
-}
-
-func (r *VpnGwReconciler) isChanged(gw *vpngwv1.VpnGw, ipsecConnections []string) bool {
-	changed := false
-	if gw.Status.Subnet == "" && gw.Spec.Subnet != "" {
-		gw.Status.Subnet = gw.Spec.Subnet
-		changed = true
-	}
-
-	if gw.Status.Cpu != gw.Spec.Cpu {
-		gw.Status.Cpu = gw.Spec.Cpu
-		changed = true
-	}
-	if gw.Status.Memory != gw.Spec.Memory {
-		gw.Status.Memory = gw.Spec.Memory
-		changed = true
-	}
-	if gw.Status.QoSBandwidth != gw.Spec.QoSBandwidth {
-		gw.Status.QoSBandwidth = gw.Spec.QoSBandwidth
-		changed = true
-	}
-	if gw.Status.Ip != gw.Spec.Ip {
-		gw.Status.Ip = gw.Spec.Ip
-		changed = true
-	}
-	if gw.Status.Replicas != gw.Spec.Replicas {
-		gw.Status.Replicas = gw.Spec.Replicas
-		changed = true
+	if gw.Spec.IpsecVpn.Enabled && gw.Spec.IpsecVpn.Image == "" {
+		err := fmt.Errorf("ipsec vpn image is required")
+		r.Log.Error(err, "should set ipsec vpn image")
+		return err
 	}
-
-	if gw.Status.EnableSslVpn != gw.Spec.EnableSslVpn {
-		gw.Status.EnableSslVpn = gw.Spec.EnableSslVpn
-		if gw.Status.OvpnCipher != gw.Spec.OvpnCipher {
-			gw.Status.OvpnCipher = gw.Spec.OvpnCipher
+	if ra := gw.Spec.IpsecVpn.RemoteAccess; ra != nil {
+		if !gw.Spec.IpsecVpn.Enabled {
+			err := fmt.Errorf("ipsec remote access requires ipsec vpn")
+			r.Log.Error(err, "should enable ipsec vpn")
+			return err
 		}
-		if gw.Status.OvpnProto != gw.Spec.OvpnProto {
-			gw.Status.OvpnProto = gw.Spec.OvpnProto
+		if gw.Spec.IpsecVpn.IpsecSecret == "" {
+			err := fmt.Errorf("ipsec remote access requires ipsec secret")
+			r.Log.Error(err, "should set ipsec secret, the server certificate and ca are used by clients")
+			return err
 		}
-		if gw.Status.OvpnPort != gw.Spec.OvpnPort {
-			gw.Status.OvpnPort = gw.Spec.OvpnPort
+		if ipsecServerAddr(gw) == "" {
+			err := fmt.Errorf("ipsec remote access requires public endpoint")
+			r.Log.Error(err, "should set public endpoint ip or hostname")
+			return err
 		}
-		if gw.Status.OvpnSubnetCidr != gw.Spec.OvpnSubnetCidr {
-			gw.Status.OvpnSubnetCidr = gw.Spec.OvpnSubnetCidr
+		prefix, err := netip.ParsePrefix(ra.PoolCidr)
+		if err != nil || prefix.Masked() != prefix {
+			err := fmt.Errorf("ipsec remote access pool cidr %q is invalid", ra.PoolCidr)
+			r.Log.Error(err, "should set valid pool cidr, eg: 10.250.0.0/24")
+			return err
 		}
-		if gw.Status.SslVpnImage != gw.Spec.SslVpnImage {
-			gw.Status.SslVpnImage = gw.Spec.SslVpnImage
+		switch ra.Auth {
+		case IpsecRemoteAccessMschapV2:
+			if ra.UsersSecret == "" {
+				err := fmt.Errorf("ipsec remote access users secret is required if auth is %s", ra.Auth)
+				r.Log.Error(err, "should set users secret")
+				return err
+			}
+		case IpsecRemoteAccessEapTls:
+			if ra.ClientCertsSecret == "" {
+				err := fmt.Errorf("ipsec remote access client certs secret is required if auth is %s", ra.Auth)
+				r.Log.Error(err, "should set client certs secret")
+				return err
+			}
+		default:
+			err := fmt.Errorf("ipsec remote access auth %q is invalid", ra.Auth)
+			r.Log.Error(err, "should set auth eap-mschapv2 or eap-tls")
+			return err
 		}
-		changed = true
-	}
-
-	if gw.Status.EnableIpsecVpn != gw.Spec.EnableIpsecVpn {
-		gw.Status.EnableIpsecVpn = gw.Spec.EnableIpsecVpn
-		if gw.Status.IpsecVpnImage != gw.Spec.IpsecVpnImage {
-			gw.Status.IpsecVpnImage = gw.Spec.IpsecVpnImage
+		for _, dns := range ra.Dns {
+			if _, err := netip.ParseAddr(dns); err != nil {
+				err := fmt.Errorf("ipsec remote access dns %q is invalid", dns)
+				r.Log.Error(err, "should set dns server ip")
+				return err
+			}
 		}
-		changed = true
-	}
-
-	if gw.Status.EnableIpsecVpn && ipsecConnections != nil {
-		if !reflect.DeepEqual(gw.Spec.IpsecConnections, ipsecConnections) {
-			gw.Spec.IpsecConnections = ipsecConnections
-			gw.Status.IpsecConnections = ipsecConnections
+		for _, ts := range ra.LocalTs {
+			if err := ts.Validate(); err != nil {
+				r.Log.Error(err, "should set valid remote access local ts")
+				return err
+			}
 		}
-		changed = true
-	}
-
-	if !reflect.DeepEqual(gw.Spec.Selector, gw.Status.Selector) {
-		gw.Status.Selector = gw.Spec.Selector
-		changed = true
 	}
-	if !reflect.DeepEqual(gw.Spec.Tolerations, gw.Status.Tolerations) {
-		gw.Status.Tolerations = gw.Spec.Tolerations
-		changed = true
+	if cm := gw.Spec.CertManager; cm != nil {
+		if cm.IssuerRef.Name == "" {
+			err := fmt.Errorf("cert-manager issuer is required")
+			r.Log.Error(err, "should set cert-manager issuer ref name")
+			return err
+		}
+		if gw.Spec.SslVpn.Enabled && gw.Spec.SslVpn.SslSecret == "" {
+			err := fmt.Errorf("ssl vpn secret is required, the certificate is issued into it")
+			r.Log.Error(err, "should set ssl vpn secret")
+			return err
+		}
+		if gw.Spec.IpsecVpn.Enabled && gw.Spec.IpsecVpn.IpsecSecret == "" {
+			err := fmt.Errorf("ipsec vpn secret is required, the certificate is issued into it")
+			r.Log.Error(err, "should set ipsec vpn secret")
+			return err
+		}
+		// the ssl and ipsec certificates have different usages, they can not be issued into the same secret
+		if gw.Spec.SslVpn.Enabled && gw.Spec.IpsecVpn.Enabled && gw.Spec.SslVpn.SslSecret == gw.Spec.IpsecVpn.IpsecSecret {
+			err := fmt.Errorf("ssl vpn secret and ipsec vpn secret should be different, the certificates are issued into them")
+			r.Log.Error(err, "should set different ssl vpn secret and ipsec vpn secret")
+			return err
+		}
 	}
-	if !reflect.DeepEqual(gw.Spec.Affinity, gw.Status.Affinity) {
-		gw.Status.Affinity = gw.Spec.Affinity
-		changed = true
+	if export := gw.Spec.IpsecVpn.PeerExport; export != nil {
+		if !gw.Spec.IpsecVpn.Enabled || gw.Spec.IpsecVpn.IpsecSecret == "" {
+			err := fmt.Errorf("ipsec peer export requires ipsec vpn and ipsec secret")
+			r.Log.Error(err, "should enable ipsec vpn and set ipsec secret, the peer descriptor is signed by its key")
+			return err
+		}
+		if _, err := netip.ParseAddr(gw.Spec.PublicEndpoint.Ip); err != nil {
+			err := fmt.Errorf("ipsec peer export requires public endpoint ip")
+			r.Log.Error(err, "should set public endpoint ip")
+			return err
+		}
+		if len(export.Cidrs) == 0 {
+			err := fmt.Errorf("ipsec peer export cidrs is required")
+			r.Log.Error(err, "should set peer export cidrs")
+			return err
+		}
+		for _, ts := range export.Cidrs {
+			if err := ts.Validate(); err != nil {
+				r.Log.Error(err, "should set valid peer export cidrs")
+				return err
+			}
+		}
 	}
-	return changed
+	return nil
 }
 
-func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv1.VpnGw, oldSts *appsv1.StatefulSet) (newSts *appsv1.StatefulSet) {
+func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv2.VpnGw, oldSts *appsv1.StatefulSet) (newSts *appsv1.StatefulSet) {
 	namespacedName := fmt.Sprintf("%s/%s", gw.Namespace, gw.Name)
 	r.Log.Info("start statefulSetForVpnGw", "vpn gw", namespacedName)
 	defer r.Log.Info("end statefulSetForVpnGw", "vpn gw", namespacedName)
@@ -260,62 +320,47 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv1.VpnGw, oldSts *appsv1.
 		KubeovnIngressRateAnnotation:   gw.Spec.QoSBandwidth,
 		KubeovnEgressRateAnnotation:    gw.Spec.QoSBandwidth,
 	}
+	if gw.Spec.SslVpn.Enabled {
+		// openvpn reads its configuration at start only
+		podAnnotations[SslVpnConfHashAnnotation] = sslVpnConfHash(gw)
+	}
 	for key, value := range podAnnotations {
 		newPodAnnotations[key] = value
 	}
 
 	containers := []corev1.Container{}
 	volumes := []corev1.Volume{}
-	if gw.Spec.EnableSslVpn {
+	if gw.Spec.SslVpn.Enabled {
 		sslContainer := corev1.Container{
 			Name:  SslVpnServer,
-			Image: gw.Spec.SslVpnImage,
+			Image: gw.Spec.SslVpn.Image,
 			VolumeMounts: []corev1.VolumeMount{
 				// mount x.509 secret
 				{
-					Name:      gw.Spec.SslSecret,
+					Name:      gw.Spec.SslVpn.SslSecret,
 					MountPath: SslSecretPath,
 					ReadOnly:  true,
 				},
-				// mount openssl dhparams secret
-				{
-					Name:      gw.Spec.DhSecret,
-					MountPath: DhSecretPath,
-					ReadOnly:  true,
-				},
 			},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(gw.Spec.Cpu),
-					corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
-				},
-				Limits: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(gw.Spec.Cpu),
-					corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
-				},
-			},
-			Command: []string{SslVpnStartUpCMD},
+			Resources: gw.Spec.Resources,
+			Command:   []string{SslVpnStartUpCMD},
 			Ports: []corev1.ContainerPort{{
-				ContainerPort: int32(gw.Spec.OvpnPort),
+				ContainerPort: gw.Spec.SslVpn.Port,
 				Name:          SslVpnServer,
-				Protocol:      corev1.Protocol(strings.ToUpper(gw.Spec.OvpnProto)),
+				Protocol:      corev1.Protocol(strings.ToUpper(gw.Spec.SslVpn.Proto)),
 			}},
 			Env: []corev1.EnvVar{
 				{
 					Name:  OvpnProtoKey,
-					Value: gw.Spec.OvpnProto,
+					Value: gw.Spec.SslVpn.Proto,
 				},
 				{
 					Name:  OvpnPortKey,
-					Value: strconv.Itoa(gw.Spec.OvpnPort),
-				},
-				{
-					Name:  OvpnCipherKey,
-					Value: gw.Spec.OvpnCipher,
+					Value: strconv.Itoa(int(gw.Spec.SslVpn.Port)),
 				},
 				{
 					Name:  OvpnSubnetCidrKey,
-					Value: gw.Spec.OvpnSubnetCidr,
+					Value: gw.Spec.SslVpn.SubnetCidr,
 				},
 			},
 			ImagePullPolicy: corev1.PullIfNotPresent,
@@ -325,52 +370,149 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv1.VpnGw, oldSts *appsv1.
 			},
 		}
 		sslSecretVolume := corev1.Volume{
-			Name: gw.Spec.SslSecret,
+			Name: gw.Spec.SslVpn.SslSecret,
 			// define secrect volume
 			VolumeSource: corev1.VolumeSource{
 				Secret: &corev1.SecretVolumeSource{
-					SecretName: gw.Spec.SslSecret,
+					SecretName: gw.Spec.SslVpn.SslSecret,
 					Optional:   &[]bool{true}[0],
 				},
 			},
 		}
 		volumes = append(volumes, sslSecretVolume)
-		dhSecretVolume := corev1.Volume{
-			Name: gw.Spec.DhSecret,
-			// define secrect volume
-			VolumeSource: corev1.VolumeSource{
-				Secret: &corev1.SecretVolumeSource{
-					SecretName: gw.Spec.DhSecret,
-					Optional:   &[]bool{true}[0],
+		if gw.Spec.SslVpn.DisableDh {
+			sslContainer.Env = append(sslContainer.Env, corev1.EnvVar{
+				Name:  OvpnDhNoneKey,
+				Value: "true",
+			})
+		} else {
+			// mount openssl dhparams secret
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      dhSecretName(gw),
+				MountPath: DhSecretPath,
+				ReadOnly:  true,
+			})
+			dhSecretVolume := corev1.Volume{
+				Name: dhSecretName(gw),
+				// define secrect volume
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: dhSecretName(gw),
+						Optional:   &[]bool{true}[0],
+					},
 				},
-			},
+			}
+			volumes = append(volumes, dhSecretVolume)
+		}
+		// totp keys of the clients
+		if gw.Spec.SslVpn.RequireTotp {
+			sslContainer.Env = append(sslContainer.Env, corev1.EnvVar{
+				Name:  OvpnTotpKey,
+				Value: "true",
+			})
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      gw.Name + SslVpnTotpSecretSuffix,
+				MountPath: SslVpnTotpSecretPath,
+				ReadOnly:  true,
+			})
+			volumes = append(volumes, corev1.Volume{
+				Name: gw.Name + SslVpnTotpSecretSuffix,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: gw.Name + SslVpnTotpSecretSuffix,
+						Optional:   &[]bool{true}[0],
+					},
+				},
+			})
+		}
+		// openvpn.conf, client config dir, access rules and rate limits of the clients
+		configMaps := []struct{ name, path string }{
+			{gw.Name + SslVpnConfigMapSuffix, SslVpnConfigPath},
+			{gw.Name + SslVpnCcdConfigMapSuffix, SslVpnCcdPath},
+			{gw.Name + SslVpnAccessConfigMapSuffix, SslVpnAccessPath},
+			{gw.Name + SslVpnBandwidthConfigMapSuffix, SslVpnBandwidthPath},
+		}
+		// the tcp fallback listener runs another openvpn instance along with the udp one
+		if fallback := gw.Spec.SslVpn.TcpFallback; fallback != nil {
+			sslContainer.Ports = append(sslContainer.Ports, corev1.ContainerPort{
+				ContainerPort: fallback.Port,
+				Name:          SslVpnServer + "-tcp",
+				Protocol:      corev1.ProtocolTCP,
+			})
+			sslContainer.Env = append(sslContainer.Env, corev1.EnvVar{
+				Name:  OvpnTcpPortKey,
+				Value: strconv.Itoa(int(fallback.Port)),
+			}, corev1.EnvVar{
+				Name:  OvpnTcpSubnetCidrKey,
+				Value: fallback.SubnetCidr,
+			})
+			configMaps = append(configMaps, struct{ name, path string }{gw.Name + SslVpnTcpCcdConfigMapSuffix, SslVpnTcpCcdPath})
+		}
+		for _, cm := range configMaps {
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      cm.name,
+				MountPath: cm.path,
+				ReadOnly:  true,
+			})
+			volumes = append(volumes, corev1.Volume{
+				Name: cm.name,
+				VolumeSource: corev1.VolumeSource{
+					ConfigMap: &corev1.ConfigMapVolumeSource{
+						LocalObjectReference: corev1.LocalObjectReference{Name: cm.name},
+						Optional:             &[]bool{true}[0],
+					},
+				},
+			})
+		}
+		// routes, dns and tunnel mode pushed to the clients
+		sslContainer.Env = append(sslContainer.Env, sslVpnPushEnv(&gw.Spec.SslVpn)...)
+		// data channel options rendered into the client profiles
+		sslContainer.Env = append(sslContainer.Env, sslVpnClientEnv(&gw.Spec.SslVpn)...)
+		// user name and password authentication
+		sslContainer.Env = append(sslContainer.Env, sslVpnAuthEnv(gw.Spec.SslVpn.Auth)...)
+		if secret := sslVpnAuthSecret(gw.Spec.SslVpn.Auth); secret != "" {
+			sslContainer.VolumeMounts = append(sslContainer.VolumeMounts, corev1.VolumeMount{
+				Name:      SslVpnAuthVolume,
+				MountPath: SslVpnAuthSecretPath,
+				ReadOnly:  true,
+			})
+			volumes = append(volumes, corev1.Volume{
+				Name: SslVpnAuthVolume,
+				VolumeSource: corev1.VolumeSource{
+					Secret: &corev1.SecretVolumeSource{
+						SecretName: secret,
+					},
+				},
+			})
 		}
-		volumes = append(volumes, dhSecretVolume)
 		containers = append(containers, sslContainer)
 	}
-	if gw.Spec.EnableIpsecVpn {
+	if gw.Spec.IpsecVpn.Enabled {
 		ipsecContainer := corev1.Container{
 			Name:  IpsecVpnServer,
-			Image: gw.Spec.IpsecVpnImage,
+			Image: gw.Spec.IpsecVpn.Image,
 			// mount x.509 secret
 			VolumeMounts: []corev1.VolumeMount{
 				{
-					Name:      gw.Spec.IpsecSecret,
+					Name:      gw.Spec.IpsecVpn.IpsecSecret,
 					MountPath: IpsecVpnSecretPath,
 					ReadOnly:  true,
 				},
-			},
-			Resources: corev1.ResourceRequirements{
-				Requests: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(gw.Spec.Cpu),
-					corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
+				// mount ipsec connections configuration
+				{
+					Name:      gw.Name + IpsecConfigMapSuffix,
+					MountPath: IpsecConfigPath,
+					ReadOnly:  true,
 				},
-				Limits: corev1.ResourceList{
-					corev1.ResourceCPU:    resource.MustParse(gw.Spec.Cpu),
-					corev1.ResourceMemory: resource.MustParse(gw.Spec.Memory),
+				// mount ipsec connections secrets
+				{
+					Name:      gw.Name + IpsecSecretSuffix,
+					MountPath: IpsecSecretsPath,
+					ReadOnly:  true,
 				},
 			},
-			Command: []string{IpsecVpnStartUpCMD},
+			Resources: gw.Spec.Resources,
+			Command:   []string{IpsecVpnStartUpCMD},
 			Ports: []corev1.ContainerPort{
 				{
 					ContainerPort: IpSecIsakmpPort,
@@ -395,15 +537,39 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv1.VpnGw, oldSts *appsv1.
 		}
 		ipsecSecretVolume := corev1.Volume{
 			// define secrect volume
-			Name: gw.Spec.IpsecSecret,
+			Name: gw.Spec.IpsecVpn.IpsecSecret,
 			VolumeSource: corev1.VolumeSource{
 				Secret: &corev1.SecretVolumeSource{
-					SecretName: gw.Spec.IpsecSecret,
+					SecretName: gw.Spec.IpsecVpn.IpsecSecret,
 					Optional:   &[]bool{true}[0],
 				},
 			},
 		}
 		volumes = append(volumes, ipsecSecretVolume)
+		ipsecConfigVolume := corev1.Volume{
+			// define configmap volume
+			Name: gw.Name + IpsecConfigMapSuffix,
+			VolumeSource: corev1.VolumeSource{
+				ConfigMap: &corev1.ConfigMapVolumeSource{
+					LocalObjectReference: corev1.LocalObjectReference{
+						Name: gw.Name + IpsecConfigMapSuffix,
+					},
+					Optional: &[]bool{true}[0],
+				},
+			},
+		}
+		volumes = append(volumes, ipsecConfigVolume)
+		ipsecSecretsVolume := corev1.Volume{
+			// define secrect volume
+			Name: gw.Name + IpsecSecretSuffix,
+			VolumeSource: corev1.VolumeSource{
+				Secret: &corev1.SecretVolumeSource{
+					SecretName: gw.Name + IpsecSecretSuffix,
+					Optional:   &[]bool{true}[0],
+				},
+			},
+		}
+		volumes = append(volumes, ipsecSecretsVolume)
 		containers = append(containers, ipsecContainer)
 	}
 
@@ -434,26 +600,16 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv1.VpnGw, oldSts *appsv1.
 		},
 	}
 
-	if len(gw.Spec.Selector) > 0 {
-		selectors := make(map[string]string)
-		for _, v := range gw.Spec.Selector {
-			parts := strings.Split(strings.TrimSpace(v), ":")
-			if len(parts) != 2 {
-				continue
-			}
-			selectors[strings.TrimSpace(parts[0])] = strings.TrimSpace(parts[1])
-		}
-		newSts.Spec.Template.Spec.NodeSelector = selectors
+	if len(gw.Spec.NodeSelector) > 0 {
+		newSts.Spec.Template.Spec.NodeSelector = gw.Spec.NodeSelector
 	}
 
 	if len(gw.Spec.Tolerations) > 0 {
 		newSts.Spec.Template.Spec.Tolerations = gw.Spec.Tolerations
 	}
 
-	if gw.Spec.Affinity.NodeAffinity != nil ||
-		gw.Spec.Affinity.PodAffinity != nil ||
-		gw.Spec.Affinity.PodAntiAffinity != nil {
-		newSts.Spec.Template.Spec.Affinity = &gw.Spec.Affinity
+	if gw.Spec.Affinity != nil {
+		newSts.Spec.Template.Spec.Affinity = gw.Spec.Affinity
 	}
 
 	// set gw instance as the owner and controller
@@ -461,15 +617,40 @@ func (r *VpnGwReconciler) statefulSetForVpnGw(gw *vpngwv1.VpnGw, oldSts *appsv1.
 	return
 }
 
+// dropVpnGwOwnerReferences removes the vpn gw owner references set by the previous versions,
+// so that the objects written by users are not garbage collected along with the vpn gw
+func dropVpnGwOwnerReferences(obj metav1.Object) {
+	refs := obj.GetOwnerReferences()
+	kept := make([]metav1.OwnerReference, 0, len(refs))
+	for _, ref := range refs {
+		gv, err := schema.ParseGroupVersion(ref.APIVersion)
+		if err == nil && gv.Group == vpngwv2.GroupVersion.Group && ref.Kind == "VpnGw" {
+			continue
+		}
+		kept = append(kept, ref)
+	}
+	if len(kept) != len(refs) {
+		obj.SetOwnerReferences(kept)
+	}
+}
+
+// VpnGwPodSelector selects the vpn gw pods, all of them carry the enable-ipsec-vpn label,
+// the manager caches the pods matched by it only rather than all the pods of the cluster
+func VpnGwPodSelector() labels.Selector {
+	requirement, _ := labels.NewRequirement(EnableIpsecVpnLabel, selection.Exists, nil)
+	return labels.NewSelector().Add(*requirement)
+}
+
+// labelsForVpnGw returns the labels for selecting the resources
 // belonging to the given vpn gw CR name.
-func labelsForVpnGw(gw *vpngwv1.VpnGw) map[string]string {
+func labelsForVpnGw(gw *vpngwv2.VpnGw) map[string]string {
 	return map[string]string{
-		EnableSslVpnLabel:   strconv.FormatBool(gw.Spec.EnableSslVpn),
-		EnableIpsecVpnLabel: strconv.FormatBool(gw.Spec.EnableIpsecVpn),
+		EnableSslVpnLabel:   strconv.FormatBool(gw.Spec.SslVpn.Enabled),
+		EnableIpsecVpnLabel: strconv.FormatBool(gw.Spec.IpsecVpn.Enabled),
 	}
 }
 
-func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.VpnGw) (SyncState, error) {
+func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv2.VpnGw) (SyncState, error) {
 	// create vpn gw statefulset
 	namespacedName := req.NamespacedName.String()
 	r.Log.Info("start handleAddOrUpdateVpnGw", "vpn gw", namespacedName)
@@ -482,10 +663,99 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.V
 		return SyncStateErrorNoRetry, err
 	}
 
+	// certificates issued by cert-manager should be ready before the pod mounts their secrets
+	certCondition, err := r.reconcileCertificates(context.Background(), gw)
+	if certCondition != nil && certCondition.Status != metav1.ConditionTrue {
+		if err == nil {
+			err = fmt.Errorf("certificates are not ready: %s", certCondition.Message)
+		}
+		r.Log.Error(err, "wait a while for cert-manager to issue the certificates")
+		if err := r.updateVpnGwCondition(context.Background(), gw, *certCondition); err != nil {
+			r.Log.Error(err, "failed to update vpn gw status")
+		}
+		return SyncStateError, err
+	}
+	if err != nil {
+		r.Log.Error(err, "failed to reconcile vpn gw certificates")
+		return SyncStateError, err
+	}
+
+	// dh parameters should be ready before the ssl vpn server starts
+	dhCondition, err := r.reconcileDhSecret(context.Background(), gw)
+	if err != nil {
+		r.Log.Error(err, "failed to reconcile vpn gw dh secret")
+		return SyncStateError, err
+	}
+	if dhCondition != nil && dhCondition.Status != metav1.ConditionTrue {
+		err = fmt.Errorf("dh parameters are not ready: %s", dhCondition.Message)
+		r.Log.Error(err, "wait a while for the dh parameters")
+		if err := r.updateVpnGwCondition(context.Background(), gw, *dhCondition); err != nil {
+			r.Log.Error(err, "failed to update vpn gw status")
+		}
+		return SyncStateError, err
+	}
+
+	// totp keys of the clients should be ready before the ssl vpn server starts
+	if gw.Spec.SslVpn.Enabled && gw.Spec.SslVpn.RequireTotp {
+		if err := r.reconcileSslVpnTotp(context.Background(), gw); err != nil {
+			r.Log.Error(err, "failed to reconcile vpn gw ssl vpn totp keys")
+			return SyncStateError, err
+		}
+	}
+
+	// openvpn.conf and the access rules of the clients should be ready before the ssl vpn server starts
+	var accessHash string
+	if gw.Spec.SslVpn.Enabled {
+		if err := r.reconcileSslVpnConfig(context.Background(), gw); err != nil {
+			r.Log.Error(err, "failed to reconcile vpn gw ssl vpn configuration")
+			return SyncStateError, err
+		}
+		if accessHash, err = r.reconcileSslVpnClientConfig(context.Background(), gw); err != nil {
+			r.Log.Error(err, "failed to reconcile vpn gw ssl vpn client config")
+			return SyncStateError, err
+		}
+	}
+
+	// ipsec connections configuration should be ready before the pod starts
+	var conns []string
+	if gw.Spec.IpsecVpn.Enabled {
+		// fetch ipsec connections
+		res, err := r.getIpsecConnections(context.Background(), gw)
+		if err != nil {
+			r.Log.Error(err, "failed to list vpn gw ipsec connections")
+			return SyncStateError, err
+		}
+		validConns := []vpngwv2.IpsecConn{}
+		for _, v := range res {
+			if v.Spec.VpnGw == "" || v.Spec.VpnGw != gw.Name {
+				err := fmt.Errorf("ipsec connection spec vpn gw is invalid, spec vpn gw: %s", v.Spec.VpnGw)
+				r.Log.Error(err, "ignore invalid ipsec connection")
+				continue
+			}
+			// the invalid connections break swanctl --load-all, skip them as the ipsec connection reconciler reports them
+			if err := validateIpsecConnection(r.Log.WithValues("ipsecConn", v.Name), &v); err != nil {
+				continue
+			}
+			if err := r.IpsecPolicy.Check(&v.Spec); err != nil {
+				r.Log.Error(err, "ignore ipsec connection which violates the algorithm policy", "ipsecConn", v.Name)
+				continue
+			}
+			validConns = append(validConns, v)
+		}
+		validConns, err = r.reconcileIpsecConfig(context.Background(), gw, validConns)
+		if err != nil {
+			r.Log.Error(err, "failed to reconcile vpn gw ipsec configuration")
+			return SyncStateError, err
+		}
+		for _, conn := range validConns {
+			conns = append(conns, conn.Name)
+		}
+	}
+
 	// create or update statefulset
 	needToCreate := false
 	oldSts := &appsv1.StatefulSet{}
-	err := r.Get(context.Background(), req.NamespacedName, oldSts)
+	err = r.Get(context.Background(), req.NamespacedName, oldSts)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			needToCreate = true
@@ -494,7 +764,6 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.V
 			return SyncStateError, err
 		}
 	}
-	newGw := gw.DeepCopy()
 	if needToCreate {
 		newSts := r.statefulSetForVpnGw(gw, nil)
 		err = r.Create(context.Background(), newSts)
@@ -503,8 +772,8 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.V
 			return SyncStateError, err
 		}
 		time.Sleep(5 * time.Second)
-	} else if r.isChanged(newGw, nil) {
-		// update statefulset
+	} else if gw.Generation != gw.Status.ObservedGeneration {
+		// update statefulset once the spec changed
 		newSts := r.statefulSetForVpnGw(gw, oldSts.DeepCopy())
 		err = r.Update(context.Background(), newSts)
 		if err != nil {
@@ -513,75 +782,117 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.V
 		}
 		time.Sleep(5 * time.Second)
 	}
-	var conns []string
-	if gw.Spec.EnableIpsecVpn {
-		// fetch ipsec connections
-		res, err := r.getIpsecConnections(context.Background(), gw)
+	// get pod from statefulset
+	pod, err := r.getVpnGwPod(context.Background(), gw)
+	if err != nil {
+		r.Log.Error(err, "failed to get vpn gw pod")
+		time.Sleep(1 * time.Second)
+		return SyncStateError, err
+	}
+	if !isVpnGwPodRunning(pod) {
+		err = fmt.Errorf("pod is not running now")
+		r.Log.Error(err, "wait a while to apply vpn gw configuration")
+		time.Sleep(5 * time.Second)
+		return SyncStateError, err
+	}
+	r.Log.Info("found vpn gw pod", "pod", pod.Name)
+	// reapply configuration once the pod is recreated or any container restarts
+	restartCount := vpnGwPodRestartCount(pod)
+	reapply := string(pod.UID) != gw.Status.PodUID || restartCount != gw.Status.RestartCount
+	if reapply {
+		r.Log.Info("vpn gw pod recreated or restarted, reapply configuration",
+			"pod", pod.Name, "uid", pod.UID, "restartCount", restartCount)
+	}
+	if reapply && gw.Spec.IpsecVpn.Enabled {
+		// the watcher in the ipsec container loads the mounted configuration on change,
+		// reload it in case charon was not ready when the watcher started
+		r.Log.Info("start run cmd", "cmd", IpsecConnectionReloadCMD)
+		stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, IpsecVpnServer, []string{"/bin/bash", "-c", IpsecConnectionReloadCMD}...)
 		if err != nil {
-			r.Log.Error(err, "failed to list vpn gw ipsec connections")
-			return SyncStateError, err
-		}
-		// format ipsec connections
-		connections := ""
-		for _, v := range res {
-			if v.Spec.VpnGw == "" || v.Spec.VpnGw != gw.Name {
-				err := fmt.Errorf("ipsec connection spec vpn gw is invalid, spec vpn gw: %s", v.Spec.VpnGw)
-				r.Log.Error(err, "ignore invalid ipsec connection")
-				continue
-			}
-			if v.Spec.Auth == "" || v.Spec.IkeVersion == "" || v.Spec.Proposals == "" ||
-				v.Spec.LocalCN == "" || v.Spec.LocalPublicIp == "" || v.Spec.LocalPrivateCidrs == "" ||
-				v.Spec.RemoteCN == "" || v.Spec.RemotePublicIp == "" || v.Spec.RemotePrivateCidrs == "" {
-				err := fmt.Errorf("invalid ipsec connection, exist empty spec: %+v", v)
-				r.Log.Error(err, "ignore invalid ipsec connection")
+			if len(errOutput) > 0 {
+				err = fmt.Errorf("failed to ExecuteCommandInContainer, errOutput: %v", errOutput)
+				r.Log.Error(err, "failed to reload vpn gw ipsec connections")
 			}
-			connections += fmt.Sprintf("%s %s %s %s %s %s %s %s %s %s,", v.Name, v.Spec.Auth, v.Spec.IkeVersion, v.Spec.Proposals,
-				v.Spec.LocalCN, v.Spec.LocalPublicIp, v.Spec.LocalPrivateCidrs,
-				v.Spec.RemoteCN, v.Spec.RemotePublicIp, v.Spec.RemotePrivateCidrs)
-		}
-		if connections != "" {
-			// get pod from statefulset
-			pod := &corev1.Pod{}
-			err = r.Get(context.Background(), types.NamespacedName{
-				Name:      gw.Name + "-0",
-				Namespace: gw.Namespace,
-			}, pod)
-
-			if err != nil {
-				r.Log.Error(err, "failed to get vpn gw pod")
-				time.Sleep(1 * time.Second)
-				return SyncStateError, err
-			} else if pod.Status.Phase != "Running" {
-				err = fmt.Errorf("pod is not running now")
-				r.Log.Error(err, "wait a while to refresh vpn gw ipsec connections")
-				time.Sleep(5 * time.Second)
-				return SyncStateError, err
-			}
-			r.Log.Info("found vpn gw pod", "pod", pod.Name)
-			// exec pod to run cmd to refresh ipsec connections
-			cmd := fmt.Sprintf(IpsecConnectionRefreshTemplate, connections)
-			r.Log.Info("start run cmd", "cmd", cmd)
-			// refresh ipsec connections by exec pod
-			stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, IpsecVpnServer, []string{"/bin/bash", "-c", cmd}...)
-			if err != nil {
-				if len(errOutput) > 0 {
-					err = fmt.Errorf("failed to ExecuteCommandInContainer, errOutput: %v", errOutput)
-					r.Log.Error(err, "failed to refresh vpn gw ipsec connections")
-				}
-				if len(stdOutput) > 0 {
-					err = fmt.Errorf("failed to ExecuteCommandInContainer, errOutput: %v", errOutput)
-					r.Log.Error(err, "failed to refresh vpn gw ipsec connections")
-				}
-				time.Sleep(2 * time.Second)
-				return SyncStateError, err
-			}
-			for _, conn := range res {
-				conns = append(conns, conn.Name)
+			if len(stdOutput) > 0 {
+				err = fmt.Errorf("failed to ExecuteCommandInContainer, stdOutput: %v", stdOutput)
+				r.Log.Error(err, "failed to reload vpn gw ipsec connections")
 			}
+			time.Sleep(2 * time.Second)
+			return SyncStateError, err
 		}
 	}
-	newGw = gw.DeepCopy()
-	if r.isChanged(newGw, conns) {
+	// renewed certificates are reloaded in place without restarting the vpn gw containers
+	sslCert, ipsecCert, err := r.reloadCertificates(context.Background(), gw, pod, reapply)
+	if err != nil {
+		r.Log.Error(err, "failed to reload vpn gw certificates")
+		return SyncStateError, err
+	}
+	if gw.Spec.SslVpn.Enabled {
+		if accessHash, err = r.reloadSslVpnAccess(gw, pod, accessHash, reapply); err != nil {
+			r.Log.Error(err, "failed to reload vpn gw ssl vpn access rules")
+			time.Sleep(2 * time.Second)
+			return SyncStateError, err
+		}
+	}
+	var broadcast string
+	if gw.Spec.SslVpn.Enabled {
+		if broadcast, err = r.broadcastSslVpn(gw, pod); err != nil {
+			r.Log.Error(err, "failed to broadcast to vpn gw ssl vpn clients")
+			return SyncStateError, err
+		}
+	}
+	expiryCondition, err := r.checkCertificateExpiryIfDue(context.Background(), gw, pod, sslCert, ipsecCert)
+	if err != nil {
+		r.Log.Error(err, "failed to check vpn gw certificate expiry")
+		return SyncStateError, err
+	}
+	// ssl vpn configuration is rendered from the container env by its start up script,
+	// so a restarted ssl container has already applied it again
+	newGw := gw.DeepCopy()
+	changed := false
+	meta.SetStatusCondition(&newGw.Status.Conditions, *expiryCondition)
+	// certificate expiry read back from the api server is in local time
+	if !equality.Semantic.DeepEqual(newGw.Status.SslVpnCertificate, sslCert) || !equality.Semantic.DeepEqual(newGw.Status.IpsecVpnCertificate, ipsecCert) {
+		newGw.Status.SslVpnCertificate = sslCert
+		newGw.Status.IpsecVpnCertificate = ipsecCert
+		changed = true
+	}
+	if newGw.Status.ObservedGeneration != gw.Generation {
+		newGw.Status.ObservedGeneration = gw.Generation
+		changed = true
+	}
+	if newGw.Status.SslVpnAccessHash != accessHash {
+		newGw.Status.SslVpnAccessHash = accessHash
+		changed = true
+	}
+	if newGw.Status.SslVpnBroadcast != broadcast {
+		newGw.Status.SslVpnBroadcast = broadcast
+		changed = true
+	}
+	if !reflect.DeepEqual(newGw.Status.IpsecConnections, conns) {
+		newGw.Status.IpsecConnections = conns
+		changed = true
+	}
+	if certCondition != nil {
+		meta.SetStatusCondition(&newGw.Status.Conditions, *certCondition)
+	} else {
+		meta.RemoveStatusCondition(&newGw.Status.Conditions, vpngwv2.VpnGwCertificateReady)
+	}
+	if dhCondition != nil {
+		meta.SetStatusCondition(&newGw.Status.Conditions, *dhCondition)
+	} else {
+		meta.RemoveStatusCondition(&newGw.Status.Conditions, vpngwv2.VpnGwDhReady)
+	}
+	if !reflect.DeepEqual(newGw.Status.Conditions, gw.Status.Conditions) {
+		changed = true
+	}
+	if reapply {
+		newGw.Status.PodUID = string(pod.UID)
+		newGw.Status.RestartCount = restartCount
+		newGw.Status.LastAppliedTime = metav1.Now()
+		changed = true
+	}
+	if changed {
 		err = r.Status().Update(context.Background(), newGw)
 		if err != nil {
 			r.Log.Error(err, "failed to update vpn gw status")
@@ -599,7 +910,8 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.V
 // +kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsecconns,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsecconns/status,verbs=get;update;patch
 // +kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=ipsecconns/finalizers,verbs=update
-// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch
+// +kubebuilder:rbac:groups=core,resources=secrets,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=configmaps,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets,verbs=get;list;watch;create;update;patch;delete
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/scale,verbs=get;watch;update
 // +kubebuilder:rbac:groups=apps,resources=statefulsets/status,verbs=get;update;patch
@@ -608,6 +920,8 @@ func (r *VpnGwReconciler) handleAddOrUpdateVpnGw(req ctrl.Request, gw *vpngwv1.V
 // +kubebuilder:rbac:groups=core,resources=pods/exec,verbs=create
 // +kubebuilder:rbac:groups=core,resources=pods/log,verbs=get
 // +kubebuilder:rbac:groups=core,resources=nodes,verbs=get;list
+// +kubebuilder:rbac:groups=cert-manager.io,resources=certificates,verbs=get;list;watch;create;update;patch;delete
+// +kubebuilder:rbac:groups=core,resources=events,verbs=create;patch
 
 // Reconcile is part of the main kubernetes reconciliation loop which aims to
 // move the current state of the cluster closer to the desired state.
@@ -628,6 +942,8 @@ func (r *VpnGwReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		return ctrl.Result{}, err
 	}
 	if gw == nil {
+		certExpiry.DeletePartialMatch(prometheus.Labels{"namespace": req.Namespace, "vpn_gw": req.Name})
+		r.certChecks.forget(req.NamespacedName)
 		return ctrl.Result{}, nil
 	}
 
@@ -642,17 +958,19 @@ func (r *VpnGwReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl
 		r.Log.Error(err, "failed to handle vpn gw")
 		return ctrl.Result{}, nil
 	}
-	return ctrl.Result{}, nil
+	return ctrl.Result{RequeueAfter: CertExpiryCheckInterval}, nil
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *VpnGwReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	r.dh = newDhGenerator()
+	r.certChecks = newCertExpiryChecks()
 	return ctrl.NewControllerManagedBy(mgr).
-		For(&vpngwv1.VpnGw{},
+		For(&vpngwv2.VpnGw{},
 			builder.WithPredicates(
 				predicate.NewPredicateFuncs(
 					func(object client.Object) bool {
-						_, ok := object.(*vpngwv1.VpnGw)
+						_, ok := object.(*vpngwv2.VpnGw)
 						if !ok {
 							err := errors.New("invalid vpn gw")
 							r.Log.Error(err, "expected vpn gw in worequeue but got something else")
@@ -664,12 +982,169 @@ func (r *VpnGwReconciler) SetupWithManager(mgr ctrl.Manager) error {
 			),
 		).
 		Owns(&appsv1.StatefulSet{}).
-		Owns(&vpngwv1.IpsecConn{}).
+		Owns(&corev1.ConfigMap{}).
+		Owns(&corev1.Secret{}).
+		// ipsec connections, ssl vpn clients and access policies are written by users, they are not owned by the vpn gw
+		Watches(&source.Kind{Type: &vpngwv2.IpsecConn{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSpecVpnGwToVpnGw),
+		).
+		Watches(&source.Kind{Type: &vpngwv2.SslVpnClient{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSpecVpnGwToVpnGw),
+		).
+		Watches(&source.Kind{Type: &vpngwv2.VpnAccessPolicy{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSpecVpnGwToVpnGw),
+		).
+		// refresh the remote access users, client profiles and certificates once the referenced secret changes
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapSecretToVpnGw),
+		).
+		// refresh the totp keys once the totp secret of a client changes
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapTotpSecretToVpnGw),
+		).
+		// refresh the ipsec secret once the remote ca of an ipsec connection changes
+		Watches(&source.Kind{Type: &corev1.Secret{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapRemoteCaToVpnGw(IpsecRemoteCaSecret)),
+		).
+		Watches(&source.Kind{Type: &corev1.ConfigMap{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapRemoteCaToVpnGw(IpsecRemoteCaConfigMap)),
+		).
+		// vpn gw pod is owned by the statefulset, watch it to reapply configuration after restarts,
+		// the pod cache is limited to the vpn gw pods by VpnGwPodSelector
+		Watches(&source.Kind{Type: &corev1.Pod{}},
+			handler.EnqueueRequestsFromMapFunc(r.mapPodToVpnGw),
+			builder.WithPredicates(predicate.Funcs{
+				CreateFunc: func(e event.CreateEvent) bool {
+					return true
+				},
+				UpdateFunc: func(e event.UpdateEvent) bool {
+					oldPod, ok := e.ObjectOld.(*corev1.Pod)
+					if !ok {
+						return false
+					}
+					newPod, ok := e.ObjectNew.(*corev1.Pod)
+					if !ok {
+						return false
+					}
+					return isVpnGwPodRunning(oldPod) != isVpnGwPodRunning(newPod) ||
+						vpnGwPodRestartCount(oldPod) != vpnGwPodRestartCount(newPod)
+				},
+				DeleteFunc: func(e event.DeleteEvent) bool {
+					return false
+				},
+				GenericFunc: func(e event.GenericEvent) bool {
+					return false
+				},
+			}),
+		).
 		Complete(r)
 }
 
-func (r *VpnGwReconciler) getVpnGw(ctx context.Context, name types.NamespacedName) (*vpngwv1.VpnGw, error) {
-	var res vpngwv1.VpnGw
+// map secret to the vpn gws which reference it
+func (r *VpnGwReconciler) mapSecretToVpnGw(object client.Object) []reconcile.Request {
+	gws := &vpngwv2.VpnGwList{}
+	if err := r.List(context.Background(), gws, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list vpn gws", "namespace", object.GetNamespace())
+		return nil
+	}
+	requests := []reconcile.Request{}
+	for _, gw := range gws.Items {
+		// the ca of the ipsec secret is embedded in the client profiles and the peer descriptor,
+		// renewed certificates are reloaded by the vpn servers
+		secrets := []string{}
+		if gw.Spec.SslVpn.Enabled {
+			secrets = append(secrets, gw.Spec.SslVpn.SslSecret)
+			if !gw.Spec.SslVpn.DisableDh {
+				secrets = append(secrets, dhSecretName(&gw))
+			}
+		}
+		if gw.Spec.IpsecVpn.Enabled {
+			secrets = append(secrets, gw.Spec.IpsecVpn.IpsecSecret)
+		}
+		if ra := gw.Spec.IpsecVpn.RemoteAccess; ra != nil {
+			secrets = append(secrets, ra.UsersSecret, ra.ClientCertsSecret)
+		}
+		for _, secret := range secrets {
+			if secret == object.GetName() {
+				requests = append(requests, reconcile.Request{
+					NamespacedName: types.NamespacedName{Name: gw.Name, Namespace: gw.Namespace},
+				})
+				break
+			}
+		}
+	}
+	// the pre-shared keys of the ipsec connections are rendered into swanctl.conf
+	conns := &vpngwv2.IpsecConnList{}
+	if err := r.List(context.Background(), conns, client.InNamespace(object.GetNamespace())); err != nil {
+		r.Log.Error(err, "failed to list ipsec connections", "namespace", object.GetNamespace())
+		return requests
+	}
+	for _, conn := range conns.Items {
+		if conn.Spec.Auth != "psk" || conn.Spec.PskSecret != object.GetName() || conn.Spec.VpnGw == "" {
+			continue
+		}
+		request := reconcile.Request{
+			NamespacedName: types.NamespacedName{Name: conn.Spec.VpnGw, Namespace: conn.Namespace},
+		}
+		found := false
+		for _, req := range requests {
+			if req == request {
+				found = true
+				break
+			}
+		}
+		if !found {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
+
+// map the objects referencing a vpn gw by spec vpn gw to the vpn gw
+func (r *VpnGwReconciler) mapSpecVpnGwToVpnGw(object client.Object) []reconcile.Request {
+	var gw string
+	switch o := object.(type) {
+	case *vpngwv2.IpsecConn:
+		gw = o.Spec.VpnGw
+	case *vpngwv2.SslVpnClient:
+		gw = o.Spec.VpnGw
+	case *vpngwv2.VpnAccessPolicy:
+		gw = o.Spec.VpnGw
+	default:
+		return nil
+	}
+	if gw == "" {
+		return nil
+	}
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{Name: gw, Namespace: object.GetNamespace()},
+	}}
+}
+
+// map vpn gw pod to the vpn gw which owns its statefulset
+func (r *VpnGwReconciler) mapPodToVpnGw(object client.Object) []reconcile.Request {
+	pod, ok := object.(*corev1.Pod)
+	if !ok {
+		return nil
+	}
+	if _, ok := pod.Labels[EnableIpsecVpnLabel]; !ok {
+		return nil
+	}
+	owner := metav1.GetControllerOf(pod)
+	if owner == nil || owner.Kind != "StatefulSet" {
+		return nil
+	}
+	// vpn gw statefulset has the same name as the vpn gw
+	return []reconcile.Request{{
+		NamespacedName: types.NamespacedName{
+			Name:      owner.Name,
+			Namespace: pod.Namespace,
+		},
+	}}
+}
+
+func (r *VpnGwReconciler) getVpnGw(ctx context.Context, name types.NamespacedName) (*vpngwv2.VpnGw, error) {
+	var res vpngwv2.VpnGw
 	err := r.Get(ctx, name, &res)
 	if apierrors.IsNotFound(err) { // in case of delete, get fails and we need to pass nil to the handler
 		return nil, nil
@@ -680,10 +1155,47 @@ func (r *VpnGwReconciler) getVpnGw(ctx context.Context, name types.NamespacedNam
 	return &res, nil
 }
 
-// returns all ipsec connections who has labels about the vpn gw
-func (r *VpnGwReconciler) getIpsecConnections(ctx context.Context, gw *vpngwv1.VpnGw) ([]vpngwv1.IpsecConn, error) {
-	var res vpngwv1.IpsecConnList
-	err := r.List(ctx, &res, client.MatchingLabels{VpnGwLabel: gw.Name})
+// returns the vpn gw pod created by the statefulset
+func (r *VpnGwReconciler) getVpnGwPod(ctx context.Context, gw *vpngwv2.VpnGw) (*corev1.Pod, error) {
+	pod := &corev1.Pod{}
+	err := r.Get(ctx, types.NamespacedName{
+		Name:      gw.Name + "-0",
+		Namespace: gw.Namespace,
+	}, pod)
+	if err != nil {
+		return nil, err
+	}
+	return pod, nil
+}
+
+// vpn gw pod is running only if all its containers are running
+func isVpnGwPodRunning(pod *corev1.Pod) bool {
+	if pod.Status.Phase != corev1.PodRunning || len(pod.Status.ContainerStatuses) == 0 {
+		return false
+	}
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// returns the total restart count of the ssl and ipsec containers
+func vpnGwPodRestartCount(pod *corev1.Pod) int32 {
+	var count int32
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.Name == SslVpnServer || status.Name == IpsecVpnServer {
+			count += status.RestartCount
+		}
+	}
+	return count
+}
+
+// returns all ipsec connections in the namespace of the vpn gw who has labels about the vpn gw
+func (r *VpnGwReconciler) getIpsecConnections(ctx context.Context, gw *vpngwv2.VpnGw) ([]vpngwv2.IpsecConn, error) {
+	var res vpngwv2.IpsecConnList
+	err := r.List(ctx, &res, client.InNamespace(gw.Namespace), client.MatchingLabels{VpnGwLabel: gw.Name})
 	if err != nil {
 		return nil, err
 	}
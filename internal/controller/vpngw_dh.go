@@ -0,0 +1,180 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"sync"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+const (
+	// dh parameters generated by the operator, shared by the vpn gws in the namespace
+	DefaultDhSecretName = "kube-combo-dh"
+	DhKey               = "dh.pem"
+	DhBits              = 2048
+
+	OvpnDhNoneKey = "OVPN_DH_NONE"
+)
+
+// dhSecretName returns the dh parameters secret mounted by the ssl vpn server
+func dhSecretName(gw *vpngwv2.VpnGw) string {
+	if gw.Spec.SslVpn.DhSecret != "" {
+		return gw.Spec.SslVpn.DhSecret
+	}
+	return DefaultDhSecretName
+}
+
+// generateDhParams generates pem encoded dh parameters with a safe prime and generator 2, like openssl dhparam
+func generateDhParams(bits int) ([]byte, error) {
+	one := big.NewInt(1)
+	for {
+		q, err := rand.Prime(rand.Reader, bits-1)
+		if err != nil {
+			return nil, err
+		}
+		p := new(big.Int).Lsh(q, 1)
+		p.Add(p, one)
+		if p.BitLen() != bits || !p.ProbablyPrime(20) {
+			continue
+		}
+		der, err := asn1.Marshal(struct {
+			P *big.Int
+			G int
+		}{P: p, G: 2})
+		if err != nil {
+			return nil, err
+		}
+		return pem.EncodeToMemory(&pem.Block{Type: "DH PARAMETERS", Bytes: der}), nil
+	}
+}
+
+// dhGenerator generates the dh parameters secret of each namespace in the background,
+// generating a safe prime takes minutes
+type dhGenerator struct {
+	mu         sync.Mutex
+	generating map[string]bool
+	failed     map[string]error
+}
+
+func newDhGenerator() *dhGenerator {
+	return &dhGenerator{
+		generating: map[string]bool{},
+		failed:     map[string]error{},
+	}
+}
+
+// start generates the dh parameters secret of the namespace unless it is in progress,
+// returns the error of the last generation
+func (g *dhGenerator) start(namespace string, create func([]byte) error) error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.generating[namespace] {
+		return nil
+	}
+	err := g.failed[namespace]
+	delete(g.failed, namespace)
+	g.generating[namespace] = true
+	go func() {
+		dh, err := generateDhParams(DhBits)
+		if err == nil {
+			err = create(dh)
+		}
+		g.mu.Lock()
+		defer g.mu.Unlock()
+		delete(g.generating, namespace)
+		if err != nil {
+			g.failed[namespace] = err
+		}
+	}()
+	return err
+}
+
+// reconcileDhSecret ensures the dh parameters secret generated by the operator or set by the user,
+// returns the DhReady condition, nil if dh is not used
+func (r *VpnGwReconciler) reconcileDhSecret(ctx context.Context, gw *vpngwv2.VpnGw) (*metav1.Condition, error) {
+	if !gw.Spec.SslVpn.Enabled || gw.Spec.SslVpn.DisableDh {
+		return nil, nil
+	}
+	if name := gw.Spec.SslVpn.DhSecret; name != "" {
+		condition := &metav1.Condition{
+			Type:               vpngwv2.VpnGwDhReady,
+			Status:             metav1.ConditionTrue,
+			Reason:             "Ready",
+			Message:            fmt.Sprintf("dh parameters are set by secret %s", name),
+			ObservedGeneration: gw.Generation,
+		}
+		secret := &corev1.Secret{}
+		err := r.Get(ctx, types.NamespacedName{Name: name, Namespace: gw.Namespace}, secret)
+		if err != nil && !apierrors.IsNotFound(err) {
+			r.Log.Error(err, "failed to get dh secret", "secret", name)
+			return nil, err
+		}
+		if err != nil || len(secret.Data[DhKey]) == 0 {
+			condition.Status = metav1.ConditionFalse
+			condition.Reason = "SecretNotFound"
+			condition.Message = fmt.Sprintf("secret %s with %s is not found, create it or leave dh secret empty to generate one", name, DhKey)
+		}
+		return condition, nil
+	}
+
+	condition := &metav1.Condition{
+		Type:               vpngwv2.VpnGwDhReady,
+		Status:             metav1.ConditionTrue,
+		Reason:             "Ready",
+		Message:            fmt.Sprintf("dh parameters are generated into secret %s", DefaultDhSecretName),
+		ObservedGeneration: gw.Generation,
+	}
+	secret := &corev1.Secret{}
+	err := r.Get(ctx, types.NamespacedName{Name: DefaultDhSecretName, Namespace: gw.Namespace}, secret)
+	if err == nil && len(secret.Data[DhKey]) != 0 {
+		return condition, nil
+	}
+	if err != nil && !apierrors.IsNotFound(err) {
+		r.Log.Error(err, "failed to get dh secret", "secret", DefaultDhSecretName)
+		return nil, err
+	}
+
+	// the secret watch requeues the vpn gws once the secret is created
+	namespace := gw.Namespace
+	lastErr := r.dh.start(namespace, func(dh []byte) error {
+		secret := &corev1.Secret{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:      DefaultDhSecretName,
+				Namespace: namespace,
+			},
+			Data: map[string][]byte{DhKey: dh},
+		}
+		err := r.Create(context.Background(), secret)
+		if apierrors.IsAlreadyExists(err) {
+			// an empty secret is created by someone else, fill it
+			existing := &corev1.Secret{}
+			if err = r.Get(context.Background(), types.NamespacedName{Name: DefaultDhSecretName, Namespace: namespace}, existing); err == nil {
+				existing.Data = secret.Data
+				err = r.Update(context.Background(), existing)
+			}
+		}
+		if err != nil {
+			r.Log.Error(err, "failed to create dh secret", "namespace", namespace)
+			return err
+		}
+		r.Log.Info("dh secret generated", "namespace", namespace)
+		return nil
+	})
+	condition.Status = metav1.ConditionFalse
+	condition.Reason = "Generating"
+	condition.Message = fmt.Sprintf("generating %d bits dh parameters into secret %s", DhBits, DefaultDhSecretName)
+	if lastErr != nil {
+		condition.Message = fmt.Sprintf("%s, last generation failed: %v", condition.Message, lastErr)
+	}
+	return condition, nil
+}
@@ -0,0 +1,166 @@
+/*
+Copyright 2023.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/go-logr/logr"
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/controller/controllerutil"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+
+	vpngwv2 "github.com/kubecombo/kube-combo/api/v2"
+)
+
+// VpnSessionReconciler disconnects the ssl vpn clients whose sessions are deleted
+type VpnSessionReconciler struct {
+	client.Client
+	KubeClient kubernetes.Interface
+	RestConfig *rest.Config
+	Log        logr.Logger
+	Scheme     *runtime.Scheme
+}
+
+// getSslVpnPod returns the running vpn gw pod of the session, nil if the ssl vpn server is gone
+func (r *VpnSessionReconciler) getSslVpnPod(ctx context.Context, session *vpngwv2.VpnSession) (*corev1.Pod, error) {
+	gw := &vpngwv2.VpnGw{}
+	err := r.Get(ctx, types.NamespacedName{Name: session.Spec.VpnGw, Namespace: session.Namespace}, gw)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if !gw.Spec.SslVpn.Enabled {
+		return nil, nil
+	}
+	pod := &corev1.Pod{}
+	err = r.Get(ctx, types.NamespacedName{Name: gw.Name + "-0", Namespace: gw.Namespace}, pod)
+	if err != nil {
+		return nil, client.IgnoreNotFound(err)
+	}
+	if !isVpnGwPodRunning(pod) {
+		return nil, nil
+	}
+	return pod, nil
+}
+
+func (r *VpnSessionReconciler) handleDelVpnSession(ctx context.Context, session *vpngwv2.VpnSession) (SyncState, error) {
+	namespacedName := fmt.Sprintf("%s/%s", session.Namespace, session.Name)
+	r.Log.Info("start handleDelVpnSession", "vpnSession", namespacedName)
+	defer r.Log.Info("end handleDelVpnSession", "vpnSession", namespacedName)
+
+	if err := validateVpnSession(session); err != nil {
+		// the session is not created by the operator, nothing to disconnect
+		r.Log.Error(err, "ignore invalid vpn session")
+	} else {
+		pod, err := r.getSslVpnPod(ctx, session)
+		if err != nil {
+			r.Log.Error(err, "failed to get the vpn gw pod of vpn session")
+			return SyncStateError, err
+		}
+		// the clients are disconnected along with the ssl vpn server
+		if pod != nil {
+			r.Log.Info("disconnect ssl vpn client", "cn", session.Spec.CN, "proto", session.Spec.Proto)
+			stdOutput, errOutput, err := ExecuteCommandInContainer(r.KubeClient, r.RestConfig, pod.Namespace, pod.Name, SslVpnServer,
+				SslVpnManagementCMD, "kill", session.Spec.Proto, session.Spec.CN)
+			if err != nil {
+				err = fmt.Errorf("failed to disconnect ssl vpn client, stdOutput: %v, errOutput: %v, err: %v", stdOutput, errOutput, err)
+				r.Log.Error(err, "failed to run management.sh")
+				return SyncStateError, err
+			}
+		}
+	}
+	newSession := session.DeepCopy()
+	controllerutil.RemoveFinalizer(newSession, VpnSessionFinalizer)
+	if err := r.Patch(ctx, newSession, client.MergeFrom(session)); err != nil {
+		r.Log.Error(err, "failed to remove the finalizer of vpn session")
+		return SyncStateError, err
+	}
+	return SyncStateSuccess, nil
+}
+
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=vpnsessions,verbs=get;list;watch;create;update;patch;delete
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=vpnsessions/status,verbs=get;update;patch
+//+kubebuilder:rbac:groups=vpn-gw.kube-combo.com,resources=vpnsessions/finalizers,verbs=update
+
+// Reconcile disconnects the ssl vpn client once its session is deleted,
+// the sessions are created and updated by SslVpnSessionMonitor
+//
+// For more details, check Reconcile and its Result here:
+// - https://pkg.go.dev/sigs.k8s.io/controller-runtime@v0.14.1/pkg/reconcile
+func (r *VpnSessionReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
+	namespacedName := req.NamespacedName.String()
+	r.Log.Info("start reconcile", "vpnSession", namespacedName)
+	defer r.Log.Info("end reconcile", "vpnSession", namespacedName)
+	updates.Inc()
+
+	session := &vpngwv2.VpnSession{}
+	err := r.Get(ctx, req.NamespacedName, session)
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return ctrl.Result{}, nil
+		}
+		r.Log.Error(err, "failed to get vpn session")
+		return ctrl.Result{}, err
+	}
+	if session.DeletionTimestamp.IsZero() || !controllerutil.ContainsFinalizer(session, VpnSessionFinalizer) {
+		return ctrl.Result{}, nil
+	}
+
+	res, err := r.handleDelVpnSession(ctx, session)
+	switch res {
+	case SyncStateError:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle vpn session")
+		return ctrl.Result{}, errRetry
+	case SyncStateErrorNoRetry:
+		updateErrors.Inc()
+		r.Log.Error(err, "failed to handle vpn session")
+		return ctrl.Result{}, nil
+	}
+	return ctrl.Result{}, nil
+}
+
+// SetupWithManager sets up the controller with the Manager.
+func (r *VpnSessionReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	return ctrl.NewControllerManagedBy(mgr).
+		For(&vpngwv2.VpnSession{},
+			builder.WithPredicates(
+				predicate.NewPredicateFuncs(
+					func(object client.Object) bool {
+						_, ok := object.(*vpngwv2.VpnSession)
+						if !ok {
+							err := errors.New("invalid vpn session")
+							r.Log.Error(err, "expected vpn session in worequeue but got something else")
+							return false
+						}
+						return true
+					},
+				),
+			),
+		).
+		Complete(r)
+}